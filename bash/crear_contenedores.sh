@@ -1,4 +1,7 @@
 IMAGES=("img_bajo" "img_cpu" "img_ram")
+# Clase de cada imagen (mismo orden): el daemon solo desaloja contenedores
+# con su label so1.owner, y la política por defecto agrupa por so1.clase
+CLASES=("bajo" "cpu" "ram")
 
 echo "Generando 10 contenedores aleatorios..."
 
@@ -7,11 +10,14 @@ do
     # Elegir imagen aleatoria
     RAND_INDEX=$((RANDOM % 3))
     IMAGE=${IMAGES[$RAND_INDEX]}
+    CLASE=${CLASES[$RAND_INDEX]}
 
     # Nombre único para el contenedor
     CONTAINER_NAME="contenedor_${i}_${RANDOM}"
 
-    docker run -d --name "$CONTAINER_NAME" "$IMAGE"
+    docker run -d --name "$CONTAINER_NAME" \
+        --label so1.owner=so1-daemon --label so1.clase="$CLASE" \
+        "$IMAGE"
 
     echo "[$i] Contenedor creado: $CONTAINER_NAME usando $IMAGE"
 done
@@ -1,3 +1,8 @@
+-- Esquema base (migración 0001_base). Crear una DB con este archivo y
+-- después correr `daemon migrate up`: todo cambio posterior vive solo en
+-- go-deamon/migrations, no se copia acá (un ALTER TABLE fallaría con
+-- "duplicate column name" sobre una DB creada con columnas ya agregadas).
+
 PRAGMA journal_mode=WAL;
 PRAGMA synchronous=NORMAL;
 
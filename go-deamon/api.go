@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// muestraActual es lo último que leyó cada colector, para las rutas "en
+// vivo". Cada parte recuerda el lote que la trajo porque los colectores
+// tienen intervalos distintos.
+type muestraActual struct {
+	mu     sync.RWMutex
+	idLote int64 // último lote guardado
+
+	si     *SysInfo
+	siLote int64
+	siTs   time.Time
+
+	ci     *ContInfo
+	ciLote int64
+	ciTs   time.Time
+
+	cpuTotal float64
+	cpuTs    time.Time // cero = todavía no hay CPU del host
+}
+
+// merge actualiza solo lo que trae el lote; el resto sigue con su último valor.
+func (m *muestraActual) merge(idLote int64, mu muestra) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now().UTC()
+	m.idLote = idLote
+	if mu.si != nil {
+		m.si, m.siLote, m.siTs = mu.si, idLote, now
+	}
+	if mu.ci != nil {
+		m.ci, m.ciLote, m.ciTs = mu.ci, idLote, now
+	}
+	if mu.cpuTotal != nil {
+		m.cpuTotal, m.cpuTs = *mu.cpuTotal, now
+	}
+}
+
+type apiSysinfo struct {
+	Ts         time.Time    `json:"ts"`
+	IDLote     int64        `json:"id_lote"`
+	TotalRAMKB uint64       `json:"total_ram_kb"`
+	FreeRAMKB  uint64       `json:"free_ram_kb"`
+	UsedRAMKB  uint64       `json:"used_ram_kb"`
+	CPUTotal   float64      `json:"cpu_total_pct"`
+	Procs      int          `json:"procs"`
+	Procesos   []apiProceso `json:"procesos"`
+}
+
+type apiProceso struct {
+	PID          int      `json:"pid"`
+	Nombre       string   `json:"nombre"`
+	Cmdline      string   `json:"cmdline"`
+	VSZKB        uint64   `json:"vsz_kb"`
+	RSSKB        uint64   `json:"rss_kb"`
+	MemPct       float64  `json:"mem_pct"`
+	CPUUsage     float64  `json:"cpu_usage"`
+	CPUIntervalo *float64 `json:"cpu_pct_intervalo"`
+}
+
+type apiContenedor struct {
+	ID           string   `json:"id"`
+	CgroupPath   string   `json:"cgroup_path"`
+	RSSKB        uint64   `json:"rss_kb"`
+	CPUJiffies   uint64   `json:"cpu_jiffies"`
+	CPUIntervalo *float64 `json:"cpu_pct_intervalo"`
+	Procs        uint32   `json:"procs"`
+}
+
+func toAPIProceso(p Process) apiProceso {
+	a := apiProceso{
+		PID: p.PID, Nombre: p.Name, Cmdline: p.Cmdline,
+		VSZKB: p.VSZ, RSSKB: p.RSS, MemPct: p.MemoryUsage, CPUUsage: p.CPUUsage,
+	}
+	if p.CPUPercentOK {
+		v := p.CPUPercent
+		a.CPUIntervalo = &v
+	}
+	return a
+}
+
+func toAPIContenedor(c ContainerEntry) apiContenedor {
+	a := apiContenedor{
+		ID: c.ContainerID, CgroupPath: c.CgroupPath,
+		RSSKB: c.RSSKB, CPUJiffies: c.CPUJiffies, Procs: c.Procs,
+	}
+	if c.CPUPercentOK {
+		v := c.CPUPercent
+		a.CPUIntervalo = &v
+	}
+	return a
+}
+
+// StartAPI levanta el servidor HTTP (API JSON y /metrics) en addr. Devuelve el *http.Server para
+// cerrarlo al terminar el daemon.
+func (d *Daemon) StartAPI(addr string) (*http.Server, error) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/sysinfo", d.handleSysinfo)
+	mux.HandleFunc("GET /api/contenedores", d.handleContenedores)
+	mux.HandleFunc("GET /api/lotes", handleLotes)
+	mux.HandleFunc("GET /api/lotes/{id}/procesos", handleProcesosLote)
+	mux.HandleFunc("GET /api/top", handleTop)
+	mux.HandleFunc("GET /api/decisiones", handleDecisiones)
+	mux.HandleFunc("GET /api/stream", d.handleStream)
+	mux.HandleFunc("GET /api/cron", d.handleCron)
+	mux.HandleFunc("GET /metrics", d.handleMetrics)
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("no se pudo escuchar en %s: %w", addr, err)
+	}
+
+	srv := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Printf("WARNING api: %v\n", err)
+		}
+	}()
+	return srv, nil
+}
+
+// stopAPI deja terminar los requests en curso hasta que ctx venza.
+func stopAPI(ctx context.Context, srv *http.Server) error {
+	if srv == nil {
+		return nil
+	}
+	return srv.Shutdown(ctx)
+}
+
+func (d *Daemon) handleSysinfo(w http.ResponseWriter, r *http.Request) {
+	d.actual.mu.RLock()
+	defer d.actual.mu.RUnlock()
+
+	if d.actual.si == nil {
+		writeError(w, http.StatusServiceUnavailable, "todavía no hay muestras")
+		return
+	}
+	si := d.actual.si
+	res := apiSysinfo{
+		Ts:         d.actual.siTs,
+		IDLote:     d.actual.siLote,
+		TotalRAMKB: si.Totalram,
+		FreeRAMKB:  si.Freeram,
+		CPUTotal:   d.actual.cpuTotal,
+		Procs:      si.Procs,
+		Procesos:   make([]apiProceso, 0, len(si.Processes)),
+	}
+	if si.Totalram >= si.Freeram {
+		res.UsedRAMKB = si.Totalram - si.Freeram
+	}
+	for _, p := range si.Processes {
+		res.Procesos = append(res.Procesos, toAPIProceso(p))
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (d *Daemon) handleContenedores(w http.ResponseWriter, r *http.Request) {
+	d.actual.mu.RLock()
+	defer d.actual.mu.RUnlock()
+
+	res := []apiContenedor{}
+	if d.actual.ci != nil {
+		for _, c := range d.actual.ci.Containers {
+			res = append(res, toAPIContenedor(c))
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"ts":           d.actual.ciTs,
+		"id_lote":      d.actual.ciLote,
+		"contenedores": res,
+	})
+}
+
+func (d *Daemon) handleCron(w http.ResponseWriter, r *http.Request) {
+	if d.cron == nil {
+		writeError(w, http.StatusNotFound, "el scheduler interno no está activo (cron_mode "+d.cfg.CronMode+")")
+		return
+	}
+	writeJSON(w, http.StatusOK, d.cron.Estado())
+}
+
+func handleLotes(w http.ResponseWriter, r *http.Request) {
+	limit, err := queryInt(r, "limit", 50)
+	if err != nil || limit <= 0 || limit > 1000 {
+		writeError(w, http.StatusBadRequest, "limit inválido (1-1000)")
+		return
+	}
+	antes, err := queryInt(r, "antes", 0)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "antes inválido")
+		return
+	}
+
+	lotes, err := ListarLotes(limit, int64(antes))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, lotes)
+}
+
+func handleProcesosLote(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		writeError(w, http.StatusBadRequest, "id de lote inválido")
+		return
+	}
+
+	procs, err := ProcesosDeLote(id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if len(procs) == 0 {
+		writeError(w, http.StatusNotFound, "lote sin procesos o inexistente")
+		return
+	}
+	writeJSON(w, http.StatusOK, procs)
+}
+
+// /api/top?por=ram|cpu&n=5&desde=RFC3339&hasta=RFC3339 (por defecto la última hora)
+func handleTop(w http.ResponseWriter, r *http.Request) {
+	por := r.URL.Query().Get("por")
+	if por == "" {
+		por = "ram"
+	}
+	if por != "ram" && por != "cpu" {
+		writeError(w, http.StatusBadRequest, "por debe ser ram o cpu")
+		return
+	}
+	n, err := queryInt(r, "n", 5)
+	if err != nil || n <= 0 || n > 100 {
+		writeError(w, http.StatusBadRequest, "n inválido (1-100)")
+		return
+	}
+
+	hasta := time.Now().UTC()
+	desde := hasta.Add(-time.Hour)
+	if v := r.URL.Query().Get("desde"); v != "" {
+		if desde, err = time.Parse(time.RFC3339, v); err != nil {
+			writeError(w, http.StatusBadRequest, "desde debe ser RFC3339")
+			return
+		}
+	}
+	if v := r.URL.Query().Get("hasta"); v != "" {
+		if hasta, err = time.Parse(time.RFC3339, v); err != nil {
+			writeError(w, http.StatusBadRequest, "hasta debe ser RFC3339")
+			return
+		}
+	}
+
+	top, err := TopProcesos(por, n, desde.UTC().Format(time.RFC3339Nano), hasta.UTC().Format(time.RFC3339Nano))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"por":   por,
+		"desde": desde.UTC(),
+		"hasta": hasta.UTC(),
+		"top":   top,
+	})
+}
+
+// /api/decisiones?lote=N (por defecto el último lote con decisiones)
+func handleDecisiones(w http.ResponseWriter, r *http.Request) {
+	lote, err := queryInt(r, "lote", 0)
+	if err != nil || lote < 0 {
+		writeError(w, http.StatusBadRequest, "lote inválido")
+		return
+	}
+
+	dec, err := DecisionesDeLote(int64(lote))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, dec)
+}
+
+func queryInt(r *http.Request, key string, def int) (int, error) {
+	v := r.URL.Query().Get(key)
+	if v == "" {
+		return def, nil
+	}
+	return strconv.Atoi(v)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
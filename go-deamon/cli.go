@@ -0,0 +1,567 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Un solo binario con subcomandos. Sin subcomando (o si empieza con un
+// flag) arranca el daemon, como antes.
+
+type subcomando struct {
+	nombre string
+	uso    string
+	run    func(args []string) int
+}
+
+func subcomandos() []subcomando {
+	return []subcomando{
+		{"daemon", "daemon [flags]", runDaemonCmd},
+		{"sysinfo", "sysinfo [--json] [--tui] [--every 2s]", runSysinfoCmd},
+		{"continfo", "continfo [--json]", runContinfoCmd},
+		{"verify", "verify [--json] [--tol-kb N] [--tol-pct P] [--tol-mem P] [--tol-cpu D] [--tol-procs N]", runVerifyCmd},
+		{"policy", "policy simulate [--json]", runPolicyCmd},
+		{"db", "db query [--json] \"SELECT ...\"", runDBCmd},
+		{"modules", "modules load|unload|status [--json]", runModulesCmd},
+		{"cron", "cron install|remove|status [--json]", runCronCmd},
+		{"generate", "generate [--json] [--plan] [--seed N] [--ronda N] [--generator archivo]", runGenerateCmd},
+		{"migrate", "migrate status|up [version]|down [pasos] [--json]", runMigrateCmd},
+	}
+}
+
+func runCLI(args []string) int {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return runDaemonCmd(args)
+	}
+	if args[0] == "help" {
+		printUso()
+		return 0
+	}
+	for _, sc := range subcomandos() {
+		if sc.nombre == args[0] {
+			return sc.run(args[1:])
+		}
+	}
+	fmt.Printf("subcomando desconocido: %s\n\n", args[0])
+	printUso()
+	return 2
+}
+
+func printUso() {
+	fmt.Println("uso: daemon <subcomando> [flags]")
+	fmt.Println()
+	for _, sc := range subcomandos() {
+		fmt.Printf("  %s\n", sc.uso)
+	}
+	fmt.Println()
+	fmt.Println("Todos aceptan los flags de configuración (--config, --db, --runtime, ...);")
+	fmt.Println("ver `daemon <subcomando> -h`.")
+}
+
+// cmdCtx es lo que recibe cada subcomando después de parsear sus flags.
+type cmdCtx struct {
+	ctx  context.Context
+	cfg  *Config
+	args []string // posicionales
+	json bool
+}
+
+// errConfigImpresa indica que se pidió --print-config y ya se imprimió.
+var errConfigImpresa = errors.New("configuración impresa")
+
+func parseCmd(name string, args []string, extra func(fs *flag.FlagSet)) (*cmdCtx, error) {
+	c := &cmdCtx{}
+	cfg, printOnly, rest, err := LoadConfig(name, args, func(fs *flag.FlagSet) {
+		fs.BoolVar(&c.json, "json", false, "salida en JSON")
+		if extra != nil {
+			extra(fs)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if printOnly {
+		if err := cfg.Print(os.Stdout); err != nil {
+			return nil, err
+		}
+		return nil, errConfigImpresa
+	}
+	c.cfg, c.args = cfg, rest
+	// los subcomandos cortos no capturan señales: Ctrl-C los termina como siempre
+	c.ctx = context.Background()
+	return c, nil
+}
+
+// cmdExit traduce el error de parseCmd a código de salida.
+func cmdExit(err error) int {
+	switch {
+	case errors.Is(err, flag.ErrHelp), errors.Is(err, errConfigImpresa):
+		return 0
+	default:
+		fmt.Printf("ERROR config: %v\n", err)
+		return 2
+	}
+}
+
+// emit imprime v como JSON o llama a text.
+func (c *cmdCtx) emit(v any, text func()) {
+	if !c.json {
+		text()
+		return
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
+
+// fail reporta el error en el formato pedido y devuelve el código de salida.
+func (c *cmdCtx) fail(what string, err error) int {
+	if c.json {
+		c.emit(map[string]string{"error": fmt.Sprintf("%s: %v", what, err)}, nil)
+	} else {
+		fmt.Printf("ERROR %s: %v\n", what, err)
+	}
+	return 1
+}
+
+func (c *cmdCtx) uso(uso string) int {
+	fmt.Println("uso:", uso)
+	return 2
+}
+
+// ---------- continfo ----------
+
+func runContinfoCmd(args []string) int {
+	c, err := parseCmd("continfo", args, nil)
+	if err != nil {
+		return cmdExit(err)
+	}
+
+	ci, origen, err := NewFuente(c.cfg).ContInfo()
+	if err != nil {
+		return c.fail("continfo ("+origen+")", err)
+	}
+
+	out := struct {
+		Origen       string          `json:"origen"`
+		Count        int             `json:"count"`
+		Contenedores []apiContenedor `json:"contenedores"`
+	}{Origen: origen, Count: ci.Count, Contenedores: []apiContenedor{}}
+	for _, e := range ci.Containers {
+		out.Contenedores = append(out.Contenedores, toAPIContenedor(e))
+	}
+	c.emit(out, func() {
+		if origen != FuenteKernel {
+			fmt.Println("(sin módulo continfo: datos armados desde /proc y cgroup)")
+		}
+		PrintContainerInfo(ci)
+	})
+	return 0
+}
+
+// ---------- policy ----------
+
+func runPolicyCmd(args []string) int {
+	c, err := parseCmd("policy", args, nil)
+	if err != nil {
+		return cmdExit(err)
+	}
+	if len(c.args) != 1 || c.args[0] != "simulate" {
+		return c.uso("policy simulate [--json] [--policy archivo] [--runtime ...]")
+	}
+
+	pol, err := LoadPolicy(c.cfg.PolicyFile)
+	if err != nil {
+		return c.fail("política", err)
+	}
+	rt, err := NewContainerRuntime(c.cfg.Runtime, c.cfg.DockerSocket, c.cfg.DockerTimeout)
+	if err != nil {
+		return c.fail("runtime", err)
+	}
+
+	// continfo es opcional: si no se puede leer se usan las stats del runtime
+	ci, _, _ := NewFuente(c.cfg).ContInfo()
+
+	decisions, err := SimulatePolicy(c.ctx, rt, pol, ci)
+	if err != nil {
+		return c.fail("policy", err)
+	}
+
+	filas := []DecisionFila{}
+	for _, d := range decisions {
+		filas = append(filas, toDecisionFila(0, true, d))
+	}
+	c.emit(filas, func() { PrintDecisionReport(os.Stdout, 0, true, decisions) })
+	return 0
+}
+
+// ---------- generate ----------
+
+// runGenerateCmd corre una ronda del generador (lo que instala el crontab
+// con cron_job generador). --plan solo muestra qué crearía; --seed repite
+// la semilla de una ronda guardada en generador_rondas.
+func runGenerateCmd(args []string) int {
+	var (
+		plan  bool
+		seed  int64
+		ronda int64
+	)
+	c, err := parseCmd("generate", args, func(fs *flag.FlagSet) {
+		fs.BoolVar(&plan, "plan", false, "muestra el plan de la ronda sin crear contenedores")
+		fs.Int64Var(&seed, "seed", 0, "semilla exacta de la ronda (0 = derivada de gen-seed)")
+		fs.Int64Var(&ronda, "ronda", 0, "número de ronda para --plan ({ronda} y labels)")
+	})
+	if err != nil {
+		return cmdExit(err)
+	}
+	if len(c.args) != 0 {
+		return c.uso("generate [--json] [--plan] [--seed N] [--ronda N] [--generator archivo]")
+	}
+
+	gen, err := LoadGenerador(c.cfg.GeneratorFile)
+	if err != nil {
+		return c.fail("generador", err)
+	}
+	semilla := func(r int64) int64 {
+		if seed != 0 {
+			return seed
+		}
+		return semillaRonda(int64(c.cfg.GenSeed), r)
+	}
+
+	if plan {
+		s := semilla(ronda)
+		out := struct {
+			Ronda        int64           `json:"ronda"`
+			Seed         int64           `json:"seed"`
+			Contenedores []GenContenedor `json:"contenedores"`
+		}{ronda, s, gen.Plan(ronda, s)}
+		c.emit(out, func() {
+			fmt.Printf("ronda %d, seed %d\n", out.Ronda, out.Seed)
+			tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "#\tNOMBRE\tCLASE\tIMAGEN\tENV")
+			for _, g := range out.Contenedores {
+				fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n", g.Orden, g.Nombre, g.Clase, g.Imagen, strings.Join(sortedKV(g.Env), " "))
+			}
+			tw.Flush()
+		})
+		return 0
+	}
+
+	rt, err := NewContainerRuntime(c.cfg.Runtime, c.cfg.DockerSocket, c.cfg.DockerTimeout)
+	if err != nil {
+		return c.fail("runtime", err)
+	}
+	if err := InitDB(c.cfg.DBPath); err != nil {
+		return c.fail("DB", err)
+	}
+	defer CloseDB()
+
+	var w io.Writer = os.Stdout
+	if c.json {
+		w = io.Discard
+	}
+	r, err := gen.EjecutarRonda(c.ctx, rt, semilla, w)
+	if r == nil {
+		return c.fail("generate", err)
+	}
+
+	type fila struct {
+		GenContenedor
+		ID    string `json:"id,omitempty"`
+		Error string `json:"error,omitempty"`
+	}
+	creados, fallidos := r.Conteo()
+	out := struct {
+		Ronda        int64     `json:"ronda"`
+		Seed         int64     `json:"seed"`
+		Inicio       time.Time `json:"inicio"`
+		Fin          time.Time `json:"fin"`
+		Creados      int       `json:"creados"`
+		Fallidos     int       `json:"fallidos"`
+		Contenedores []fila    `json:"contenedores"`
+		Error        string    `json:"error,omitempty"`
+	}{Ronda: r.ID, Seed: r.Seed, Inicio: r.Inicio, Fin: r.Fin, Creados: creados, Fallidos: fallidos, Contenedores: []fila{}}
+	for _, res := range r.Resultados {
+		f := fila{GenContenedor: res.GenContenedor, ID: res.ID}
+		if res.Err != nil {
+			f.Error = res.Err.Error()
+		}
+		out.Contenedores = append(out.Contenedores, f)
+	}
+	if err != nil {
+		out.Error = err.Error()
+	}
+	c.emit(out, func() {
+		if err != nil {
+			fmt.Printf("ERROR generate: %v\n", err)
+		}
+	})
+	if err != nil {
+		return 1
+	}
+	return 0
+}
+
+// ---------- db ----------
+
+func runDBCmd(args []string) int {
+	c, err := parseCmd("db", args, nil)
+	if err != nil {
+		return cmdExit(err)
+	}
+	if len(c.args) != 2 || c.args[0] != "query" {
+		return c.uso(`db query [--json] "SELECT ..."`)
+	}
+
+	cols, filas, err := ConsultaSoloLectura(c.cfg.DBPath, c.args[1])
+	if err != nil {
+		return c.fail("query", err)
+	}
+
+	objs := make([]map[string]any, 0, len(filas))
+	for _, f := range filas {
+		o := make(map[string]any, len(cols))
+		for i, col := range cols {
+			o[col] = f[i]
+		}
+		objs = append(objs, o)
+	}
+	c.emit(objs, func() {
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.Join(cols, "\t"))
+		for _, f := range filas {
+			vals := make([]string, len(f))
+			for i, v := range f {
+				if v == nil {
+					vals[i] = "NULL"
+				} else {
+					vals[i] = fmt.Sprint(v)
+				}
+			}
+			fmt.Fprintln(tw, strings.Join(vals, "\t"))
+		}
+		_ = tw.Flush()
+		fmt.Printf("(%d filas)\n", len(filas))
+	})
+	return 0
+}
+
+// ---------- modules ----------
+
+type moduloEstado struct {
+	Nombre string   `json:"nombre"`
+	KoPath string   `json:"ko_path"`
+	Params []string `json:"params"`
+	Proc   string   `json:"proc"`
+	ModuleStatus
+	Error string `json:"error,omitempty"`
+	Paso  string `json:"paso,omitempty"` // ModuleError.Paso
+}
+
+func runModulesCmd(args []string) int {
+	c, err := parseCmd("modules", args, nil)
+	if err != nil {
+		return cmdExit(err)
+	}
+	if len(c.args) != 1 {
+		return c.uso("modules load|unload|status [--json]")
+	}
+
+	mods := moduleManagers(c.cfg)
+
+	var failed bool
+	errs := map[string]error{}
+	switch c.args[0] {
+	case "load":
+		for _, m := range mods {
+			if err := m.Load(c.ctx); err != nil {
+				errs[m.ModuleName], failed = err, true
+			}
+		}
+	case "unload":
+		for i := len(mods) - 1; i >= 0; i-- {
+			if err := mods[i].Unload(c.ctx); err != nil {
+				errs[mods[i].ModuleName], failed = err, true
+			}
+		}
+	case "status":
+	default:
+		return c.uso("modules load|unload|status [--json]")
+	}
+
+	estados := make([]moduloEstado, 0, len(mods))
+	for _, m := range mods {
+		e := moduloEstado{Nombre: m.ModuleName, KoPath: m.KoPath, Params: m.Params, Proc: m.ProcPath}
+		if e.Params == nil {
+			e.Params = []string{}
+		}
+		st, err := m.Status()
+		e.ModuleStatus = st
+		if err != nil && errs[m.ModuleName] == nil {
+			errs[m.ModuleName], failed = err, true
+		}
+		if err := errs[m.ModuleName]; err != nil {
+			e.Error = err.Error()
+			var me *ModuleError
+			if errors.As(err, &me) {
+				e.Paso = me.Paso
+			}
+		}
+		estados = append(estados, e)
+	}
+
+	c.emit(estados, func() {
+		for _, e := range estados {
+			estado := "no cargado"
+			if e.Cargado {
+				estado = fmt.Sprintf("%s usos=%d", e.Estado, e.Usos)
+			}
+			fmt.Printf("%-9s %-16s proc_ok=%-5t ko=%s (existe=%t)\n",
+				e.Nombre, estado, e.ProcOK, e.KoPath, e.KoExiste)
+			if e.KoExiste {
+				fmt.Printf("          vermagic=%q kernel=%s ok=%t\n", vermagicRelease(e.Vermagic), e.Kernel, e.VermagicOK)
+			}
+			if len(e.Params) > 0 {
+				fmt.Printf("          params=%s\n", strings.Join(e.Params, " "))
+			}
+			if e.Error != "" {
+				fmt.Printf("  ERROR: %s\n", e.Error)
+			}
+		}
+	})
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+// ---------- cron ----------
+
+func runCronCmd(args []string) int {
+	c, err := parseCmd("cron", args, nil)
+	if err != nil {
+		return cmdExit(err)
+	}
+	if len(c.args) != 1 {
+		return c.uso("cron install|remove|status [--json]")
+	}
+
+	// install/remove siempre trabajan sobre el crontab; con cron_mode
+	// internal el daemon no lo usa, pero se puede limpiar a mano
+	cron := cronManager(c.cfg)
+	switch c.args[0] {
+	case "install":
+		err = cron.Install(c.ctx)
+	case "remove":
+		err = cron.Remove(c.ctx)
+	case "status":
+	default:
+		return c.uso("cron install|remove|status [--json]")
+	}
+	if err != nil {
+		return c.fail("cron "+c.args[0], err)
+	}
+
+	linea, err := cron.Installed(c.ctx)
+	if err != nil {
+		return c.fail("cron", err)
+	}
+	expr, err := ParseCron(c.cfg.CronSchedule)
+	if err != nil {
+		return c.fail("cron", err)
+	}
+	out := struct {
+		Modo      string      `json:"modo"`
+		Job       string      `json:"job"`
+		Schedule  string      `json:"schedule"`
+		Proximas  []time.Time `json:"proximas"`
+		Instalado bool        `json:"instalado"`
+		Comando   string      `json:"comando"`
+		Log       string      `json:"log"`
+		Linea     string      `json:"linea,omitempty"`
+		Interno   *CronEstado `json:"interno,omitempty"`
+		ErrorAPI  string      `json:"error_api,omitempty"`
+	}{
+		Modo: c.cfg.CronMode, Job: c.cfg.CronJob, Schedule: expr.String(),
+		Instalado: linea != "", Comando: cron.Comando, Log: cron.LogPath, Linea: linea,
+	}
+	for t := time.Now(); len(out.Proximas) < 3; {
+		if t = expr.Next(t); t.IsZero() {
+			break
+		}
+		out.Proximas = append(out.Proximas, t)
+	}
+	if c.cfg.CronMode == CronInternal {
+		out.Interno, err = cronInterno(c.ctx, c.cfg.HTTPAddr)
+		if err != nil {
+			out.ErrorAPI = err.Error()
+		}
+	}
+
+	c.emit(out, func() {
+		fmt.Printf("modo %s, job %s, schedule %q\n", out.Modo, out.Job, out.Schedule)
+		for _, t := range out.Proximas {
+			fmt.Printf("  próxima: %s\n", t.Format("2006-01-02 15:04"))
+		}
+		if out.Instalado {
+			fmt.Printf("bloque en el crontab: %s\n", linea)
+		} else {
+			fmt.Println("sin bloque en el crontab")
+		}
+		switch {
+		case out.Interno != nil:
+			e := out.Interno
+			fmt.Printf("scheduler interno: %d ejecuciones (%d fallidas, %d saltadas), corriendo=%v\n",
+				e.Ejecuciones, e.Fallidas, e.Saltadas, e.Corriendo)
+			if e.UltimoInicio != nil {
+				fmt.Printf("  última: %s (%s)\n", e.UltimoInicio.Format(time.DateTime), e.UltimaDuracion)
+			}
+			if e.UltimoError != "" {
+				fmt.Printf("  último error: %s\n", e.UltimoError)
+			}
+		case out.ErrorAPI != "":
+			fmt.Printf("scheduler interno: sin datos (%s)\n", out.ErrorAPI)
+		}
+	})
+	return 0
+}
+
+// cronInterno consulta /api/cron del daemon que está corriendo.
+func cronInterno(ctx context.Context, addr string) (*CronEstado, error) {
+	if addr == "" {
+		return nil, errors.New("http_addr vacío, la API está desactivada")
+	}
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+addr+"/api/cron", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("¿daemon corriendo? %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Error string `json:"error"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&e)
+		return nil, fmt.Errorf("/api/cron: %s %s", resp.Status, e.Error)
+	}
+	var st CronEstado
+	if err := json.NewDecoder(resp.Body).Decode(&st); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
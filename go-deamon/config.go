@@ -0,0 +1,449 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config reúne todo lo que antes estaba fijo en el código.
+// Prioridad: valores por defecto < archivo (--config / SO1_CONFIG) < variables SO1_* < flags.
+type Config struct {
+	SysinfoProc  string `yaml:"sysinfo_proc"`
+	ContinfoProc string `yaml:"continfo_proc"`
+	SysinfoKo    string `yaml:"sysinfo_ko"`
+	ContinfoKo   string `yaml:"continfo_ko"`
+	// Parámetros de insmod separados por espacio ("nombre=valor ...")
+	SysinfoParams  string `yaml:"sysinfo_params"`
+	ContinfoParams string `yaml:"continfo_params"`
+	// Cuánto esperar a que el módulo cree su entrada en /proc
+	ModuleWait time.Duration `yaml:"module_wait"`
+
+	// kernel | proc | auto: de dónde salen SysInfo y ContInfo (ver fuente.go)
+	Collector  string `yaml:"collector"`
+	ProcRoot   string `yaml:"proc_root"`
+	CgroupRoot string `yaml:"cgroup_root"`
+
+	CronScript string `yaml:"cron_script"`
+	CronLog    string `yaml:"cron_log"`
+	// crontab | internal | off, y la expresión de cron del job
+	CronMode     string `yaml:"cron_mode"`
+	CronSchedule string `yaml:"cron_schedule"`
+	// Qué corre el job: generador (en Go, ver generador.go) | script (cron_script)
+	CronJob string `yaml:"cron_job"`
+
+	// Mezcla de imágenes del generador (vacío = la del script original) y
+	// semilla base (0 = aleatoria en cada ronda)
+	GeneratorFile string `yaml:"generator_file"`
+	GenSeed       int    `yaml:"gen_seed"`
+
+	DBPath    string        `yaml:"db_path"`
+	LoopEvery time.Duration `yaml:"loop_every"`
+	// Cada colector tiene su intervalo (0 = loop_every) y un jitter máximo
+	// (±) para no muestrear siempre en fase; los que vencen juntos van al
+	// mismo lote
+	ProcesosEvery      time.Duration `yaml:"procesos_every"`
+	ProcesosJitter     time.Duration `yaml:"procesos_jitter"`
+	ContenedoresEvery  time.Duration `yaml:"contenedores_every"`
+	ContenedoresJitter time.Duration `yaml:"contenedores_jitter"`
+	CPUEvery           time.Duration `yaml:"cpu_every"`
+	CPUJitter          time.Duration `yaml:"cpu_jitter"`
+	// La política corre en su propio ticker, separada de la recolección
+	PolicyEvery  time.Duration `yaml:"policy_every"`
+	PolicyJitter time.Duration `yaml:"policy_jitter"`
+	// Muestras que pueden esperar al writer antes de empezar a descartar
+	PipelineBuffer int `yaml:"pipeline_buffer"`
+
+	// Unidades por segundo de utime/stime/CPU_Jiffies que reportan los módulos
+	// (task->utime está en nanosegundos en kernels modernos)
+	CPUTimeHz int `yaml:"cpu_time_hz"`
+
+	Runtime      string `yaml:"runtime"`
+	DockerSocket string `yaml:"docker_socket"`
+	// Deadline de cada llamada a docker/podman (0 = sin límite)
+	DockerTimeout time.Duration `yaml:"docker_timeout"`
+	PolicyFile    string        `yaml:"policy_file"`
+	DryRun        bool          `yaml:"dry_run"`
+	Explain       bool          `yaml:"explain"`
+
+	// API HTTP del daemon; vacío = desactivada
+	HTTPAddr string `yaml:"http_addr"`
+
+	RetentionMaxAge     time.Duration `yaml:"retention_max_age"`
+	RetentionMaxLotes   int           `yaml:"retention_max_lotes"`
+	RetentionEvery      time.Duration `yaml:"retention_every"`
+	RetentionBatch      int           `yaml:"retention_batch"`
+	RetentionArchiveDir string        `yaml:"retention_archive_dir"`
+
+	// Tiempo máximo de cada paso del cierre ordenado (API, cron, módulos, ...)
+	ShutdownStepTimeout time.Duration `yaml:"shutdown_step_timeout"`
+
+	// Reset borra todo el historial al arrancar; solo por flag, nunca desde archivo
+	Reset bool `yaml:"-"`
+	// Archivo del que salió la configuración (--config), para el crontab
+	ConfigPath string `yaml:"-"`
+}
+
+// Rutas relativas a go-deamon/, igual que la DB original
+func DefaultConfig() Config {
+	return Config{
+		SysinfoProc:    "/proc/sysinfo_so1_202300644",
+		ContinfoProc:   "/proc/continfo_so1_202300644",
+		SysinfoKo:      "../modulo-kernel/sysinfo/sysinfo.ko",
+		ContinfoKo:     "../modulo-kernel/continfo/continfo.ko",
+		ModuleWait:     5 * time.Second,
+		Collector:      FuenteAuto,
+		ProcRoot:       "/proc",
+		CgroupRoot:     "/sys/fs/cgroup",
+		CronScript:     "../bash/crear_contenedores.sh",
+		CronLog:        "../bash/crear_contenedores.log",
+		CronMode:       CronCrontab,
+		CronSchedule:   "* * * * *",
+		CronJob:        CronJobGenerador,
+		DBPath:         "../dashboard/data/metrics.db",
+		LoopEvery:      20 * time.Second,
+		PolicyEvery:    20 * time.Second,
+		PipelineBuffer: 4,
+		CPUTimeHz:      1000000000,
+		Runtime:        "docker",
+		HTTPAddr:       "127.0.0.1:8090",
+
+		DockerTimeout:       30 * time.Second,
+		ShutdownStepTimeout: 10 * time.Second,
+
+		RetentionMaxAge: 7 * 24 * time.Hour,
+		RetentionEvery:  time.Minute,
+		RetentionBatch:  200,
+	}
+}
+
+// configVar enlaza un campo con su variable de entorno y su flag.
+type configVar struct {
+	key   string
+	env   string
+	usage string
+	str   *string
+	dur   *time.Duration
+	boolV *bool
+	intV  *int
+}
+
+func (c *Config) vars() []configVar {
+	return []configVar{
+		{key: "sysinfo-proc", env: "SO1_SYSINFO_PROC", usage: "archivo /proc del módulo sysinfo", str: &c.SysinfoProc},
+		{key: "continfo-proc", env: "SO1_CONTINFO_PROC", usage: "archivo /proc del módulo continfo", str: &c.ContinfoProc},
+		{key: "sysinfo-ko", env: "SO1_SYSINFO_KO", usage: "ruta de sysinfo.ko", str: &c.SysinfoKo},
+		{key: "continfo-ko", env: "SO1_CONTINFO_KO", usage: "ruta de continfo.ko", str: &c.ContinfoKo},
+		{key: "sysinfo-params", env: "SO1_SYSINFO_PARAMS", usage: "parámetros de insmod para sysinfo (nombre=valor ...)", str: &c.SysinfoParams},
+		{key: "continfo-params", env: "SO1_CONTINFO_PARAMS", usage: "parámetros de insmod para continfo (nombre=valor ...)", str: &c.ContinfoParams},
+		{key: "module-wait", env: "SO1_MODULE_WAIT", usage: "espera máxima a que aparezca la entrada /proc del módulo", dur: &c.ModuleWait},
+		{key: "collector", env: "SO1_COLLECTOR", usage: "origen de los datos: kernel (módulos) | proc (userspace) | auto", str: &c.Collector},
+		{key: "proc-root", env: "SO1_PROC_ROOT", usage: "raíz de /proc para el colector userspace", str: &c.ProcRoot},
+		{key: "cgroup-root", env: "SO1_CGROUP_ROOT", usage: "raíz del cgroup v2 para el colector userspace", str: &c.CgroupRoot},
+		{key: "cron-script", env: "SO1_CRON_SCRIPT", usage: "script que instala el cronjob", str: &c.CronScript},
+		{key: "cron-log", env: "SO1_CRON_LOG", usage: "log del cronjob", str: &c.CronLog},
+		{key: "cron-mode", env: "SO1_CRON_MODE", usage: "crontab (crontab del usuario) | internal (scheduler del daemon) | off", str: &c.CronMode},
+		{key: "cron-schedule", env: "SO1_CRON_SCHEDULE", usage: "expresión de cron del generador (ej. \"*/5 * * * *\", @hourly)", str: &c.CronSchedule},
+		{key: "cron-job", env: "SO1_CRON_JOB", usage: "job del cron: generador (en Go) | script (cron-script)", str: &c.CronJob},
+		{key: "generator", env: "SO1_GENERATOR_FILE", usage: "archivo YAML del generador de contenedores (vacío = por defecto)", str: &c.GeneratorFile},
+		{key: "gen-seed", env: "SO1_GEN_SEED", usage: "semilla base del generador (0 = aleatoria)", intV: &c.GenSeed},
+		{key: "db", env: "SO1_DB_PATH", usage: "ruta de metrics.db", str: &c.DBPath},
+		{key: "loop-every", env: "SO1_LOOP_EVERY", usage: "intervalo de recolección de muestras (ej. 20s)", dur: &c.LoopEvery},
+		{key: "procesos-every", env: "SO1_PROCESOS_EVERY", usage: "intervalo del colector de procesos (0 = loop-every)", dur: &c.ProcesosEvery},
+		{key: "procesos-jitter", env: "SO1_PROCESOS_JITTER", usage: "jitter máximo (±) del colector de procesos", dur: &c.ProcesosJitter},
+		{key: "contenedores-every", env: "SO1_CONTENEDORES_EVERY", usage: "intervalo del colector de contenedores (0 = loop-every)", dur: &c.ContenedoresEvery},
+		{key: "contenedores-jitter", env: "SO1_CONTENEDORES_JITTER", usage: "jitter máximo (±) del colector de contenedores", dur: &c.ContenedoresJitter},
+		{key: "cpu-every", env: "SO1_CPU_EVERY", usage: "intervalo del colector de CPU del host (0 = loop-every)", dur: &c.CPUEvery},
+		{key: "cpu-jitter", env: "SO1_CPU_JITTER", usage: "jitter máximo (±) del colector de CPU del host", dur: &c.CPUJitter},
+		{key: "policy-every", env: "SO1_POLICY_EVERY", usage: "intervalo de la política de contenedores (0 = loop-every)", dur: &c.PolicyEvery},
+		{key: "policy-jitter", env: "SO1_POLICY_JITTER", usage: "jitter máximo (±) de la política", dur: &c.PolicyJitter},
+		{key: "pipeline-buffer", env: "SO1_PIPELINE_BUFFER", usage: "muestras en cola hacia el writer antes de descartar", intV: &c.PipelineBuffer},
+		{key: "cpu-time-hz", env: "SO1_CPU_TIME_HZ", usage: "unidades por segundo de utime/stime de los módulos", intV: &c.CPUTimeHz},
+		{key: "runtime", env: "SO1_RUNTIME", usage: "runtime de contenedores: docker | podman | docker-api | fake", str: &c.Runtime},
+		{key: "docker-socket", env: "SO1_DOCKER_SOCKET", usage: "socket unix para runtime docker-api", str: &c.DockerSocket},
+		{key: "docker-timeout", env: "SO1_DOCKER_TIMEOUT", usage: "deadline de cada llamada a docker/podman (0 = sin límite)", dur: &c.DockerTimeout},
+		{key: "policy", env: "SO1_POLICY_FILE", usage: "archivo YAML/JSON de la política (vacío = por defecto)", str: &c.PolicyFile},
+		{key: "dry-run", env: "SO1_DRY_RUN", usage: "calcula la política y reporta decisiones sin detener ni borrar contenedores", boolV: &c.DryRun},
+		{key: "explain", env: "SO1_EXPLAIN", usage: "imprime el reporte de decisiones de la política en cada lote", boolV: &c.Explain},
+		{key: "http-addr", env: "SO1_HTTP_ADDR", usage: "dirección de la API HTTP (vacío = desactivada)", str: &c.HTTPAddr},
+		{key: "retention-max-age", env: "SO1_RETENTION_MAX_AGE", usage: "poda lotes más viejos que esto (0 = sin límite de edad)", dur: &c.RetentionMaxAge},
+		{key: "retention-max-lotes", env: "SO1_RETENTION_MAX_LOTES", usage: "conserva solo los últimos N lotes (0 = sin límite)", intV: &c.RetentionMaxLotes},
+		{key: "retention-every", env: "SO1_RETENTION_EVERY", usage: "cada cuánto corre la poda", dur: &c.RetentionEvery},
+		{key: "retention-batch", env: "SO1_RETENTION_BATCH", usage: "lotes borrados por transacción", intV: &c.RetentionBatch},
+		{key: "retention-archive-dir", env: "SO1_RETENTION_ARCHIVE_DIR", usage: "si se define, archiva los lotes podados en .jsonl.gz", str: &c.RetentionArchiveDir},
+		{key: "shutdown-step-timeout", env: "SO1_SHUTDOWN_STEP_TIMEOUT", usage: "tiempo máximo de cada paso del cierre", dur: &c.ShutdownStepTimeout},
+	}
+}
+
+// LoadConfig arma la configuración efectiva a partir de los argumentos.
+// extra registra los flags propios del subcomando (puede ser nil); los
+// argumentos posicionales vuelven en rest, en orden, aunque estén mezclados
+// con los flags. printOnly indica que se pidió --print-config.
+func LoadConfig(name string, args []string, extra func(fs *flag.FlagSet)) (cfg *Config, printOnly bool, rest []string, err error) {
+	c := DefaultConfig()
+
+	// Los flags se parsean sobre una copia para poder aplicarlos al final
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	configPath := fs.String("config", os.Getenv("SO1_CONFIG"), "archivo YAML de configuración (o SO1_CONFIG)")
+	fs.BoolVar(&printOnly, "print-config", false, "imprime la configuración efectiva y termina")
+	reset := fs.Bool("reset", false, "borra todo el historial de la DB al arrancar")
+
+	fromFlags := DefaultConfig()
+	for _, v := range fromFlags.vars() {
+		switch {
+		case v.str != nil:
+			fs.StringVar(v.str, v.key, *v.str, v.usage+" ("+v.env+")")
+		case v.dur != nil:
+			fs.DurationVar(v.dur, v.key, *v.dur, v.usage+" ("+v.env+")")
+		case v.boolV != nil:
+			fs.BoolVar(v.boolV, v.key, *v.boolV, v.usage+" ("+v.env+")")
+		case v.intV != nil:
+			fs.IntVar(v.intV, v.key, *v.intV, v.usage+" ("+v.env+")")
+		}
+	}
+	if extra != nil {
+		extra(fs)
+	}
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, false, nil, err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		// "--" corta el parseo: todo lo que sigue es posicional
+		if i := len(args) - fs.NArg() - 1; i >= 0 && args[i] == "--" {
+			rest = append(rest, fs.Args()...)
+			break
+		}
+		rest = append(rest, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+
+	// 1) archivo
+	if *configPath != "" {
+		raw, err := os.ReadFile(*configPath)
+		if err != nil {
+			return nil, false, nil, fmt.Errorf("no se pudo leer la configuración %s: %w", *configPath, err)
+		}
+		dec := yaml.NewDecoder(bytes.NewReader(raw))
+		dec.KnownFields(true)
+		if err := dec.Decode(&c); err != nil && !errors.Is(err, io.EOF) {
+			return nil, false, nil, fmt.Errorf("configuración %s inválida: %w", *configPath, err)
+		}
+	}
+
+	// 2) variables de entorno. Definida y vacía cuenta en las de texto
+	// (SO1_HTTP_ADDR= desactiva la API); en las demás se ignora
+	dst := c.vars()
+	for i, v := range dst {
+		val, ok := os.LookupEnv(v.env)
+		if !ok || (val == "" && v.str == nil) {
+			continue
+		}
+		if err := dst[i].set(val); err != nil {
+			return nil, false, nil, fmt.Errorf("%s: %w", v.env, err)
+		}
+	}
+
+	// 3) flags explícitos
+	src := fromFlags.vars()
+	byKey := map[string]int{}
+	for i, v := range dst {
+		byKey[v.key] = i
+	}
+	fs.Visit(func(f *flag.Flag) {
+		if i, ok := byKey[f.Name]; ok {
+			dst[i].copyFrom(src[i])
+		}
+	})
+
+	c.Reset = *reset
+	c.ConfigPath = *configPath
+
+	if err := c.validate(); err != nil {
+		return nil, false, nil, err
+	}
+	return &c, printOnly, rest, nil
+}
+
+func (v configVar) set(s string) error {
+	switch {
+	case v.str != nil:
+		*v.str = s
+	case v.dur != nil:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		*v.dur = d
+	case v.boolV != nil:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		*v.boolV = b
+	case v.intV != nil:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return err
+		}
+		*v.intV = n
+	}
+	return nil
+}
+
+func (v configVar) copyFrom(o configVar) {
+	switch {
+	case v.str != nil:
+		*v.str = *o.str
+	case v.dur != nil:
+		*v.dur = *o.dur
+	case v.boolV != nil:
+		*v.boolV = *o.boolV
+	case v.intV != nil:
+		*v.intV = *o.intV
+	}
+}
+
+func (c *Config) validate() error {
+	var errs []error
+	if c.LoopEvery <= 0 {
+		errs = append(errs, fmt.Errorf("loop_every debe ser > 0 (%s)", c.LoopEvery))
+	}
+	for _, s := range []struct {
+		nombre        string
+		every, jitter time.Duration
+	}{
+		{"procesos", c.ProcesosEvery, c.ProcesosJitter},
+		{"contenedores", c.ContenedoresEvery, c.ContenedoresJitter},
+		{"cpu", c.CPUEvery, c.CPUJitter},
+		{"policy", c.PolicyEvery, c.PolicyJitter},
+	} {
+		if s.every < 0 {
+			errs = append(errs, fmt.Errorf("%s_every no puede ser negativo (%s)", s.nombre, s.every))
+			continue
+		}
+		if s.every == 0 {
+			s.every = c.LoopEvery
+		}
+		if s.jitter < 0 || (s.every > 0 && s.jitter >= s.every) {
+			errs = append(errs, fmt.Errorf("%s_jitter debe estar entre 0 y %s_every (%s)", s.nombre, s.nombre, s.jitter))
+		}
+	}
+	if c.PipelineBuffer <= 0 {
+		errs = append(errs, fmt.Errorf("pipeline_buffer debe ser > 0 (%d)", c.PipelineBuffer))
+	}
+	switch c.CronMode {
+	case CronCrontab, CronInternal, CronOff:
+	default:
+		errs = append(errs, fmt.Errorf("cron_mode debe ser crontab, internal u off (%q)", c.CronMode))
+	}
+	if _, err := ParseCron(c.CronSchedule); err != nil {
+		errs = append(errs, err)
+	}
+	if c.CronJob != CronJobGenerador && c.CronJob != CronJobScript {
+		errs = append(errs, fmt.Errorf("cron_job debe ser generador o script (%q)", c.CronJob))
+	}
+	switch c.Collector {
+	case FuenteKernel, FuenteProc, FuenteAuto:
+	default:
+		errs = append(errs, fmt.Errorf("collector debe ser kernel, proc o auto (%q)", c.Collector))
+	}
+	if c.CPUTimeHz <= 0 {
+		errs = append(errs, fmt.Errorf("cpu_time_hz debe ser > 0 (%d)", c.CPUTimeHz))
+	}
+	if c.RetentionMaxAge < 0 || c.RetentionMaxLotes < 0 {
+		errs = append(errs, errors.New("retention_max_age y retention_max_lotes no pueden ser negativos"))
+	}
+	if c.RetentionEvery <= 0 || c.RetentionBatch <= 0 {
+		errs = append(errs, errors.New("retention_every y retention_batch deben ser > 0"))
+	}
+	if c.DockerTimeout < 0 {
+		errs = append(errs, fmt.Errorf("docker_timeout no puede ser negativo (%s)", c.DockerTimeout))
+	}
+	if c.ModuleWait <= 0 {
+		errs = append(errs, fmt.Errorf("module_wait debe ser > 0 (%s)", c.ModuleWait))
+	}
+	if c.ShutdownStepTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("shutdown_step_timeout debe ser > 0 (%s)", c.ShutdownStepTimeout))
+	}
+	for _, v := range c.vars() {
+		optional := v.key == "docker-socket" || v.key == "policy" || v.key == "retention-archive-dir" || v.key == "http-addr" ||
+			v.key == "sysinfo-params" || v.key == "continfo-params" || v.key == "generator"
+		if v.str != nil && *v.str == "" && !optional {
+			errs = append(errs, fmt.Errorf("%s no puede estar vacío", v.key))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("configuración inválida: %w", errors.Join(errs...))
+	}
+
+	// cron y sudo insmod no saben de nuestro directorio de trabajo
+	for _, p := range []*string{&c.SysinfoKo, &c.ContinfoKo, &c.CronScript, &c.CronLog, &c.DBPath, &c.RetentionArchiveDir, &c.GeneratorFile, &c.ConfigPath} {
+		if *p == "" {
+			continue
+		}
+		if abs, err := filepath.Abs(*p); err == nil {
+			*p = abs
+		}
+	}
+	return nil
+}
+
+// Print escribe la configuración efectiva en YAML (sirve como archivo base).
+func (c *Config) Print(w io.Writer) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(c); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// Schedule es el intervalo efectivo y el jitter de un colector o de la política.
+type Schedule struct {
+	Every  time.Duration
+	Jitter time.Duration
+}
+
+func (c *Config) schedule(every, jitter time.Duration) Schedule {
+	if every == 0 {
+		every = c.LoopEvery
+	}
+	return Schedule{Every: every, Jitter: jitter}
+}
+
+func (c *Config) ProcesosSchedule() Schedule {
+	return c.schedule(c.ProcesosEvery, c.ProcesosJitter)
+}
+
+func (c *Config) ContenedoresSchedule() Schedule {
+	return c.schedule(c.ContenedoresEvery, c.ContenedoresJitter)
+}
+
+func (c *Config) CPUSchedule() Schedule {
+	return c.schedule(c.CPUEvery, c.CPUJitter)
+}
+
+func (c *Config) PolicySchedule() Schedule {
+	return c.schedule(c.PolicyEvery, c.PolicyJitter)
+}
+
+func (c *Config) Retention() Retention {
+	return Retention{
+		MaxAge:     c.RetentionMaxAge,
+		MaxLotes:   c.RetentionMaxLotes,
+		Every:      c.RetentionEvery,
+		Batch:      c.RetentionBatch,
+		ArchiveDir: c.RetentionArchiveDir,
+	}
+}
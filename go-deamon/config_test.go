@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadConfigPrecedencia(t *testing.T) {
+	dir := t.TempDir()
+	archivo := filepath.Join(dir, "so1.yaml")
+	err := os.WriteFile(archivo, []byte(`
+loop_every: 30s
+db_path: archivo.db
+http_addr: 127.0.0.1:9000
+runtime: podman
+retention_batch: 50
+`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SO1_CONFIG", archivo)
+	t.Setenv("SO1_DB_PATH", filepath.Join(dir, "env.db"))
+	t.Setenv("SO1_RETENTION_BATCH", "70")
+	// vacía en una de texto desactiva; en una duración no cuenta
+	t.Setenv("SO1_HTTP_ADDR", "")
+	t.Setenv("SO1_LOOP_EVERY", "")
+
+	cfg, _, _, err := LoadConfig("daemon", []string{"--retention-batch=90"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	def := DefaultConfig()
+	cases := []struct {
+		name      string
+		got, want any
+	}{
+		{"default", cfg.ShutdownStepTimeout, def.ShutdownStepTimeout},
+		{"archivo sobre default", cfg.Runtime, "podman"},
+		{"env vacía de duración no pisa el archivo", cfg.LoopEvery, 30 * time.Second},
+		{"env sobre archivo", cfg.DBPath, filepath.Join(dir, "env.db")},
+		{"env vacía de texto sobre archivo", cfg.HTTPAddr, ""},
+		{"flag sobre env", cfg.RetentionBatch, 90},
+	}
+	for _, tc := range cases {
+		if tc.got != tc.want {
+			t.Errorf("%s: %v, se esperaba %v", tc.name, tc.got, tc.want)
+		}
+	}
+}
+
+func TestLoadConfigFlagVacioSobreEnv(t *testing.T) {
+	t.Setenv("SO1_CONFIG", "")
+	t.Setenv("SO1_HTTP_ADDR", "0.0.0.0:8090")
+
+	cfg, _, _, err := LoadConfig("daemon", []string{"--http-addr="}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.HTTPAddr != "" {
+		t.Errorf("http_addr %q, se esperaba vacío por el flag", cfg.HTTPAddr)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ProcCPUTracker calcula el CPU% de cada proceso en el intervalo entre dos
+// lotes a partir del delta de UTime+STime. CPU_Usage del módulo es tiempo de
+// CPU de toda la vida del proceso, así que no sirve para "quién usa CPU ahora".
+type ProcCPUTracker struct {
+	// unidades de utime/stime por segundo (task->utime está en ns)
+	hz float64
+	// raíz de /proc para leer starttime (config proc_root)
+	procRoot string
+	prev     map[int]procSample
+}
+
+type procSample struct {
+	start uint64 // starttime de /proc/[pid]/stat, detecta reuso de PID
+	name  string
+	total uint64
+	at    time.Time
+}
+
+func NewProcCPUTracker(hz int, procRoot string) *ProcCPUTracker {
+	if procRoot == "" {
+		procRoot = "/proc"
+	}
+	return &ProcCPUTracker{hz: float64(hz), procRoot: procRoot, prev: map[int]procSample{}}
+}
+
+// Update llena CPUPercent de cada proceso. En la primera muestra de un PID
+// (o si el PID se reutilizó) no hay intervalo y CPUPercentOK queda en false.
+func (t *ProcCPUTracker) Update(procs []Process, now time.Time) {
+	next := make(map[int]procSample, len(procs))
+
+	for i := range procs {
+		p := &procs[i]
+		cur := procSample{
+			start: readProcStartTime(t.procRoot, p.PID),
+			name:  p.Name,
+			total: p.UTime + p.STime,
+			at:    now,
+		}
+		next[p.PID] = cur
+
+		p.CPUPercent, p.CPUPercentOK = 0, false
+		old, ok := t.prev[p.PID]
+		if !ok || !samePIDOwner(old, cur) || cur.total < old.total {
+			continue
+		}
+
+		elapsed := cur.at.Sub(old.at).Seconds()
+		if elapsed <= 0 || t.hz <= 0 {
+			continue
+		}
+		// % de un CPU, igual que top (un proceso multihilo puede pasar de 100)
+		p.CPUPercent = float64(cur.total-old.total) / t.hz / elapsed * 100.0
+		p.CPUPercentOK = true
+	}
+
+	// los PIDs que ya no existen se descartan
+	t.prev = next
+}
+
+func samePIDOwner(a, b procSample) bool {
+	if a.start != 0 && b.start != 0 {
+		return a.start == b.start
+	}
+	return a.name == b.name
+}
+
+// readProcStartTime devuelve el campo 22 (starttime) de <procRoot>/[pid]/stat o 0.
+func readProcStartTime(procRoot string, pid int) uint64 {
+	b, err := os.ReadFile(filepath.Join(procRoot, strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return 0
+	}
+	// comm va entre paréntesis y puede tener espacios: cortar después del último ')'
+	s := string(b)
+	i := strings.LastIndexByte(s, ')')
+	if i < 0 {
+		return 0
+	}
+	f := strings.Fields(s[i+1:])
+	// f[0] es el campo 3 (state), starttime es el 22
+	if len(f) < 20 {
+		return 0
+	}
+	v, err := strconv.ParseUint(f[19], 10, 64)
+	if err != nil {
+		return 0
+	}
+	return v
+}
+
+// ContCPUTracker hace lo mismo para CPU_Jiffies de continfo (acumulado por
+// contenedor). Si el acumulado baja (salió un proceso del contenedor o se
+// recreó con el mismo ID) se toma como reinicio y se espera otra muestra.
+type ContCPUTracker struct {
+	hz   float64
+	prev map[string]contSample
+}
+
+type contSample struct {
+	total uint64
+	at    time.Time
+}
+
+func NewContCPUTracker(hz int) *ContCPUTracker {
+	return &ContCPUTracker{hz: float64(hz), prev: map[string]contSample{}}
+}
+
+func (t *ContCPUTracker) Update(ci *ContInfo, now time.Time) {
+	if ci == nil {
+		return
+	}
+	next := make(map[string]contSample, len(ci.Containers))
+
+	for i := range ci.Containers {
+		c := &ci.Containers[i]
+		cur := contSample{total: c.CPUJiffies, at: now}
+		next[c.ContainerID] = cur
+
+		c.CPUPercent, c.CPUPercentOK = 0, false
+		old, ok := t.prev[c.ContainerID]
+		if !ok || cur.total < old.total {
+			continue
+		}
+
+		elapsed := cur.at.Sub(old.at).Seconds()
+		if elapsed <= 0 || t.hz <= 0 {
+			continue
+		}
+		c.CPUPercent = float64(cur.total-old.total) / t.hz / elapsed * 100.0
+		c.CPUPercentOK = true
+	}
+
+	t.prev = next
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CronExpr es una expresión de cron de 5 campos (minuto hora día mes
+// día-de-semana) con la sintaxis de vixie cron: *, listas, rangos, pasos
+// (*/5, 1-30/2), nombres (jan, mon) y los atajos @hourly, @daily, ...
+type CronExpr struct {
+	Texto string
+
+	min, hora, dom, mes, dow uint64 // bit i = valor i permitido
+	domTodos, dowTodos       bool   // campo "*": cuenta para la regla día/semana
+}
+
+var cronAtajos = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var cronMeses = map[string]int{"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12}
+
+var cronDias = map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}
+
+func ParseCron(s string) (*CronExpr, error) {
+	texto := strings.TrimSpace(s)
+	campos := strings.Fields(texto)
+	if len(campos) == 1 && strings.HasPrefix(campos[0], "@") {
+		exp, ok := cronAtajos[campos[0]]
+		if !ok {
+			return nil, fmt.Errorf("cron %q: atajo no soportado", s)
+		}
+		campos = strings.Fields(exp)
+	}
+	if len(campos) != 5 {
+		return nil, fmt.Errorf("cron %q: se esperan 5 campos (minuto hora día mes día-semana)", s)
+	}
+
+	e := &CronExpr{Texto: texto}
+	var err error
+	if e.min, _, err = parseCampoCron(campos[0], 0, 59, nil); err != nil {
+		return nil, fmt.Errorf("cron %q: minuto: %w", s, err)
+	}
+	if e.hora, _, err = parseCampoCron(campos[1], 0, 23, nil); err != nil {
+		return nil, fmt.Errorf("cron %q: hora: %w", s, err)
+	}
+	if e.dom, e.domTodos, err = parseCampoCron(campos[2], 1, 31, nil); err != nil {
+		return nil, fmt.Errorf("cron %q: día: %w", s, err)
+	}
+	if e.mes, _, err = parseCampoCron(campos[3], 1, 12, cronMeses); err != nil {
+		return nil, fmt.Errorf("cron %q: mes: %w", s, err)
+	}
+	// 7 también es domingo
+	if e.dow, e.dowTodos, err = parseCampoCron(campos[4], 0, 7, cronDias); err != nil {
+		return nil, fmt.Errorf("cron %q: día de semana: %w", s, err)
+	}
+	if e.dow&(1<<7) != 0 {
+		e.dow |= 1
+	}
+	return e, nil
+}
+
+func parseCampoCron(campo string, lo, hi int, nombres map[string]int) (bits uint64, todos bool, err error) {
+	valor := func(s string) (int, error) {
+		if n, ok := nombres[strings.ToLower(s)]; ok {
+			return n, nil
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < lo || n > hi {
+			return 0, fmt.Errorf("valor %q fuera de %d-%d", s, lo, hi)
+		}
+		return n, nil
+	}
+
+	for _, parte := range strings.Split(campo, ",") {
+		rango, pasoTxt, conPaso := strings.Cut(parte, "/")
+		paso := 1
+		if conPaso {
+			if paso, err = strconv.Atoi(pasoTxt); err != nil || paso <= 0 {
+				return 0, false, fmt.Errorf("paso %q inválido", pasoTxt)
+			}
+		}
+
+		desde, hasta := lo, hi
+		switch {
+		case rango == "*":
+			// como vixie cron, "*/n" también cuenta como "*" para la regla día/semana
+			todos = true
+		case strings.Contains(rango, "-"):
+			a, b, _ := strings.Cut(rango, "-")
+			if desde, err = valor(a); err != nil {
+				return 0, false, err
+			}
+			if hasta, err = valor(b); err != nil {
+				return 0, false, err
+			}
+			if desde > hasta {
+				return 0, false, fmt.Errorf("rango %q invertido", rango)
+			}
+		default:
+			if desde, err = valor(rango); err != nil {
+				return 0, false, err
+			}
+			// "5/10" = desde 5 hasta el final, de 10 en 10
+			hasta = desde
+			if conPaso {
+				hasta = hi
+			}
+		}
+		for v := desde; v <= hasta; v += paso {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, todos, nil
+}
+
+func (e *CronExpr) String() string { return e.Texto }
+
+// diaOK aplica la regla de cron: si día y día-de-semana están restringidos
+// basta con que coincida cualquiera de los dos.
+func (e *CronExpr) diaOK(t time.Time) bool {
+	dom := e.dom&(1<<uint(t.Day())) != 0
+	dow := e.dow&(1<<uint(t.Weekday())) != 0
+	switch {
+	case e.domTodos || e.dowTodos:
+		return dom && dow
+	default:
+		return dom || dow
+	}
+}
+
+// Next devuelve el primer minuto estrictamente posterior a t que cumple la
+// expresión (en la zona horaria de t, como cron).
+func (e *CronExpr) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limite := t.AddDate(5, 0, 0) // "30 2 31 2 *" nunca ocurre
+	for t.Before(limite) {
+		if e.mes&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !e.diaOK(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if e.hora&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if e.min&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	cases := []struct {
+		expr string
+		err  string // "" = válida
+	}{
+		{expr: "* * * * *"},
+		{expr: "*/5 * * * *"},
+		{expr: "0,30 8-18/2 1-15 jan-jun mon-fri"},
+		{expr: "5/10 * * * *"},
+		{expr: "0 0 * * 7"},
+		{expr: "  @daily  "},
+		{expr: "@hourly"},
+		{expr: "* * * *", err: "5 campos"},
+		{expr: "* * * * * *", err: "5 campos"},
+		{expr: "@reboot", err: "atajo no soportado"},
+		{expr: "60 * * * *", err: "minuto"},
+		{expr: "* 24 * * *", err: "hora"},
+		{expr: "* * 0 * *", err: "día"},
+		{expr: "* * * 13 *", err: "mes"},
+		{expr: "* * * * 8", err: "día de semana"},
+		{expr: "*/0 * * * *", err: "paso"},
+		{expr: "30-10 * * * *", err: "invertido"},
+		{expr: "* * * foo *", err: "mes"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.expr, func(t *testing.T) {
+			e, err := ParseCron(tc.expr)
+			switch {
+			case tc.err == "" && err != nil:
+				t.Fatalf("error inesperado: %v", err)
+			case tc.err != "" && err == nil:
+				t.Fatalf("se esperaba un error con %q", tc.err)
+			case tc.err != "" && !strings.Contains(err.Error(), tc.err):
+				t.Fatalf("error %q no menciona %q", err, tc.err)
+			case tc.err == "" && e.String() != strings.TrimSpace(tc.expr):
+				t.Errorf("String() = %q", e.String())
+			}
+		})
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	at := func(s string) time.Time {
+		t.Helper()
+		ts, err := time.ParseInLocation("2006-01-02 15:04:05", s, time.UTC)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ts
+	}
+
+	cases := []struct {
+		expr, desde, want string // want "" = nunca
+	}{
+		// estrictamente posterior, truncando los segundos
+		{"* * * * *", "2026-03-10 12:00:00", "2026-03-10 12:01:00"},
+		{"* * * * *", "2026-03-10 12:00:59", "2026-03-10 12:01:00"},
+		{"*/15 * * * *", "2026-03-10 12:07:00", "2026-03-10 12:15:00"},
+		{"*/15 * * * *", "2026-03-10 12:45:00", "2026-03-10 13:00:00"},
+		{"5/10 * * * *", "2026-03-10 12:06:00", "2026-03-10 12:15:00"},
+		{"0 9 * * *", "2026-03-10 09:00:00", "2026-03-11 09:00:00"},
+		{"@hourly", "2026-12-31 23:30:00", "2027-01-01 00:00:00"},
+		{"@monthly", "2026-01-31 10:00:00", "2026-02-01 00:00:00"},
+		// 2026-03-10 es martes
+		{"0 8 * * mon-fri", "2026-03-13 09:00:00", "2026-03-16 08:00:00"},
+		{"0 0 * * 7", "2026-03-10 00:00:00", "2026-03-15 00:00:00"},
+		{"0 0 * * sun", "2026-03-10 00:00:00", "2026-03-15 00:00:00"},
+		// día y día de semana restringidos: basta con cualquiera
+		{"0 0 13 * fri", "2026-03-01 00:00:00", "2026-03-06 00:00:00"},
+		{"0 0 13 * fri", "2026-03-07 00:00:00", "2026-03-13 00:00:00"},
+		// con "*/n" en el día de semana cuenta como "*": tienen que coincidir los dos
+		{"0 0 1 * */1", "2026-03-10 00:00:00", "2026-04-01 00:00:00"},
+		{"0 0 29 2 *", "2026-03-01 00:00:00", "2028-02-29 00:00:00"},
+		{"30 2 31 2 *", "2026-01-01 00:00:00", ""},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.expr+" desde "+tc.desde, func(t *testing.T) {
+			e, err := ParseCron(tc.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := e.Next(at(tc.desde))
+			if tc.want == "" {
+				if !got.IsZero() {
+					t.Fatalf("Next = %s, se esperaba nunca", got)
+				}
+				return
+			}
+			if want := at(tc.want); !got.Equal(want) {
+				t.Fatalf("Next = %s, se esperaba %s", got, want)
+			}
+		})
+	}
+}
+
+func TestCronNextZonaHoraria(t *testing.T) {
+	// como cron, la expresión se evalúa en la zona de t
+	loc := time.FixedZone("GT", -6*3600)
+	e, err := ParseCron("0 9 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := e.Next(time.Date(2026, 3, 10, 10, 0, 0, 0, loc))
+	if want := time.Date(2026, 3, 11, 9, 0, 0, 0, loc); !got.Equal(want) || got.Location() != loc {
+		t.Errorf("Next = %s, se esperaba %s", got, want)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// CronScheduler corre el job del generador dentro del daemon (cron_mode:
+// internal) con la misma expresión que iría al crontab. Cada ejecución
+// agrega su salida a cron_log entre líneas de inicio y fin.
+
+// CronJob escribe su salida en w; ctx se cancela al cerrar el daemon.
+type CronJob func(ctx context.Context, w io.Writer) error
+
+type CronScheduler struct {
+	expr    *CronExpr
+	job     CronJob
+	logPath string
+
+	mu     sync.Mutex
+	estado CronEstado
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// CronEstado es lo que devuelven /api/cron y `daemon cron status`.
+type CronEstado struct {
+	Schedule       string     `json:"schedule"`
+	Log            string     `json:"log"`
+	Corriendo      bool       `json:"corriendo"`
+	Proxima        time.Time  `json:"proxima"`
+	UltimoInicio   *time.Time `json:"ultimo_inicio,omitempty"`
+	UltimaDuracion string     `json:"ultima_duracion,omitempty"`
+	UltimoError    string     `json:"ultimo_error,omitempty"`
+	Ejecuciones    int        `json:"ejecuciones"`
+	Fallidas       int        `json:"fallidas"`
+	Saltadas       int        `json:"saltadas"` // la anterior seguía corriendo
+}
+
+func NewCronScheduler(expr *CronExpr, logPath string, job CronJob) *CronScheduler {
+	return &CronScheduler{
+		expr:    expr,
+		job:     job,
+		logPath: logPath,
+		estado:  CronEstado{Schedule: expr.String(), Log: logPath},
+	}
+}
+
+// scriptJob corre el script de bash de siempre.
+func scriptJob(script string) CronJob {
+	return func(ctx context.Context, w io.Writer) error {
+		cmd := exec.CommandContext(ctx, "/bin/bash", script)
+		cmd.Stdout, cmd.Stderr = w, w
+		return cmd.Run()
+	}
+}
+
+// Start no recibe el ctx del daemon: el scheduler se detiene con Stop, en
+// su paso del cierre, para no matar un job a medias apenas llega la señal.
+func (s *CronScheduler) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel, s.done = cancel, make(chan struct{})
+	go s.loop(ctx)
+}
+
+// Stop deja de programar, cancela el job en curso y espera a que termine
+// (o a que venza ctx).
+func (s *CronScheduler) Stop(ctx context.Context) error {
+	if s.cancel == nil {
+		return nil
+	}
+	s.cancel()
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("job del cron sin terminar: %w", ctx.Err())
+	}
+}
+
+func (s *CronScheduler) Estado() CronEstado {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.estado
+}
+
+func (s *CronScheduler) loop(ctx context.Context) {
+	var wg sync.WaitGroup
+	defer func() {
+		wg.Wait()
+		close(s.done)
+	}()
+
+	for {
+		prox := s.expr.Next(time.Now())
+		if prox.IsZero() {
+			fmt.Printf("WARNING cron: %q no vuelve a ocurrir, scheduler detenido\n", s.expr)
+			return
+		}
+		s.mu.Lock()
+		s.estado.Proxima = prox
+		s.mu.Unlock()
+
+		t := time.NewTimer(time.Until(prox))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+
+		s.mu.Lock()
+		if s.estado.Corriendo {
+			s.estado.Saltadas++
+			s.mu.Unlock()
+			fmt.Println("WARNING cron: la ejecución anterior sigue corriendo, se salta esta")
+			continue
+		}
+		s.estado.Corriendo = true
+		s.mu.Unlock()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.ejecutar(ctx)
+		}()
+	}
+}
+
+func (s *CronScheduler) ejecutar(ctx context.Context) {
+	inicio := time.Now()
+	err := s.correrJob(ctx, inicio)
+	dur := time.Since(inicio).Round(time.Millisecond)
+
+	s.mu.Lock()
+	s.estado.Corriendo = false
+	s.estado.Ejecuciones++
+	s.estado.UltimoInicio = &inicio
+	s.estado.UltimaDuracion = dur.String()
+	s.estado.UltimoError = ""
+	if err != nil {
+		s.estado.Fallidas++
+		s.estado.UltimoError = err.Error()
+	}
+	n := s.estado.Ejecuciones
+	s.mu.Unlock()
+
+	metricas.observeCron(err == nil)
+	if err != nil {
+		fmt.Printf("WARNING cron: ejecución %d falló (%s): %v\n", n, dur, err)
+		return
+	}
+	fmt.Printf("[cron] ejecución %d ok (%s)\n", n, dur)
+}
+
+// correrJob abre el log, marca inicio y fin y corre el job.
+func (s *CronScheduler) correrJob(ctx context.Context, inicio time.Time) error {
+	f, err := os.OpenFile(s.logPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("abrir log: %w", err)
+	}
+	defer f.Close()
+
+	fmt.Fprintf(f, "=== %s inicio (%s)\n", inicio.Format(time.RFC3339), s.expr)
+	err = s.job(ctx, f)
+	if err != nil {
+		fmt.Fprintf(f, "=== %s fin con ERROR: %v\n", time.Now().Format(time.RFC3339), err)
+	} else {
+		fmt.Fprintf(f, "=== %s fin ok (%s)\n", time.Now().Format(time.RFC3339), time.Since(inicio).Round(time.Millisecond))
+	}
+	return err
+}
@@ -1,36 +1,208 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
 	"strings"
 )
 
+// Cómo se corre el job del generador de contenedores (config cron_mode)
+const (
+	CronCrontab  = "crontab"  // bloque administrado en el crontab del usuario
+	CronInternal = "internal" // scheduler dentro del daemon, no toca el crontab
+	CronOff      = "off"
+)
+
+// Qué corre el job (config cron_job)
+const (
+	CronJobGenerador = "generador" // `daemon generate`, o el generador en proceso
+	CronJobScript    = "script"    // cron_script con bash
+)
+
+// CronManager administra un bloque marcado del crontab del usuario:
+//
+//	# BEGIN so1-daemon <tag>
+//	<expresión> <comando> >> '<log>' 2>&1
+//	# END so1-daemon <tag>
+//
+// Solo toca lo que está entre sus marcas; el resto del crontab queda igual.
 type CronManager struct {
-	ScriptPath string 
-	LogPath    string 
+	ScriptPath string
+	Comando    string // ya con comillas de shell
+	LogPath    string
+	Schedule   string // expresión de cron, ver CronExpr
+	Tag        string
 }
 
-func (c CronManager) InstallEveryMinute() error {
-	line := fmt.Sprintf("* * * * * /bin/bash %s >> %s 2>&1", c.ScriptPath, c.LogPath)
+func cronManager(cfg *Config) CronManager {
+	return CronManager{
+		ScriptPath: cfg.CronScript,
+		Comando:    cronComando(cfg),
+		LogPath:    cfg.CronLog,
+		Schedule:   cfg.CronSchedule,
+		Tag:        "crear-contenedores",
+	}
+}
 
-	
-	current, _ := runCmd("bash", "-lc", "crontab -l 2>/dev/null || true")
-	if strings.Contains(current, c.ScriptPath) {
-		return nil
+// cronComando arma lo que corre cron. Con el generador es este mismo
+// binario (`daemon generate`) con los flags que necesita: cron no hereda
+// el entorno SO1_* del daemon.
+func cronComando(cfg *Config) string {
+	if cfg.CronJob == CronJobScript {
+		return "/bin/bash " + shellQuote(cfg.CronScript)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		exe, _ = filepath.Abs(os.Args[0])
+	}
+	args := []string{shellQuote(exe), "generate"}
+	flag := func(k, v string) { args = append(args, "--"+k, shellQuote(v)) }
+	if cfg.ConfigPath != "" {
+		flag("config", cfg.ConfigPath)
+	}
+	flag("db", cfg.DBPath)
+	flag("runtime", cfg.Runtime)
+	if cfg.DockerSocket != "" {
+		flag("docker-socket", cfg.DockerSocket)
+	}
+	if cfg.GeneratorFile != "" {
+		flag("generator", cfg.GeneratorFile)
 	}
+	if cfg.GenSeed != 0 {
+		flag("gen-seed", strconv.Itoa(cfg.GenSeed))
+	}
+	return strings.Join(args, " ")
+}
+
+// binarioTemporal avisa del caso `go run`: el ejecutable vive en el
+// directorio temporal y desaparece al terminar.
+func binarioTemporal() bool {
+	exe, err := os.Executable()
+	return err == nil && strings.HasPrefix(exe, os.TempDir()+string(os.PathSeparator))
+}
+
+func (c CronManager) inicio() string { return "# BEGIN so1-daemon " + c.Tag }
+func (c CronManager) fin() string    { return "# END so1-daemon " + c.Tag }
 
-	
-	cmd := fmt.Sprintf(`(crontab -l 2>/dev/null; echo "%s") | crontab -`, line)
-	_, err := runCmd("bash", "-lc", cmd)
+// Linea es lo que queda en el crontab. Las rutas van entre comillas
+// simples y % se escapa (en crontab % es salto de línea).
+func (c CronManager) Linea() string {
+	esc := func(s string) string { return strings.ReplaceAll(s, "%", `\%`) }
+	return fmt.Sprintf("%s %s >> %s 2>&1", c.Schedule, esc(c.Comando), esc(shellQuote(c.LogPath)))
+}
+
+// lineaVieja es lo que instalaban versiones anteriores, sin marcas: se
+// limpia al instalar o quitar para no dejar el job duplicado.
+func (c CronManager) lineaVieja() string {
+	return fmt.Sprintf("* * * * * /bin/bash %s >> %s 2>&1", c.ScriptPath, c.LogPath)
+}
+
+// Install escribe (o reemplaza) el bloque; no reescribe si ya está igual.
+func (c CronManager) Install(ctx context.Context) error {
+	if _, err := ParseCron(c.Schedule); err != nil {
+		return err
+	}
+	lineas, err := crontabLeer(ctx)
 	if err != nil {
+		return err
+	}
+	resto, actual := c.separar(lineas)
+	if len(actual) == 1 && actual[0] == c.Linea() && len(resto) == len(lineas)-3 {
+		return nil
+	}
+	nuevo := append(resto, c.inicio(), c.Linea(), c.fin())
+	if err := crontabEscribir(ctx, nuevo); err != nil {
 		return fmt.Errorf("agregar cronjob falló: %w", err)
 	}
 	return nil
 }
 
-func (c CronManager) Remove() error {
-	
-	cmd := fmt.Sprintf(`crontab -l 2>/dev/null | grep -vF "%s" | crontab -`, c.ScriptPath)
-	_, err := runCmd("bash", "-lc", cmd)
-	return err
+func (c CronManager) Remove(ctx context.Context) error {
+	lineas, err := crontabLeer(ctx)
+	if err != nil {
+		return err
+	}
+	resto, _ := c.separar(lineas)
+	if len(resto) == len(lineas) {
+		return nil // no había nada nuestro
+	}
+	return crontabEscribir(ctx, resto)
+}
+
+// Installed devuelve la línea del bloque administrado ("" si no está).
+func (c CronManager) Installed(ctx context.Context) (string, error) {
+	lineas, err := crontabLeer(ctx)
+	if err != nil {
+		return "", err
+	}
+	_, actual := c.separar(lineas)
+	return strings.Join(actual, "\n"), nil
+}
+
+// separar divide el crontab en lo ajeno y el contenido de nuestro bloque
+// (también descarta la línea sin marcas de versiones anteriores).
+func (c CronManager) separar(lineas []string) (resto, bloque []string) {
+	dentro := false
+	for _, l := range lineas {
+		t := strings.TrimSpace(l)
+		switch {
+		case t == c.inicio():
+			dentro = true
+		case t == c.fin() && dentro:
+			dentro = false
+		case dentro:
+			bloque = append(bloque, t)
+		case t == c.lineaVieja():
+		default:
+			resto = append(resto, l)
+		}
+	}
+	return resto, bloque
+}
+
+// crontabLeer corre `crontab -l`; sin crontab todavía es una lista vacía.
+func crontabLeer(ctx context.Context) ([]string, error) {
+	cmd := exec.CommandContext(ctx, "crontab", "-l")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		var exit *exec.ExitError
+		if errors.As(err, &exit) && strings.Contains(strings.ToLower(stderr.String()), "no crontab") {
+			return nil, nil
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("crontab -l: %s", msg)
+		}
+		return nil, fmt.Errorf("crontab -l: %w", err)
+	}
+	texto := strings.TrimRight(stdout.String(), "\n")
+	if texto == "" {
+		return nil, nil
+	}
+	return strings.Split(texto, "\n"), nil
+}
+
+// crontabEscribir reemplaza el crontab completo por stdin (`crontab -`).
+func crontabEscribir(ctx context.Context, lineas []string) error {
+	cmd := exec.CommandContext(ctx, "crontab", "-")
+	cmd.Stdin = strings.NewReader(strings.Join(lineas, "\n") + "\n")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("crontab -: %s", msg)
+		}
+		return fmt.Errorf("crontab -: %w", err)
+	}
+	return nil
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
 }
@@ -1,9 +1,11 @@
 package main
 
 import (
+	"context"
 	"database/sql"
-	"fmt"
+	"errors"
 	"log"
+	"strings"
 	"sync"
 	"time"
 
@@ -15,13 +17,13 @@ var (
 	dbOnce sync.Once
 )
 
-// Ruta relativa desde go-deamon/
-const dbPath = "../dashboard/data/metrics.db"
-
-func InitDB() error {
+// OpenDB abre la DB sin tocar el esquema (lo usa `migrate`).
+// dbPath viene de Config.DBPath (por defecto ../dashboard/data/metrics.db)
+func OpenDB(dbPath string) error {
 	var err error
 	dbOnce.Do(func() {
-		db, err = sql.Open("sqlite", dbPath)
+		// busy_timeout: la retención escribe en paralelo al loop principal
+		db, err = sql.Open("sqlite", "file:"+dbPath+"?_pragma=busy_timeout(5000)")
 		if err != nil {
 			return
 		}
@@ -32,30 +34,26 @@ func InitDB() error {
 		// PRAGMAs recomendados (no dañan si ya están en la DB)
 		_, _ = db.Exec(`PRAGMA journal_mode=WAL;`)
 		_, _ = db.Exec(`PRAGMA synchronous=NORMAL;`)
-
-		// Opcional: validar que existan las tablas clave
-		if err = ensureTableExists("lotes"); err != nil {
-			return
-		}
-		if err = ensureTableExists("procesos_snapshot"); err != nil {
-			return
-		}
-		if err = ensureTableExists("contenedores_snapshot"); err != nil {
-			return
-		}
-
-		log.Printf("DB lista: %s\n", dbPath)
 	})
 	return err
 }
 
-func ensureTableExists(name string) error {
-	var found string
-	err := db.QueryRow(`SELECT name FROM sqlite_master WHERE type='table' AND name=?`, name).Scan(&found)
-	if err == sql.ErrNoRows {
-		return fmt.Errorf("no existe la tabla requerida: %s (revisa metrics.db)", name)
+// InitDB abre la DB y aplica las migraciones pendientes (migrations/*.sql).
+func InitDB(dbPath string) error {
+	if err := OpenDB(dbPath); err != nil {
+		return err
 	}
-	return err
+
+	done, err := MigrateUp(0)
+	for _, m := range done {
+		log.Printf("migración aplicada: %04d_%s\n", m.Version, m.Name)
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Printf("DB lista: %s\n", dbPath)
+	return nil
 }
 
 func CloseDB() {
@@ -64,30 +62,90 @@ func CloseDB() {
 	}
 }
 
-// Crea un lote y devuelve id_lote
-func CrearLote() (int64, error) {
-	// tu tabla usa ts_utc TEXT NOT NULL
-	ts := time.Now().UTC().Format(time.RFC3339Nano)
+// LoteDatos es lo que juntaron los colectores que vencieron en un tick.
+// Un lote puede traer solo algunos: lo que no corrió queda en nil.
+type LoteDatos struct {
+	Ts           time.Time
+	Colectores   []string  // procesos, contenedores, cpu
+	SysInfo      *SysInfo  // nil = el colector de procesos no corrió
+	Contenedores *ContInfo // nil = el colector de contenedores no corrió
+	CPUTotal     *float64  // nil = el colector de CPU no corrió
+}
 
-	res, err := db.Exec(`INSERT INTO lotes (ts_utc) VALUES (?)`, ts)
+// GuardarLote escribe el lote completo en una sola transacción: queda entero
+// o no queda (un lote a medias no se ve nunca desde el dashboard).
+func GuardarLote(ctx context.Context, l LoteDatos) (int64, error) {
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
 		return 0, err
 	}
-	return res.LastInsertId()
+	defer func() { _ = tx.Rollback() }()
+
+	var totalRAM, freeRAM sql.NullInt64
+	if l.SysInfo != nil {
+		totalRAM = sql.NullInt64{Int64: int64(l.SysInfo.Totalram), Valid: true}
+		freeRAM = sql.NullInt64{Int64: int64(l.SysInfo.Freeram), Valid: true}
+	}
+	var cpuTotal sql.NullFloat64
+	if l.CPUTotal != nil {
+		cpuTotal = sql.NullFloat64{Float64: *l.CPUTotal, Valid: true}
+	}
+
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO lotes (ts_utc, colectores, total_ram_kb, free_ram_kb, cpu_total_pct)
+		VALUES (?, ?, ?, ?, ?)
+	`, l.Ts.UTC().Format(time.RFC3339Nano), strings.Join(l.Colectores, ","), totalRAM, freeRAM, cpuTotal)
+	if err != nil {
+		return 0, err
+	}
+	idLote, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	if l.SysInfo != nil {
+		if err := insertarProcesosSnapshot(ctx, tx, idLote, l.SysInfo.Processes); err != nil {
+			return 0, err
+		}
+	}
+	if l.Contenedores != nil {
+		if err := insertarContenedoresSnapshot(ctx, tx, idLote, l.Contenedores); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return idLote, nil
 }
 
-// Inserta snapshot de procesos (módulo 1)
-func InsertarProcesosSnapshot(idLote int64, procs []Process) error {
-	tx, err := db.Begin()
+// GuardarPolitica guarda decisiones y eventos de una corrida de la política
+// en una sola transacción, asociados al lote cuya muestra se usó.
+func GuardarPolitica(ctx context.Context, idLote int64, dryRun bool, decisions []PolicyDecision, eventos []EventoEliminacion) error {
+	if len(decisions) == 0 && len(eventos) == 0 {
+		return nil
+	}
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
 	defer func() { _ = tx.Rollback() }()
 
-	stmt, err := tx.Prepare(`
+	if err := insertarDecisionesPolitica(ctx, tx, idLote, dryRun, decisions); err != nil {
+		return err
+	}
+	if err := insertarEventosEliminacion(ctx, tx, idLote, eventos); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Inserta snapshot de procesos (módulo 1)
+func insertarProcesosSnapshot(ctx context.Context, tx *sql.Tx, idLote int64, procs []Process) error {
+	stmt, err := tx.PrepareContext(ctx, `
 		INSERT OR REPLACE INTO procesos_snapshot
-		(id_lote, pid, nombre, cmdline, vsz_kb, rss_kb, porcentaje_ram, porcentaje_cpu, utime, stime)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		(id_lote, pid, nombre, cmdline, vsz_kb, rss_kb, porcentaje_ram, porcentaje_cpu, utime, stime, porcentaje_cpu_intervalo)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`)
 	if err != nil {
 		return err
@@ -95,7 +153,8 @@ func InsertarProcesosSnapshot(idLote int64, procs []Process) error {
 	defer stmt.Close()
 
 	for _, p := range procs {
-		_, err = stmt.Exec(
+		cpuIntervalo := sql.NullFloat64{Float64: p.CPUPercent, Valid: p.CPUPercentOK}
+		_, err = stmt.ExecContext(ctx,
 			idLote,
 			p.PID,
 			p.Name,
@@ -106,13 +165,13 @@ func InsertarProcesosSnapshot(idLote int64, procs []Process) error {
 			p.CPUUsage,
 			p.UTime,
 			p.STime,
+			cpuIntervalo,
 		)
 		if err != nil {
 			return err
 		}
 	}
-
-	return tx.Commit()
+	return nil
 }
 
 
@@ -124,26 +183,29 @@ type ContainerSnapshot struct {
 	Procs       int64  `json:"Procs"`
 }
 
+// ResetDB borra el historial (--reset) salvo los throttles todavía puestos.
 func ResetDB() error {
 	_, err := db.Exec(`
+		DELETE FROM eventos_eliminacion;
+		-- un throttle sin revertir se conserva (sin lote): RevertirPendientes
+		-- lo lee después para dejar el cgroup como estaba
+		DELETE FROM limites_cgroup WHERE ts_revertido IS NOT NULL;
+		UPDATE limites_cgroup SET id_lote = NULL;
+		DELETE FROM decisiones_politica;
 		DELETE FROM procesos_snapshot;
 		DELETE FROM contenedores_snapshot;
 		DELETE FROM lotes;
-		DELETE FROM sqlite_sequence WHERE name IN ('lotes');
+		DELETE FROM generador_contenedores;
+		DELETE FROM generador_rondas;
+		DELETE FROM sqlite_sequence WHERE name IN ('lotes', 'generador_rondas');
 	`)
 	return err
 }
-func InsertarContenedoresSnapshot(idLote int64, ci *ContInfo) error {
-	tx, err := db.Begin()
-	if err != nil {
-		return err
-	}
-	defer func() { _ = tx.Rollback() }()
-
-	stmt, err := tx.Prepare(`
+func insertarContenedoresSnapshot(ctx context.Context, tx *sql.Tx, idLote int64, ci *ContInfo) error {
+	stmt, err := tx.PrepareContext(ctx, `
 		INSERT OR REPLACE INTO contenedores_snapshot
-		(id_lote, id_contenedor, ruta_cgroup, rss_kb, cpu_jiffies, procesos)
-		VALUES (?, ?, ?, ?, ?, ?)
+		(id_lote, id_contenedor, ruta_cgroup, rss_kb, cpu_jiffies, procesos, porcentaje_cpu)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
 	`)
 	if err != nil {
 		return err
@@ -151,18 +213,597 @@ func InsertarContenedoresSnapshot(idLote int64, ci *ContInfo) error {
 	defer stmt.Close()
 
 	for _, c := range ci.Containers {
-		_, err = stmt.Exec(
+		_, err = stmt.ExecContext(ctx,
 			idLote,
 			c.ContainerID,
 			c.CgroupPath,
 			int64(c.RSSKB),
 			int64(c.CPUJiffies),
 			int64(c.Procs),
+			sql.NullFloat64{Float64: c.CPUPercent, Valid: c.CPUPercentOK},
 		)
 		if err != nil {
 			return err
 		}
 	}
+	return nil
+}
 
+// Inserta el reporte de decisiones de la política para el lote
+func insertarDecisionesPolitica(ctx context.Context, tx *sql.Tx, idLote int64, dryRun bool, decisions []PolicyDecision) error {
+	if len(decisions) == 0 {
+		return nil
+	}
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT OR REPLACE INTO decisiones_politica
+		(id_lote, id_contenedor, nombre, imagen, grupo, score, cpu_pct, mem_bytes, accion, razon, detenido, dry_run)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, d := range decisions {
+		_, err = stmt.ExecContext(ctx,
+			idLote,
+			d.Container.ID,
+			d.Container.Name,
+			d.Container.Image,
+			d.Group,
+			d.Score,
+			d.Container.CPUPerc,
+			int64(d.Container.MemBytes),
+			d.Action,
+			d.Reason,
+			d.Exited,
+			dryRun,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InsertarEventosEliminacion guarda eventos hechos fuera de un lote (cierre del daemon).
+func InsertarEventosEliminacion(ctx context.Context, eventos []EventoEliminacion) error {
+	if len(eventos) == 0 {
+		return nil
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := insertarEventosEliminacion(ctx, tx, 0, eventos); err != nil {
+		return err
+	}
 	return tx.Commit()
-}
\ No newline at end of file
+}
+
+// Inserta los eventos ejecutados (sigterm, sigkill, rm, pause, limit). idLote 0 = fuera de un lote
+func insertarEventosEliminacion(ctx context.Context, tx *sql.Tx, idLote int64, eventos []EventoEliminacion) error {
+	if len(eventos) == 0 {
+		return nil
+	}
+
+	lote := sql.NullInt64{Int64: idLote, Valid: idLote > 0}
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO eventos_eliminacion
+		(id_lote, ts_utc, id_contenedor, nombre, imagen, grupo, cpu_pct, mem_bytes, score, accion, razon, error)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, ev := range eventos {
+		d := ev.Decision
+		var errText sql.NullString
+		if ev.Err != nil {
+			errText = sql.NullString{String: ev.Err.Error(), Valid: true}
+		}
+
+		_, err = stmt.ExecContext(ctx,
+			lote,
+			ev.Ts.Format(time.RFC3339Nano),
+			d.Container.ID,
+			d.Container.Name,
+			d.Container.Image,
+			d.Group,
+			d.Container.CPUPerc,
+			int64(d.Container.MemBytes),
+			d.Score,
+			ev.Accion,
+			d.Reason,
+			errText,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return insertarLimitesCgroup(ctx, tx, lote, eventos)
+}
+
+// Inserta los topes de los throttle que salieron bien
+func insertarLimitesCgroup(ctx context.Context, tx *sql.Tx, lote sql.NullInt64, eventos []EventoEliminacion) error {
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO limites_cgroup
+		(id_lote, ts_utc, id_contenedor, nombre, grupo, via, ruta_cgroup,
+		 cpu_max, memory_high, memory_max, cpu_max_antes, memory_high_antes, memory_max_antes,
+		 nano_cpus_antes, memory_antes, memory_swap_antes)
+		VALUES (?, ?, ?, ?, ?, ?, NULLIF(?, ''),
+		 NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''),
+		 ?, ?, ?)
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, ev := range eventos {
+		l := ev.Limite
+		if l == nil || ev.Err != nil {
+			continue
+		}
+		// los valores de docker solo existen con via runtime (0 = sin tope)
+		var nano, mem, swap sql.NullInt64
+		if l.Via == ThrottleRuntime {
+			nano = sql.NullInt64{Int64: l.AntesRuntime.NanoCPUs, Valid: true}
+			mem = sql.NullInt64{Int64: l.AntesRuntime.Memory, Valid: true}
+			swap = sql.NullInt64{Int64: l.AntesRuntime.MemorySwap, Valid: true}
+		}
+		_, err = stmt.ExecContext(ctx,
+			lote,
+			l.Desde.Format(time.RFC3339Nano),
+			l.ContainerID,
+			ev.Decision.Container.Name,
+			ev.Decision.Group,
+			l.Via,
+			l.Ruta,
+			l.Valores.CPUMax, l.Valores.MemoryHigh, l.Valores.MemoryMax,
+			l.Antes.CPUMax, l.Antes.MemoryHigh, l.Antes.MemoryMax,
+			nano, mem, swap,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CerrarLimiteCgroup marca como revertido el throttle activo del
+// contenedor. motivo: cierre, arranque, desalojado, ya no corre.
+func CerrarLimiteCgroup(ctx context.Context, id string, ts time.Time, motivo string, errRev error) error {
+	var errText sql.NullString
+	if errRev != nil {
+		errText = sql.NullString{String: errRev.Error(), Valid: true}
+	}
+	_, err := db.ExecContext(ctx, `
+		UPDATE limites_cgroup SET ts_revertido = ?, motivo_revertido = ?, error_revertido = ?
+		WHERE id_contenedor = ? AND ts_revertido IS NULL
+	`, ts.Format(time.RFC3339Nano), motivo, errText, id)
+	return err
+}
+
+// LimitesCgroupActivos devuelve los throttle sin revertir, del más nuevo al
+// más viejo: revertidos en ese orden, el último en escribirse es el valor
+// original aunque un contenedor tenga más de uno.
+func LimitesCgroupActivos(ctx context.Context) ([]LimiteCgroup, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT id_contenedor, via, COALESCE(ruta_cgroup, ''), ts_utc,
+		       COALESCE(cpu_max, ''), COALESCE(memory_high, ''), COALESCE(memory_max, ''),
+		       COALESCE(cpu_max_antes, ''), COALESCE(memory_high_antes, ''), COALESCE(memory_max_antes, ''),
+		       COALESCE(nano_cpus_antes, 0), COALESCE(memory_antes, 0), COALESCE(memory_swap_antes, 0)
+		FROM limites_cgroup
+		WHERE ts_revertido IS NULL
+		ORDER BY id_limite DESC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []LimiteCgroup
+	for rows.Next() {
+		var (
+			l  LimiteCgroup
+			ts string
+		)
+		err := rows.Scan(&l.ContainerID, &l.Via, &l.Ruta, &ts,
+			&l.Valores.CPUMax, &l.Valores.MemoryHigh, &l.Valores.MemoryMax,
+			&l.Antes.CPUMax, &l.Antes.MemoryHigh, &l.Antes.MemoryMax,
+			&l.AntesRuntime.NanoCPUs, &l.AntesRuntime.Memory, &l.AntesRuntime.MemorySwap)
+		if err != nil {
+			return nil, err
+		}
+		l.Desde, _ = time.Parse(time.RFC3339Nano, ts)
+		out = append(out, l)
+	}
+	return out, rows.Err()
+}
+
+// NuevaRondaGenerador abre la ronda; la semilla se completa al cerrarla
+// porque depende del id.
+func NuevaRondaGenerador(ctx context.Context, inicio time.Time, pedidos int) (int64, error) {
+	res, err := db.ExecContext(ctx,
+		`INSERT INTO generador_rondas (ts_inicio, seed, pedidos) VALUES (?, 0, ?)`,
+		inicio.Format(time.RFC3339Nano), pedidos)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// CerrarRondaGenerador guarda semilla, conteos y cada contenedor de la ronda.
+func CerrarRondaGenerador(ctx context.Context, r *RondaGenerador) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	creados, fallidos := r.Conteo()
+	_, err = tx.ExecContext(ctx, `
+		UPDATE generador_rondas SET ts_fin = ?, seed = ?, creados = ?, fallidos = ?
+		WHERE id_ronda = ?
+	`, r.Fin.Format(time.RFC3339Nano), r.Seed, creados, fallidos, r.ID)
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO generador_contenedores
+		(id_ronda, orden, ts_utc, nombre, imagen, clase, env, id_contenedor, error)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, res := range r.Resultados {
+		var env, id, errText sql.NullString
+		if len(res.Env) > 0 {
+			env = sql.NullString{String: strings.Join(sortedKV(res.Env), " "), Valid: true}
+		}
+		if res.Err != nil {
+			errText = sql.NullString{String: res.Err.Error(), Valid: true}
+		} else {
+			id = sql.NullString{String: res.ID, Valid: true}
+		}
+		_, err = stmt.ExecContext(ctx,
+			r.ID, res.Orden, res.Ts.Format(time.RFC3339Nano),
+			res.Nombre, res.Imagen, res.Clase, env, id, errText,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ---- Consultas (API HTTP) ----
+
+type LoteResumen struct {
+	IDLote       int64    `json:"id_lote"`
+	TsUTC        string   `json:"ts_utc"`
+	Colectores   []string `json:"colectores"`
+	Procesos     int      `json:"procesos"`
+	Contenedores int      `json:"contenedores"`
+	TotalRAMKB   *int64   `json:"total_ram_kb"`
+	FreeRAMKB    *int64   `json:"free_ram_kb"`
+	CPUTotal     *float64 `json:"cpu_total_pct"`
+}
+
+// ListarLotes devuelve los lotes más recientes primero; antes > 0 pagina hacia atrás.
+func ListarLotes(limit int, antes int64) ([]LoteResumen, error) {
+	rows, err := db.Query(`
+		SELECT l.id_lote, l.ts_utc, l.colectores,
+		       (SELECT COUNT(*) FROM procesos_snapshot p WHERE p.id_lote = l.id_lote),
+		       (SELECT COUNT(*) FROM contenedores_snapshot c WHERE c.id_lote = l.id_lote),
+		       l.total_ram_kb, l.free_ram_kb, l.cpu_total_pct
+		FROM lotes l
+		WHERE (? = 0 OR l.id_lote < ?)
+		ORDER BY l.id_lote DESC
+		LIMIT ?
+	`, antes, antes, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []LoteResumen{}
+	for rows.Next() {
+		var (
+			l                 LoteResumen
+			colectores        sql.NullString
+			totalRAM, freeRAM sql.NullInt64
+			cpuTotal          sql.NullFloat64
+		)
+		if err := rows.Scan(&l.IDLote, &l.TsUTC, &colectores, &l.Procesos, &l.Contenedores,
+			&totalRAM, &freeRAM, &cpuTotal); err != nil {
+			return nil, err
+		}
+		l.Colectores = splitColectores(colectores)
+		if totalRAM.Valid {
+			l.TotalRAMKB, l.FreeRAMKB = &totalRAM.Int64, &freeRAM.Int64
+		}
+		if cpuTotal.Valid {
+			l.CPUTotal = &cpuTotal.Float64
+		}
+		res = append(res, l)
+	}
+	return res, rows.Err()
+}
+
+// splitColectores: los lotes anteriores a los colectores independientes
+// (colectores NULL) traían siempre procesos y contenedores.
+func splitColectores(s sql.NullString) []string {
+	if !s.Valid {
+		return []string{ColProcesos, ColContenedores}
+	}
+	if s.String == "" {
+		return []string{}
+	}
+	return strings.Split(s.String, ",")
+}
+
+type ProcesoFila struct {
+	PID           int      `json:"pid"`
+	Nombre        string   `json:"nombre"`
+	Cmdline       string   `json:"cmdline"`
+	VSZKB         int64    `json:"vsz_kb"`
+	RSSKB         int64    `json:"rss_kb"`
+	PorcentajeRAM float64  `json:"porcentaje_ram"`
+	PorcentajeCPU float64  `json:"porcentaje_cpu"`
+	CPUIntervalo  *float64 `json:"porcentaje_cpu_intervalo"`
+	UTime         int64    `json:"utime"`
+	STime         int64    `json:"stime"`
+}
+
+func ProcesosDeLote(idLote int64) ([]ProcesoFila, error) {
+	rows, err := db.Query(`
+		SELECT pid, nombre, COALESCE(cmdline, ''), COALESCE(vsz_kb, 0), COALESCE(rss_kb, 0),
+		       COALESCE(porcentaje_ram, 0), COALESCE(porcentaje_cpu, 0), porcentaje_cpu_intervalo,
+		       COALESCE(utime, 0), COALESCE(stime, 0)
+		FROM procesos_snapshot
+		WHERE id_lote = ?
+		ORDER BY rss_kb DESC
+	`, idLote)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []ProcesoFila{}
+	for rows.Next() {
+		var (
+			p   ProcesoFila
+			cpu sql.NullFloat64
+		)
+		if err := rows.Scan(&p.PID, &p.Nombre, &p.Cmdline, &p.VSZKB, &p.RSSKB,
+			&p.PorcentajeRAM, &p.PorcentajeCPU, &cpu, &p.UTime, &p.STime); err != nil {
+			return nil, err
+		}
+		if cpu.Valid {
+			p.CPUIntervalo = &cpu.Float64
+		}
+		res = append(res, p)
+	}
+	return res, rows.Err()
+}
+
+type TopFila struct {
+	PID      int     `json:"pid"`
+	Nombre   string  `json:"nombre"`
+	Valor    float64 `json:"valor"`
+	Muestras int     `json:"muestras"`
+}
+
+// TopProcesos en el rango [desde, hasta] (RFC3339):
+// por "ram" = RSS máximo en KB, por "cpu" = promedio de porcentaje_cpu_intervalo.
+func TopProcesos(por string, n int, desde, hasta string) ([]TopFila, error) {
+	expr := `MAX(p.rss_kb)`
+	filtro := ``
+	if por == "cpu" {
+		expr = `AVG(p.porcentaje_cpu_intervalo)`
+		filtro = `AND p.porcentaje_cpu_intervalo IS NOT NULL`
+	}
+
+	rows, err := db.Query(`
+		SELECT p.pid, p.nombre, `+expr+` AS valor, COUNT(*)
+		FROM procesos_snapshot p
+		JOIN lotes l ON l.id_lote = p.id_lote
+		WHERE l.ts_utc >= ? AND l.ts_utc <= ? `+filtro+`
+		GROUP BY p.pid, p.nombre
+		ORDER BY valor DESC
+		LIMIT ?
+	`, desde, hasta, n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []TopFila{}
+	for rows.Next() {
+		var t TopFila
+		if err := rows.Scan(&t.PID, &t.Nombre, &t.Valor, &t.Muestras); err != nil {
+			return nil, err
+		}
+		res = append(res, t)
+	}
+	return res, rows.Err()
+}
+
+type DecisionFila struct {
+	IDLote       int64   `json:"id_lote"`
+	IDContenedor string  `json:"id_contenedor"`
+	Nombre       string  `json:"nombre"`
+	Imagen       string  `json:"imagen"`
+	Grupo        string  `json:"grupo"`
+	Score        float64 `json:"score"`
+	CPUPct       float64 `json:"cpu_pct"`
+	MemBytes     int64   `json:"mem_bytes"`
+	Accion       string  `json:"accion"`
+	Razon        string  `json:"razon"`
+	Detenido     bool    `json:"detenido"`
+	DryRun       bool    `json:"dry_run"`
+}
+
+// DecisionesDeLote devuelve el reporte de la política; idLote 0 = el último lote con decisiones.
+func DecisionesDeLote(idLote int64) ([]DecisionFila, error) {
+	rows, err := db.Query(`
+		SELECT id_lote, id_contenedor, COALESCE(nombre, ''), COALESCE(imagen, ''), COALESCE(grupo, ''),
+		       COALESCE(score, 0), COALESCE(cpu_pct, 0), COALESCE(mem_bytes, 0), accion, COALESCE(razon, ''),
+		       detenido, dry_run
+		FROM decisiones_politica
+		WHERE id_lote = CASE WHEN ? > 0 THEN ? ELSE (SELECT MAX(id_lote) FROM decisiones_politica) END
+		ORDER BY grupo, accion, score DESC
+	`, idLote, idLote)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []DecisionFila{}
+	for rows.Next() {
+		var d DecisionFila
+		if err := rows.Scan(&d.IDLote, &d.IDContenedor, &d.Nombre, &d.Imagen, &d.Grupo,
+			&d.Score, &d.CPUPct, &d.MemBytes, &d.Accion, &d.Razon, &d.Detenido, &d.DryRun); err != nil {
+			return nil, err
+		}
+		res = append(res, d)
+	}
+	return res, rows.Err()
+}
+
+// toDecisionFila da a una decisión en memoria la misma forma que las guardadas.
+func toDecisionFila(idLote int64, dryRun bool, d PolicyDecision) DecisionFila {
+	return DecisionFila{
+		IDLote:       idLote,
+		IDContenedor: d.Container.ID,
+		Nombre:       d.Container.Name,
+		Imagen:       d.Container.Image,
+		Grupo:        d.Group,
+		Score:        d.Score,
+		CPUPct:       d.Container.CPUPerc,
+		MemBytes:     int64(d.Container.MemBytes),
+		Accion:       d.Action,
+		Razon:        d.Reason,
+		Detenido:     d.Exited,
+		DryRun:       dryRun,
+	}
+}
+
+// ConsultaSoloLectura corre una consulta arbitraria (`daemon db query`) en un
+// handle propio abierto con mode=ro: SQLite rechaza cualquier escritura, aunque
+// la consulta traiga un PRAGMA que apague query_only. Además se acepta una
+// sola sentencia y nada de PRAGMA/ATTACH (ATTACH crea el archivo aunque sea ro).
+func ConsultaSoloLectura(dbPath, query string) (cols []string, filas [][]any, err error) {
+	if err := validarConsulta(query); err != nil {
+		return nil, nil, err
+	}
+	ctx := context.Background()
+	ro, err := sql.Open("sqlite", "file:"+dbPath+"?mode=ro&_pragma=busy_timeout(5000)&_pragma=query_only(1)")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer ro.Close()
+
+	rows, err := ro.QueryContext(ctx, query)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	cols, err = rows.Columns()
+	if err != nil {
+		return nil, nil, err
+	}
+	for rows.Next() {
+		vals := make([]any, len(cols))
+		ptrs := make([]any, len(cols))
+		for i := range vals {
+			ptrs[i] = &vals[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, nil, err
+		}
+		for i, v := range vals {
+			// TEXT llega como []byte en algunas columnas
+			if b, ok := v.([]byte); ok {
+				vals[i] = string(b)
+			}
+		}
+		filas = append(filas, vals)
+	}
+	return cols, filas, rows.Err()
+}
+
+// validarConsulta exige una sola sentencia y rechaza PRAGMA, ATTACH y DETACH.
+// Los ';' dentro de literales, identificadores entre comillas o comentarios
+// no cuentan como separador.
+func validarConsulta(query string) error {
+	var (
+		sentencias []string
+		actual     strings.Builder
+	)
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		switch {
+		case ch == '\'' || ch == '"' || ch == '`':
+			fin := len(query) - 1
+			if j := strings.IndexByte(query[i+1:], ch); j >= 0 {
+				fin = i + 1 + j
+			}
+			actual.WriteString(query[i : fin+1])
+			i = fin
+		case ch == '-' && strings.HasPrefix(query[i:], "--"):
+			j := strings.IndexByte(query[i:], '\n')
+			if j < 0 {
+				j = len(query) - i
+			}
+			actual.WriteByte(' ')
+			i += j
+		case ch == '/' && strings.HasPrefix(query[i:], "/*"):
+			j := strings.Index(query[i+2:], "*/")
+			if j < 0 {
+				j = len(query) - i - 2
+			}
+			actual.WriteByte(' ')
+			i += j + 3
+		case ch == ';':
+			sentencias = append(sentencias, actual.String())
+			actual.Reset()
+		default:
+			actual.WriteByte(ch)
+		}
+	}
+	sentencias = append(sentencias, actual.String())
+
+	var n int
+	for _, st := range sentencias {
+		campos := strings.Fields(st)
+		if len(campos) == 0 {
+			continue
+		}
+		n++
+		switch strings.ToUpper(campos[0]) {
+		case "PRAGMA", "ATTACH", "DETACH":
+			return errors.New("consulta de solo lectura: " + strings.ToUpper(campos[0]) + " no está permitido")
+		}
+	}
+	switch {
+	case n == 0:
+		return errors.New("consulta vacía")
+	case n > 1:
+		return errors.New("consulta de solo lectura: se acepta una sola sentencia")
+	}
+	return nil
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Evictor ejecuta las decisiones "evict" de la política según
+// pol.Eviction: presupuesto por corrida, cooldown por clase y el modo
+// (kill con escalada, pause o limit). Con pol.Throttle, a los que aplica
+// primero les pone topes. Vive lo que vive el daemon porque el cooldown, los
+// contenedores ya limitados y desde cuándo están pausados o limitados se
+// recuerdan entre corridas.
+type Evictor struct {
+	rt  ContainerRuntime
+	pol *Policy
+	thr *Throttler // nil = sin throttle (salvo en dry-run, que solo reporta)
+
+	mu        sync.Mutex
+	ultimo    map[string]time.Time // clase -> último desalojo
+	limitados map[string]bool      // IDs limitados en modo limit
+	retenidos map[string]time.Time // ID -> desde cuándo está pausado o limitado
+
+	// Cada cuánto se consulta el estado mientras corre la gracia
+	sondeo time.Duration
+}
+
+func NewEvictor(rt ContainerRuntime, pol *Policy, thr *Throttler) *Evictor {
+	return &Evictor{
+		rt:        rt,
+		pol:       pol,
+		thr:       thr,
+		ultimo:    map[string]time.Time{},
+		limitados: map[string]bool{},
+		retenidos: map[string]time.Time{},
+		sondeo:    250 * time.Millisecond,
+	}
+}
+
+// Marcar pone Limited en los contenedores que este Evictor ya limitó,
+// anota desde cuándo hay uno pausado o limitado (para eviction.ttl) y
+// olvida los que ya no están corriendo (también en el Throttler).
+func (e *Evictor) Marcar(ctx context.Context, containers []Container) {
+	if e.thr != nil {
+		e.thr.Podar(ctx, containers)
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := time.Now()
+	vivos := map[string]bool{}
+	retenidos := map[string]time.Time{}
+	for i := range containers {
+		c := &containers[i]
+		if e.limitados[c.ID] {
+			c.Limited = true
+			vivos[c.ID] = true
+		}
+		if c.Paused || c.Limited {
+			desde, ok := e.retenidos[c.ID]
+			if !ok {
+				desde = now
+			}
+			retenidos[c.ID] = desde
+		}
+	}
+	e.limitados = vivos
+	e.retenidos = retenidos
+}
+
+// modo es el desalojo que le toca al contenedor: uno ya pausado o limitado
+// (porque venció su ttl) se mata.
+func (e *Evictor) modo(c Container) string {
+	if c.Paused || c.Limited {
+		return EvictKill
+	}
+	return e.pol.Eviction.Mode
+}
+
+// vencer pasa a "evict" los pausados o limitados del daemon que llevan más
+// de eviction.ttl así; desde ahí siguen el camino de cualquier desalojo.
+func (e *Evictor) vencer(res []PolicyDecision, now time.Time) {
+	ttl := e.pol.Eviction.TTL
+	if ttl <= 0 {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for i := range res {
+		d := &res[i]
+		c := d.Container
+		desde, ok := e.retenidos[c.ID]
+		if !ok || d.Action != AccionIgnorado || !(c.Paused || c.Limited) || !e.pol.IsOwned(c) {
+			continue
+		}
+		if now.Sub(desde) >= ttl {
+			d.Action = AccionEliminar
+			d.Reason = fmt.Sprintf("pausado o limitado desde %s (ttl=%s)", desde.Local().Format(time.TimeOnly), ttl)
+		}
+	}
+}
+
+// claseEviccion es la clave del cooldown: el label de clase del generador
+// o, si no lo tiene, el grupo de la política.
+func claseEviccion(d PolicyDecision) string {
+	if c := d.Container.Labels[LabelClase]; c != "" {
+		return c
+	}
+	return d.Group
+}
+
+// Aplicar recorre las decisiones "evict" de mayor a menor score. Si aplica
+// throttle y el contenedor no lo tiene, pasa a "throttle"; si lo tiene
+// desde hace menos de throttle.wait, o no entra en el presupuesto o cae en
+// cooldown, pasa a "deferred". Los pausados o limitados con el ttl vencido
+// entran como "evict". Con dryRun solo se reporta (el cooldown se simula
+// dentro de la corrida).
+func (e *Evictor) Aplicar(ctx context.Context, decisions []PolicyDecision, dryRun bool) ([]PolicyDecision, []EventoEliminacion, error) {
+	ev := e.pol.Eviction
+	res := append([]PolicyDecision(nil), decisions...)
+	e.vencer(res, time.Now())
+
+	var idx []int
+	for i, d := range res {
+		if d.Action == AccionEliminar {
+			idx = append(idx, i)
+		}
+	}
+	sort.SliceStable(idx, func(a, b int) bool { return res[idx[a]].Score > res[idx[b]].Score })
+
+	e.mu.Lock()
+	ultimo := make(map[string]time.Time, len(e.ultimo))
+	for k, v := range e.ultimo {
+		ultimo[k] = v
+	}
+	e.mu.Unlock()
+
+	var (
+		eventos  []EventoEliminacion
+		errs     []error
+		hechos   int
+		victimas []int // índices en res, en el orden en que se desalojan
+	)
+	for _, i := range idx {
+		d := &res[i]
+		clase := claseEviccion(*d)
+		now := time.Now()
+
+		if !dryRun && ctx.Err() != nil {
+			errs = append(errs, fmt.Errorf("política interrumpida: %w", ctx.Err()))
+			break
+		}
+
+		// throttle antes de desalojar; no cuenta para presupuesto ni cooldown
+		// (un pausado o limitado con el ttl vencido va directo al desalojo)
+		retenido := d.Container.Paused || d.Container.Limited
+		if th := e.pol.Throttle; th.Applies(d.Container) && !retenido && (dryRun || e.thr != nil) {
+			var desde time.Time
+			if e.thr != nil {
+				desde = e.thr.desde(d.Container.ID)
+			}
+			if desde.IsZero() {
+				evict := *d
+				d.Action, d.Reason = AccionThrottle, d.Reason+"; throttle antes de desalojar"
+				if dryRun {
+					continue
+				}
+				evt := ejecutarThrottle(context.WithoutCancel(ctx), e.thr, e.pol, *d)
+				eventos = append(eventos, evt)
+				if evt.Err == nil {
+					continue
+				}
+				// sin topes (cgroup no disponible, etc.) se sigue con el desalojo
+				errs = append(errs, evt.Err)
+				*d = evict
+			} else if now.Sub(desde) < th.Wait {
+				d.Action, d.Reason = AccionPospuesto, fmt.Sprintf("%s; con throttle desde %s (wait=%s)", d.Reason, desde.Local().Format(time.TimeOnly), th.Wait)
+				continue
+			}
+		}
+
+		switch {
+		case ev.MaxPerTick > 0 && hechos >= ev.MaxPerTick:
+			d.Action, d.Reason = AccionPospuesto, fmt.Sprintf("%s; pospuesto: max_per_tick=%d alcanzado", d.Reason, ev.MaxPerTick)
+			continue
+		case ev.Cooldown > 0 && now.Before(ultimo[clase].Add(ev.Cooldown)):
+			hasta := ultimo[clase].Add(ev.Cooldown)
+			d.Action, d.Reason = AccionPospuesto, fmt.Sprintf("%s; pospuesto: clase %s en cooldown hasta %s", d.Reason, orDash(clase), hasta.Format(time.TimeOnly))
+			continue
+		}
+		hechos++
+		ultimo[clase] = now
+		if !dryRun {
+			victimas = append(victimas, i)
+		}
+	}
+	if len(victimas) == 0 {
+		return res, eventos, errors.Join(errs...)
+	}
+
+	ds := make([]PolicyDecision, len(victimas))
+	for j, i := range victimas {
+		ds[j] = res[i]
+	}
+	evs, fallos := e.desalojar(ctx, ds)
+	eventos = append(eventos, evs...)
+	now := time.Now()
+	for j, d := range ds {
+		if fallos[j] != nil {
+			errs = append(errs, fallos[j])
+			continue
+		}
+		e.mu.Lock()
+		e.ultimo[claseEviccion(d)] = now
+		e.mu.Unlock()
+		// pause deja el contenedor con los topes: se revierten al cerrar
+		if modo := e.modo(d.Container); e.thr != nil && modo != EvictPause {
+			e.thr.Olvidar(context.WithoutCancel(ctx), d.Container.ID, "desalojado ("+modo+")")
+		}
+	}
+
+	return res, eventos, errors.Join(errs...)
+}
+
+// desalojar aplica a cada contenedor el modo que le toca y devuelve el
+// error de cada uno (nil = desalojado). En kill primero manda SIGTERM a
+// todos y espera a todos a la vez, así la gracia se paga una sola vez por
+// corrida. El desalojo ya empezado se completa aunque ctx se cancele; solo
+// se acorta la gracia.
+func (e *Evictor) desalojar(ctx context.Context, ds []PolicyDecision) ([]EventoEliminacion, []error) {
+	actx := context.WithoutCancel(ctx)
+	fallos := make([]error, len(ds))
+
+	var (
+		eventos []EventoEliminacion
+		matar   []int
+	)
+	for i, d := range ds {
+		accion := EventoTerm
+		switch e.modo(d.Container) {
+		case EvictPause:
+			accion = EventoPause
+		case EvictLimit:
+			accion = EventoLimit
+		}
+		ev := ejecutarEliminacion(actx, e.rt, e.pol, d, accion)
+		eventos = append(eventos, ev)
+		if fallos[i] = ev.Err; ev.Err != nil {
+			continue
+		}
+		switch accion {
+		case EventoTerm:
+			matar = append(matar, i)
+		case EventoPause, EventoLimit:
+			e.mu.Lock()
+			if accion == EventoLimit {
+				e.limitados[d.Container.ID] = true
+			}
+			e.retenidos[d.Container.ID] = time.Now()
+			e.mu.Unlock()
+		}
+	}
+
+	// kill: una sola gracia para todos, SIGKILL a los que siguen y rm
+	var escalar []int
+	for _, i := range e.esperarTodos(ctx, ds, matar, time.Now().Add(e.pol.Eviction.Grace)) {
+		ev := ejecutarEliminacion(actx, e.rt, e.pol, ds[i], EventoKill)
+		eventos = append(eventos, ev)
+		if fallos[i] = ev.Err; ev.Err == nil {
+			escalar = append(escalar, i)
+		}
+	}
+	// después de SIGKILL el runtime tarda poco en marcarlo exited
+	for _, i := range e.esperarTodos(actx, ds, escalar, time.Now().Add(5*time.Second)) {
+		fallos[i] = fmt.Errorf("%s sigue corriendo después de SIGKILL", shortID(ds[i].Container.ID))
+	}
+	for _, i := range matar {
+		if fallos[i] != nil {
+			continue
+		}
+		ev := ejecutarEliminacion(actx, e.rt, e.pol, ds[i], EventoRm)
+		eventos = append(eventos, ev)
+		fallos[i] = ev.Err
+	}
+	return eventos, fallos
+}
+
+// esperarTodos espera a la vez que terminen los contenedores ds[idx] hasta
+// limite y devuelve los índices de los que siguen corriendo.
+func (e *Evictor) esperarTodos(ctx context.Context, ds []PolicyDecision, idx []int, limite time.Time) []int {
+	fin := make([]bool, len(idx))
+	var wg sync.WaitGroup
+	for j, i := range idx {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fin[j] = e.esperarFin(ctx, ds[i].Container.ID, limite)
+		}()
+	}
+	wg.Wait()
+
+	var siguen []int
+	for j, i := range idx {
+		if !fin[j] {
+			siguen = append(siguen, i)
+		}
+	}
+	return siguen
+}
+
+// esperarFin consulta el estado hasta que el contenedor deje de correr o
+// llegue limite. Si ctx se cancela (cierre del daemon) deja de esperar.
+func (e *Evictor) esperarFin(ctx context.Context, id string, limite time.Time) bool {
+	for {
+		st, err := e.rt.State(context.WithoutCancel(ctx), id)
+		if err == nil && st != "running" && st != "paused" {
+			return true
+		}
+		if !time.Now().Before(limite) {
+			return false
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(min(e.sondeo, time.Until(limite))):
+		}
+	}
+}
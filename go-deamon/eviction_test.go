@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+// corridaEvictor lista los contenedores del runtime con sus stats y corre
+// una vez Marcar + EvaluatePolicy + Aplicar, como EnforceContainerPolicy.
+func corridaEvictor(t *testing.T, e *Evictor, rt *FakeRuntime) ([]PolicyDecision, []EventoEliminacion, error) {
+	t.Helper()
+	ctx := context.Background()
+	cs, err := rt.ListRunning(ctx, e.pol.OwnerLabels()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats, _ := rt.Stats(ctx)
+	for i := range cs {
+		for _, s := range stats {
+			if s.ID == cs[i].ID {
+				cs[i].MemBytes = s.MemBytes
+			}
+		}
+	}
+	e.Marcar(ctx, cs)
+	return e.Aplicar(ctx, EvaluatePolicy(e.pol, cs), false)
+}
+
+func nuevoEvictor(rt *FakeRuntime, pol *Policy, cs ...Container) *Evictor {
+	for _, c := range cs {
+		rt.Add(c, true)
+	}
+	e := NewEvictor(rt, pol, nil)
+	e.sondeo = 5 * time.Millisecond
+	return e
+}
+
+func accionesEventos(evs []EventoEliminacion) []string {
+	var res []string
+	for _, ev := range evs {
+		res = append(res, ev.Decision.Container.ID+" "+ev.Accion)
+	}
+	return res
+}
+
+// cinco de clase bajo con keep=3: sobran b4 y b5
+func cincoBajo(extra ...string) []Container {
+	return []Container{
+		contenedor("b1", "bajo", 10, extra...), contenedor("b2", "bajo", 20, extra...),
+		contenedor("b3", "bajo", 30, extra...), contenedor("b4", "bajo", 40, extra...),
+		contenedor("b5", "bajo", 50, extra...),
+	}
+}
+
+func TestEvictorEscalada(t *testing.T) {
+	cases := []struct {
+		name    string
+		ignora  []string // no terminan con SIGTERM
+		eventos []string
+	}{
+		{
+			name:    "terminan con SIGTERM",
+			eventos: []string{"b5 sigterm", "b4 sigterm", "b5 rm", "b4 rm"},
+		},
+		{
+			name:    "uno necesita SIGKILL",
+			ignora:  []string{"b4"},
+			eventos: []string{"b5 sigterm", "b4 sigterm", "b4 sigkill", "b5 rm", "b4 rm"},
+		},
+		{
+			name:    "los dos necesitan SIGKILL",
+			ignora:  []string{"b4", "b5"},
+			eventos: []string{"b5 sigterm", "b4 sigterm", "b5 sigkill", "b4 sigkill", "b5 rm", "b4 rm"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			pol := DefaultPolicy()
+			pol.Eviction.Grace = 100 * time.Millisecond
+			rt := NewFakeRuntime()
+			e := nuevoEvictor(rt, pol, cincoBajo()...)
+			for _, id := range tc.ignora {
+				rt.IgnoreTerm[id] = true
+			}
+
+			inicio := time.Now()
+			_, evs, err := corridaEvictor(t, e, rt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := accionesEventos(evs); !slices.Equal(got, tc.eventos) {
+				t.Errorf("eventos %v, se esperaba %v", got, tc.eventos)
+			}
+			// la gracia es una sola para todos los de la corrida
+			if d := time.Since(inicio); len(tc.ignora) > 0 && d >= 2*pol.Eviction.Grace {
+				t.Errorf("la corrida tardó %s: se esperó la gracia más de una vez", d)
+			}
+			if removed := slices.Sorted(slices.Values(rt.Removed)); !slices.Equal(removed, []string{"b4", "b5"}) {
+				t.Errorf("borrados %v", removed)
+			}
+		})
+	}
+}
+
+func TestEvictorPresupuesto(t *testing.T) {
+	cases := []struct {
+		name       string
+		maxPerTick int
+		borrados   []string
+		pospuestos []string
+	}{
+		{name: "sin límite", maxPerTick: 0, borrados: []string{"b4", "b5"}},
+		{name: "uno por corrida", maxPerTick: 1, borrados: []string{"b5"}, pospuestos: []string{"b4"}},
+		{name: "límite holgado", maxPerTick: 5, borrados: []string{"b4", "b5"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			pol := DefaultPolicy()
+			pol.Eviction.Grace, pol.Eviction.MaxPerTick = 0, tc.maxPerTick
+			rt := NewFakeRuntime()
+			e := nuevoEvictor(rt, pol, cincoBajo()...)
+
+			ds, _, err := corridaEvictor(t, e, rt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if removed := slices.Sorted(slices.Values(rt.Removed)); !slices.Equal(removed, tc.borrados) {
+				t.Errorf("borrados %v, se esperaba %v", removed, tc.borrados)
+			}
+			acc := acciones(ds)
+			for _, id := range tc.pospuestos {
+				if acc[id] != AccionPospuesto {
+					t.Errorf("%s: acción %q, se esperaba %q", id, acc[id], AccionPospuesto)
+				}
+			}
+		})
+	}
+}
+
+func TestEvictorPresupuestoDryRun(t *testing.T) {
+	pol := DefaultPolicy()
+	pol.Eviction.MaxPerTick = 1
+	rt := NewFakeRuntime()
+	cs := cincoBajo()
+	e := nuevoEvictor(rt, pol, cs...)
+
+	ds, evs, err := e.Aplicar(context.Background(), EvaluatePolicy(pol, cs), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	acc := acciones(ds)
+	if len(evs) != 0 || len(rt.Signals) != 0 {
+		t.Errorf("dry-run ejecutó %v", accionesEventos(evs))
+	}
+	if acc["b5"] != AccionEliminar || acc["b4"] != AccionPospuesto {
+		t.Errorf("b5=%q b4=%q", acc["b5"], acc["b4"])
+	}
+}
+
+func TestEvictorPausaYLimite(t *testing.T) {
+	cases := []struct {
+		name   string
+		modo   string
+		accion string
+	}{
+		{name: "pause", modo: EvictPause, accion: EventoPause},
+		{name: "limit", modo: EvictLimit, accion: EventoLimit},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			pol := DefaultPolicy()
+			pol.Eviction.Mode = tc.modo
+			pol.Eviction.Limit.MemoryMB = 64
+			pol.Eviction.TTL = 0
+			rt := NewFakeRuntime()
+			e := nuevoEvictor(rt, pol, cincoBajo()...)
+
+			_, evs, err := corridaEvictor(t, e, rt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := []string{"b5 " + tc.accion, "b4 " + tc.accion}
+			if got := accionesEventos(evs); !slices.Equal(got, want) {
+				t.Fatalf("eventos %v, se esperaba %v", got, want)
+			}
+			if len(rt.Removed) != 0 || len(rt.Signals) != 0 {
+				t.Fatalf("modo %s mató contenedores: %v", tc.modo, rt.Signals)
+			}
+			if tc.modo == EvictLimit {
+				if lim := rt.Updated["b5"]; lim.Memory != 64<<20 || lim.MemorySwap != 64<<20 {
+					t.Errorf("update de b5: %+v", lim)
+				}
+			}
+
+			// en la corrida siguiente ya no cuentan para el keep ni se
+			// vuelven a desalojar
+			ds, evs, err := corridaEvictor(t, e, rt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(evs) != 0 {
+				t.Errorf("segunda corrida: eventos %v", accionesEventos(evs))
+			}
+			acc := acciones(ds)
+			if acc["b4"] != AccionIgnorado || acc["b5"] != AccionIgnorado || acc["b3"] != AccionConservar {
+				t.Errorf("segunda corrida: %v", acc)
+			}
+		})
+	}
+}
+
+func TestEvictorTTL(t *testing.T) {
+	pol := DefaultPolicy()
+	pol.Eviction.Mode, pol.Eviction.Grace, pol.Eviction.TTL = EvictPause, 0, 30*time.Millisecond
+	rt := NewFakeRuntime()
+	e := nuevoEvictor(rt, pol, cincoBajo()...)
+
+	if _, _, err := corridaEvictor(t, e, rt); err != nil {
+		t.Fatal(err)
+	}
+	if len(rt.Paused) != 2 {
+		t.Fatalf("pausados %v", rt.Paused)
+	}
+
+	// antes del ttl siguen pausados
+	if _, evs, err := corridaEvictor(t, e, rt); err != nil || len(evs) != 0 {
+		t.Fatalf("antes del ttl: eventos %v, err %v", accionesEventos(evs), err)
+	}
+
+	// vencido el ttl se matan (despausándolos antes del SIGTERM)
+	time.Sleep(pol.Eviction.TTL)
+	ds, evs, err := corridaEvictor(t, e, rt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"b5 sigterm", "b4 sigterm", "b5 rm", "b4 rm"}
+	if got := accionesEventos(evs); !slices.Equal(got, want) {
+		t.Errorf("eventos %v, se esperaba %v", got, want)
+	}
+	if unpaused := slices.Sorted(slices.Values(rt.Unpaused)); !slices.Equal(unpaused, []string{"b4", "b5"}) {
+		t.Errorf("despausados %v", unpaused)
+	}
+	if acc := acciones(ds); acc["b5"] != AccionEliminar {
+		t.Errorf("b5: acción %q", acc["b5"])
+	}
+}
+
+func TestEvictorTTLPresupuesto(t *testing.T) {
+	pol := DefaultPolicy()
+	pol.Eviction.Mode, pol.Eviction.Grace, pol.Eviction.TTL = EvictPause, 0, time.Millisecond
+	rt := NewFakeRuntime()
+	e := nuevoEvictor(rt, pol, cincoBajo()...)
+	if _, _, err := corridaEvictor(t, e, rt); err != nil {
+		t.Fatal(err)
+	}
+
+	// los vencidos cuentan para max_per_tick como cualquier desalojo
+	e.pol.Eviction.MaxPerTick = 1
+	time.Sleep(5 * time.Millisecond)
+	ds, _, err := corridaEvictor(t, e, rt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rt.Removed) != 1 {
+		t.Errorf("borrados %v, se esperaba uno", rt.Removed)
+	}
+	acc := acciones(ds)
+	if acc["b4"] != AccionPospuesto && acc["b5"] != AccionPospuesto {
+		t.Errorf("ninguno pospuesto: %v", acc)
+	}
+}
+
+func TestEvictorErrores(t *testing.T) {
+	pol := DefaultPolicy()
+	pol.Eviction.Grace = 0
+	rt := NewFakeRuntime()
+	e := nuevoEvictor(rt, pol, cincoBajo()...)
+	rt.Fail["kill:b5"] = errors.New("docker caído")
+
+	// el error de uno no frena al resto, ni actualiza su cooldown
+	_, evs, err := corridaEvictor(t, e, rt)
+	if err == nil {
+		t.Fatal("se esperaba el error de b5")
+	}
+	want := []string{"b5 sigterm", "b4 sigterm", "b4 rm"}
+	if got := accionesEventos(evs); !slices.Equal(got, want) {
+		t.Errorf("eventos %v, se esperaba %v", got, want)
+	}
+	if evs[0].Err == nil {
+		t.Error("el evento de b5 no lleva el error")
+	}
+	if !slices.Equal(rt.Removed, []string{"b4"}) {
+		t.Errorf("borrados %v", rt.Removed)
+	}
+}
+
+func TestEvictorNoPropio(t *testing.T) {
+	pol := DefaultPolicy()
+	pol.Eviction.Grace = 0
+	rt := NewFakeRuntime()
+	e := nuevoEvictor(rt, pol)
+
+	// una decisión que llega con un contenedor protegido no se ejecuta
+	d := PolicyDecision{Container: contenedor("p1", "bajo", 10, LabelProtect+"=true"), Action: AccionEliminar}
+	rt.Add(d.Container, true)
+	_, evs, err := e.Aplicar(context.Background(), []PolicyDecision{d}, false)
+	if !errors.Is(err, ErrNoPropio) {
+		t.Fatalf("err = %v, se esperaba ErrNoPropio", err)
+	}
+	if len(rt.Signals) != 0 || len(evs) != 1 {
+		t.Errorf("señales %v, eventos %v", rt.Signals, accionesEventos(evs))
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// De dónde salen SysInfo y ContInfo
+const (
+	FuenteKernel = "kernel" // solo los módulos (/proc/sysinfo_so1_*, /proc/continfo_so1_*)
+	FuenteProc   = "proc"   // solo userspace: /proc/[pid], /proc/meminfo y /sys/fs/cgroup
+	FuenteAuto   = "auto"   // el módulo si está cargado, si no /proc
+)
+
+// Fuente lee las mismas estructuras que exponen los módulos, ya sea de los
+// módulos o armándolas desde /proc, para correr donde no se puede insmod.
+type Fuente struct {
+	Modo         string
+	SysinfoProc  string
+	ContinfoProc string
+	ProcRoot     string
+	CgroupRoot   string
+	// unidades de utime/stime/CPU_Jiffies, iguales a las del módulo
+	CPUTimeHz int
+}
+
+func NewFuente(cfg *Config) *Fuente {
+	return &Fuente{
+		Modo:         cfg.Collector,
+		SysinfoProc:  cfg.SysinfoProc,
+		ContinfoProc: cfg.ContinfoProc,
+		ProcRoot:     cfg.ProcRoot,
+		CgroupRoot:   cfg.CgroupRoot,
+		CPUTimeHz:    cfg.CPUTimeHz,
+	}
+}
+
+// SysInfo devuelve la muestra y de dónde salió (kernel o proc).
+func (f *Fuente) SysInfo() (*SysInfo, string, error) {
+	if f.Modo != FuenteProc {
+		si, err := ReadSysInfo(f.SysinfoProc)
+		if err == nil || f.Modo == FuenteKernel || !errors.Is(err, fs.ErrNotExist) {
+			return si, FuenteKernel, err
+		}
+	}
+	si, err := f.procSysInfo()
+	return si, FuenteProc, err
+}
+
+// ContInfo devuelve la muestra y de dónde salió (kernel o proc).
+func (f *Fuente) ContInfo() (*ContInfo, string, error) {
+	if f.Modo != FuenteProc {
+		ci, err := ReadContainerInfo(f.ContinfoProc)
+		if err == nil || f.Modo == FuenteKernel || !errors.Is(err, fs.ErrNotExist) {
+			return ci, FuenteKernel, err
+		}
+	}
+	ci, err := f.procContInfo()
+	return ci, FuenteProc, err
+}
+
+// Check verifica los archivos de los módulos: en modo kernel que falte uno es
+// fatal; en auto solo se avisa qué colector va a leer de /proc.
+func (f *Fuente) Check() (avisos []string, err error) {
+	if f.Modo == FuenteProc {
+		return nil, nil
+	}
+	for _, p := range []string{f.SysinfoProc, f.ContinfoProc} {
+		if _, err := os.Stat(p); err != nil {
+			if f.Modo == FuenteKernel {
+				return nil, fmt.Errorf("no existe %s (¿módulo cargado?)", p)
+			}
+			avisos = append(avisos, fmt.Sprintf("no existe %s, se usa /proc en su lugar", p))
+		}
+	}
+	return avisos, nil
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Colector en userspace: arma SysInfo y ContInfo con los mismos criterios
+// que los módulos (ver modulo-kernel/) para que los lotes sean comparables.
+
+// userHZ es sysconf(_SC_CLK_TCK): unidades de utime/stime en /proc/[pid]/stat.
+// Es 100 en todas las arquitecturas que usamos.
+const userHZ = 100
+
+// cmdlineMax igual que MAX_CMDLINE_LENGTH del módulo sysinfo
+const cmdlineMax = 256
+
+// procPID es lo que se saca de /proc/[pid]/{stat,status,cmdline}.
+type procPID struct {
+	pid     int
+	comm    string
+	ticks   uint64 // utime+stime en clock ticks
+	utime   uint64
+	stime   uint64
+	vszKB   uint64
+	rssKB   uint64
+	tieneMM bool // los hilos del kernel y los zombies no tienen VmSize
+}
+
+func (f *Fuente) procSysInfo() (*SysInfo, error) {
+	total, free, err := f.leerMeminfo()
+	if err != nil {
+		return nil, err
+	}
+	uptime, err := f.leerUptime()
+	if err != nil {
+		return nil, err
+	}
+	ncpu := f.contarCPUs()
+
+	pids, err := f.listarPIDs()
+	if err != nil {
+		return nil, err
+	}
+
+	si := &SysInfo{Totalram: total, Freeram: free, Processes: make([]Process, 0, len(pids))}
+	for _, pid := range pids {
+		pp, err := f.leerPID(pid)
+		if err != nil {
+			continue // terminó entre el ReadDir y la lectura
+		}
+
+		p := Process{
+			PID:     pid,
+			Name:    pp.comm,
+			Cmdline: "N/A",
+			VSZ:     pp.vszKB,
+			RSS:     pp.rssKB,
+			UTime:   f.aCPUTimeHz(pp.utime),
+			STime:   f.aCPUTimeHz(pp.stime),
+		}
+		if pp.tieneMM {
+			p.Cmdline = f.leerCmdline(pid)
+			if total > 0 {
+				// un decimal, como el módulo
+				p.MemoryUsage = float64(pp.rssKB*1000/total) / 10
+			}
+		}
+		// tiempo de CPU sobre el uptime del sistema, repartido entre CPUs
+		if uptime > 0 && ncpu > 0 {
+			pct := float64(pp.ticks) / userHZ / uptime * 100 / float64(ncpu)
+			p.CPUUsage = float64(int64(pct*100)) / 100
+		}
+		si.Processes = append(si.Processes, p)
+	}
+	si.Procs = len(si.Processes)
+	return si, nil
+}
+
+// procContInfo recorre el cgroup v2 buscando cgroups de contenedores
+// (docker, containerd, kubepods) y suma RSS y CPU de sus procesos.
+func (f *Fuente) procContInfo() (*ContInfo, error) {
+	root, err := f.cgroupV2Root()
+	if err != nil {
+		return nil, err
+	}
+
+	porID := map[string]*ContainerEntry{}
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			return nil // cgroup borrado mientras se recorría
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		rel := "/" + strings.TrimPrefix(strings.TrimPrefix(path, root), "/")
+		if !(strings.Contains(rel, "docker") || strings.Contains(rel, "containerd") || strings.Contains(rel, "kubepods")) {
+			return nil
+		}
+		pids, err := leerCgroupProcs(filepath.Join(path, "cgroup.procs"))
+		if err != nil || len(pids) == 0 {
+			return nil
+		}
+
+		id := extraerContainerID(rel)
+		if id == "" {
+			id = fmt.Sprintf("path:%d", djb2(rel))
+		}
+		e := porID[id]
+		if e == nil {
+			e = &ContainerEntry{ContainerID: id, CgroupPath: rel}
+			porID[id] = e
+		}
+		for _, pid := range pids {
+			pp, err := f.leerPID(pid)
+			if err != nil {
+				continue
+			}
+			e.RSSKB += pp.rssKB
+			e.CPUJiffies += f.aCPUTimeHz(pp.ticks)
+			e.Procs++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("recorriendo %s: %w", root, err)
+	}
+
+	ci := &ContInfo{Containers: make([]ContainerEntry, 0, len(porID))}
+	for _, e := range porID {
+		ci.Containers = append(ci.Containers, *e)
+	}
+	sort.Slice(ci.Containers, func(i, j int) bool { return ci.Containers[i].ContainerID < ci.Containers[j].ContainerID })
+	ci.Count = len(ci.Containers)
+	return ci, nil
+}
+
+// cgroupV2Root acepta el montaje unificado o el híbrido (/sys/fs/cgroup/unified).
+func (f *Fuente) cgroupV2Root() (string, error) {
+	for _, r := range []string{f.CgroupRoot, filepath.Join(f.CgroupRoot, "unified")} {
+		if _, err := os.Stat(filepath.Join(r, "cgroup.controllers")); err == nil {
+			return r, nil
+		}
+	}
+	return "", fmt.Errorf("no hay cgroup v2 montado en %s", f.CgroupRoot)
+}
+
+func (f *Fuente) aCPUTimeHz(ticks uint64) uint64 {
+	return ticks * uint64(f.CPUTimeHz) / userHZ
+}
+
+func (f *Fuente) listarPIDs() ([]int, error) {
+	ents, err := os.ReadDir(f.ProcRoot)
+	if err != nil {
+		return nil, err
+	}
+	pids := make([]int, 0, len(ents))
+	for _, e := range ents {
+		if pid, err := strconv.Atoi(e.Name()); err == nil && e.IsDir() {
+			pids = append(pids, pid)
+		}
+	}
+	sort.Ints(pids)
+	return pids, nil
+}
+
+func (f *Fuente) leerPID(pid int) (procPID, error) {
+	dir := filepath.Join(f.ProcRoot, strconv.Itoa(pid))
+	pp := procPID{pid: pid}
+
+	b, err := os.ReadFile(filepath.Join(dir, "stat"))
+	if err != nil {
+		return pp, err
+	}
+	// comm va entre paréntesis y puede tener espacios o ')'
+	s := string(b)
+	i, j := strings.IndexByte(s, '('), strings.LastIndexByte(s, ')')
+	if i < 0 || j < i {
+		return pp, fmt.Errorf("%s/stat: formato inválido", dir)
+	}
+	pp.comm = s[i+1 : j]
+	campos := strings.Fields(s[j+1:])
+	// campos[0] es el 3 (state); utime y stime son el 14 y 15
+	if len(campos) < 13 {
+		return pp, fmt.Errorf("%s/stat: faltan campos", dir)
+	}
+	pp.utime, _ = strconv.ParseUint(campos[11], 10, 64)
+	pp.stime, _ = strconv.ParseUint(campos[12], 10, 64)
+	pp.ticks = pp.utime + pp.stime
+
+	st, err := os.Open(filepath.Join(dir, "status"))
+	if err != nil {
+		return pp, err
+	}
+	defer st.Close()
+	sc := bufio.NewScanner(st)
+	for sc.Scan() {
+		k, v, ok := strings.Cut(sc.Text(), ":")
+		if !ok {
+			continue
+		}
+		switch k {
+		case "VmSize":
+			pp.vszKB, pp.tieneMM = parseKB(v), true
+		case "VmRSS":
+			pp.rssKB = parseKB(v)
+		}
+	}
+	return pp, sc.Err()
+}
+
+// leerCmdline imita get_process_cmdline del módulo: máximo 255 bytes,
+// argumentos separados por espacio y sin espacios al final.
+func (f *Fuente) leerCmdline(pid int) string {
+	b, err := os.ReadFile(filepath.Join(f.ProcRoot, strconv.Itoa(pid), "cmdline"))
+	if err != nil {
+		return "N/A"
+	}
+	if len(b) > cmdlineMax-1 {
+		b = b[:cmdlineMax-1]
+	}
+	b = bytes.ReplaceAll(b, []byte{0}, []byte{' '})
+	return strings.TrimRight(string(b), " ")
+}
+
+func (f *Fuente) leerMeminfo() (total, free uint64, err error) {
+	fh, err := os.Open(filepath.Join(f.ProcRoot, "meminfo"))
+	if err != nil {
+		return 0, 0, err
+	}
+	defer fh.Close()
+
+	sc := bufio.NewScanner(fh)
+	for sc.Scan() {
+		k, v, ok := strings.Cut(sc.Text(), ":")
+		if !ok {
+			continue
+		}
+		switch k {
+		case "MemTotal":
+			total = parseKB(v)
+		case "MemFree":
+			free = parseKB(v)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return 0, 0, err
+	}
+	if total == 0 {
+		return 0, 0, fmt.Errorf("%s/meminfo sin MemTotal", f.ProcRoot)
+	}
+	return total, free, nil
+}
+
+func (f *Fuente) leerUptime() (float64, error) {
+	b, err := os.ReadFile(filepath.Join(f.ProcRoot, "uptime"))
+	if err != nil {
+		return 0, err
+	}
+	campos := strings.Fields(string(b))
+	if len(campos) == 0 {
+		return 0, fmt.Errorf("%s/uptime vacío", f.ProcRoot)
+	}
+	return strconv.ParseFloat(campos[0], 64)
+}
+
+// contarCPUs cuenta las líneas cpuN de /proc/stat (num_online_cpus).
+func (f *Fuente) contarCPUs() int {
+	b, err := os.ReadFile(filepath.Join(f.ProcRoot, "stat"))
+	if err != nil {
+		return 1
+	}
+	n := 0
+	for _, l := range strings.Split(string(b), "\n") {
+		if strings.HasPrefix(l, "cpu") && len(l) > 3 && l[3] >= '0' && l[3] <= '9' {
+			n++
+		}
+	}
+	if n == 0 {
+		return 1
+	}
+	return n
+}
+
+func leerCgroupProcs(path string) ([]int, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var pids []int
+	for _, l := range strings.Fields(string(b)) {
+		if pid, err := strconv.Atoi(l); err == nil {
+			pids = append(pids, pid)
+		}
+	}
+	return pids, nil
+}
+
+// parseKB lee valores de /proc tipo "   1234 kB".
+func parseKB(v string) uint64 {
+	campos := strings.Fields(v)
+	if len(campos) == 0 {
+		return 0
+	}
+	n, _ := strconv.ParseUint(campos[0], 10, 64)
+	return n
+}
+
+// extraerContainerID busca la primera corrida de 64 caracteres hex del path
+// (extract_container_hex_id en continfo.c).
+func extraerContainerID(path string) string {
+	run := 0
+	for i := 0; i < len(path); i++ {
+		if isHex(path[i]) {
+			run++
+			if run == 64 {
+				return path[i-63 : i+1]
+			}
+		} else {
+			run = 0
+		}
+	}
+	return ""
+}
+
+func isHex(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+// djb2 igual que id_hash de continfo.c (IDs "path:N" comparables).
+func djb2(s string) uint32 {
+	h := uint32(5381)
+	for i := 0; i < len(s); i++ {
+		h = h<<5 + h + uint32(s[i])
+	}
+	return h
+}
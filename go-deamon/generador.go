@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Generador reemplaza a bash/crear_contenedores.sh: en cada ronda crea
+// Cantidad contenedores eligiendo la imagen por peso. Con la misma semilla
+// la ronda elige las mismas imágenes y los mismos nombres.
+type Generador struct {
+	Cantidad int `yaml:"cantidad"` // contenedores por ronda
+	// Plantilla del nombre: {i} (1..cantidad), {ronda}, {clase}, {imagen},
+	// {rand} (0-32767, como $RANDOM)
+	Nombre   string            `yaml:"nombre"`
+	Labels   map[string]string `yaml:"labels"` // se suman a los de dueño
+	Imagenes []GenImagen       `yaml:"imagenes"`
+}
+
+type GenImagen struct {
+	Clase  string            `yaml:"clase"`
+	Imagen string            `yaml:"imagen"`
+	Peso   float64           `yaml:"peso"`
+	Env    map[string]string `yaml:"env"` // ej. CPU_WORKERS, RAM_MB
+}
+
+// Labels que pone el generador: marcan que el contenedor es del daemon y
+// su clase, que es lo que usa la política por defecto. LabelProtect lo pone
+// el usuario (o labels del generador) para que el daemon no lo toque.
+const (
+	LabelOwner   = "so1.owner"
+	LabelClase   = "so1.clase"
+	LabelRonda   = "so1.ronda"
+	LabelProtect = "so1.protect"
+	OwnerDaemon  = "so1-daemon"
+)
+
+// DefaultGenerador es lo que hacía el script: 10 por ronda, las tres
+// imágenes con la misma probabilidad.
+func DefaultGenerador() *Generador {
+	return &Generador{
+		Cantidad: 10,
+		Nombre:   "contenedor_{i}_{rand}",
+		Imagenes: []GenImagen{
+			{Clase: "bajo", Imagen: "img_bajo", Peso: 1},
+			{Clase: "cpu", Imagen: "img_cpu", Peso: 1},
+			{Clase: "ram", Imagen: "img_ram", Peso: 1},
+		},
+	}
+}
+
+func LoadGenerador(path string) (*Generador, error) {
+	if path == "" {
+		return DefaultGenerador(), nil
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("no se pudo leer el generador %s: %w", path, err)
+	}
+
+	var g Generador
+	dec := yaml.NewDecoder(bytes.NewReader(raw))
+	dec.KnownFields(true)
+	if err := dec.Decode(&g); err != nil {
+		return nil, fmt.Errorf("generador %s inválido: %w", path, err)
+	}
+	if g.Nombre == "" {
+		g.Nombre = DefaultGenerador().Nombre
+	}
+
+	if err := g.Validate(); err != nil {
+		return nil, fmt.Errorf("generador %s inválido:\n%w", path, err)
+	}
+	return &g, nil
+}
+
+var reNombreContenedor = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+func (g *Generador) Validate() error {
+	var errs []error
+	add := func(where string, err error) {
+		errs = append(errs, fmt.Errorf("  %s: %w", where, err))
+	}
+
+	if g.Cantidad <= 0 {
+		add("cantidad", fmt.Errorf("debe ser > 0 (%d)", g.Cantidad))
+	}
+	// sin {i} dos contenedores de la misma ronda pueden chocar de nombre
+	if !strings.Contains(g.Nombre, "{i}") {
+		add("nombre", fmt.Errorf("%q debe incluir {i}", g.Nombre))
+	}
+	for k := range g.Labels {
+		if k == LabelOwner || k == LabelClase || k == LabelRonda {
+			add("labels", fmt.Errorf("%s lo pone el generador", k))
+		}
+	}
+
+	if len(g.Imagenes) == 0 {
+		add("imagenes", errors.New("debe haber al menos una imagen"))
+	}
+	total := 0.0
+	seen := map[string]bool{}
+	for i, im := range g.Imagenes {
+		where := fmt.Sprintf("imagenes[%d]", i)
+		switch {
+		case im.Clase == "":
+			add(where, errors.New("clase vacía"))
+		case seen[im.Clase]:
+			add(where, fmt.Errorf("clase %q repetida", im.Clase))
+		}
+		seen[im.Clase] = true
+		if im.Imagen == "" {
+			add(where, errors.New("imagen vacía"))
+		}
+		if im.Peso < 0 {
+			add(where, fmt.Errorf("peso negativo (%g)", im.Peso))
+		}
+		total += im.Peso
+	}
+	if len(g.Imagenes) > 0 && total <= 0 {
+		add("imagenes", errors.New("la suma de los pesos debe ser > 0"))
+	}
+
+	// la plantilla tiene que dar nombres que docker acepte
+	if len(errs) == 0 {
+		for _, c := range g.Plan(1, 1) {
+			if !reNombreContenedor.MatchString(c.Nombre) {
+				add("nombre", fmt.Errorf("%q no es un nombre de contenedor válido", c.Nombre))
+				break
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// GenContenedor es un contenedor planeado para la ronda.
+type GenContenedor struct {
+	Orden  int               `json:"orden"`
+	Nombre string            `json:"nombre"`
+	Clase  string            `json:"clase"`
+	Imagen string            `json:"imagen"`
+	Env    map[string]string `json:"env,omitempty"`
+	Labels map[string]string `json:"labels"`
+}
+
+// Plan decide la ronda sin tocar docker: solo depende de la semilla, el
+// número de ronda y el generador.
+func (g *Generador) Plan(ronda, seed int64) []GenContenedor {
+	rng := rand.New(rand.NewPCG(uint64(seed), 0))
+	total := 0.0
+	for _, im := range g.Imagenes {
+		total += im.Peso
+	}
+
+	plan := make([]GenContenedor, 0, g.Cantidad)
+	for i := 1; i <= g.Cantidad; i++ {
+		im := g.elegir(rng.Float64() * total)
+
+		nombre := strings.NewReplacer(
+			"{i}", strconv.Itoa(i),
+			"{ronda}", strconv.FormatInt(ronda, 10),
+			"{clase}", im.Clase,
+			"{imagen}", nombreSeguro(im.Imagen),
+			"{rand}", strconv.Itoa(rng.IntN(32768)),
+		).Replace(g.Nombre)
+
+		labels := map[string]string{}
+		for k, v := range g.Labels {
+			labels[k] = v
+		}
+		labels[LabelOwner] = OwnerDaemon
+		labels[LabelClase] = im.Clase
+		labels[LabelRonda] = strconv.FormatInt(ronda, 10)
+
+		plan = append(plan, GenContenedor{
+			Orden: i, Nombre: nombre, Clase: im.Clase, Imagen: im.Imagen,
+			Env: im.Env, Labels: labels,
+		})
+	}
+	return plan
+}
+
+// elegir devuelve la imagen en la que cae x dentro de [0, suma de pesos).
+func (g *Generador) elegir(x float64) GenImagen {
+	for _, im := range g.Imagenes {
+		if x < im.Peso {
+			return im
+		}
+		x -= im.Peso
+	}
+	// redondeo: la última con peso
+	for i := len(g.Imagenes) - 1; i >= 0; i-- {
+		if g.Imagenes[i].Peso > 0 {
+			return g.Imagenes[i]
+		}
+	}
+	return g.Imagenes[len(g.Imagenes)-1]
+}
+
+var reNoNombre = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// nombreSeguro deja "registry/img:tag" como "registry_img_tag".
+func nombreSeguro(s string) string {
+	return reNoNombre.ReplaceAllString(s, "_")
+}
+
+// semillaRonda: con base 0 cada ronda es aleatoria; con base fija la
+// semilla sale de (base, ronda), así las rondas difieren entre sí pero se
+// repiten al volver a correr con la misma base.
+func semillaRonda(base, ronda int64) int64 {
+	if base == 0 {
+		return rand.Int64N(1<<62) + 1
+	}
+	return int64(rand.New(rand.NewPCG(uint64(base), uint64(ronda))).Uint64() >> 1)
+}
+
+// GenResultado es un contenedor de la ronda después de docker run.
+type GenResultado struct {
+	GenContenedor
+	Ts  time.Time
+	ID  string
+	Err error
+}
+
+type RondaGenerador struct {
+	ID         int64
+	Inicio     time.Time
+	Fin        time.Time
+	Seed       int64
+	Resultados []GenResultado
+}
+
+func (r *RondaGenerador) Conteo() (creados, fallidos int) {
+	for _, res := range r.Resultados {
+		if res.Err != nil {
+			fallidos++
+		} else {
+			creados++
+		}
+	}
+	return creados, fallidos
+}
+
+// EjecutarRonda registra la ronda en la DB, crea los contenedores uno por
+// uno (un fallo no corta la ronda) y guarda el resultado. seed recibe el
+// número de ronda y devuelve la semilla a usar. El avance va a w con el
+// formato del script.
+func (g *Generador) EjecutarRonda(ctx context.Context, rt ContainerRuntime, seed func(ronda int64) int64, w io.Writer) (*RondaGenerador, error) {
+	r := &RondaGenerador{Inicio: time.Now().UTC()}
+	id, err := NuevaRondaGenerador(ctx, r.Inicio, g.Cantidad)
+	if err != nil {
+		return nil, fmt.Errorf("registrar ronda: %w", err)
+	}
+	r.ID, r.Seed = id, seed(id)
+
+	fmt.Fprintf(w, "Ronda %d: generando %d contenedores (seed %d)...\n", r.ID, g.Cantidad, r.Seed)
+	for _, c := range g.Plan(r.ID, r.Seed) {
+		res := GenResultado{GenContenedor: c, Ts: time.Now().UTC()}
+		res.ID, res.Err = rt.Run(ctx, RunSpec{Name: c.Nombre, Image: c.Imagen, Env: c.Env, Labels: c.Labels})
+		if res.Err != nil {
+			fmt.Fprintf(w, "[%d] ERROR %s usando %s: %v\n", c.Orden, c.Nombre, c.Imagen, res.Err)
+		} else {
+			fmt.Fprintf(w, "[%d] Contenedor creado: %s usando %s\n", c.Orden, c.Nombre, c.Imagen)
+		}
+		r.Resultados = append(r.Resultados, res)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	r.Fin = time.Now().UTC()
+
+	// aunque ctx se haya cancelado, lo que se creó tiene que quedar registrado
+	if err := CerrarRondaGenerador(context.WithoutCancel(ctx), r); err != nil {
+		return r, fmt.Errorf("guardar ronda %d: %w", r.ID, err)
+	}
+
+	creados, fallidos := r.Conteo()
+	fmt.Fprintf(w, "Ronda %d finalizada: %d creados, %d fallidos.\n", r.ID, creados, fallidos)
+	switch {
+	case ctx.Err() != nil:
+		return r, ctx.Err()
+	case fallidos > 0:
+		return r, fmt.Errorf("ronda %d: %d de %d contenedores fallaron", r.ID, fallidos, len(r.Resultados))
+	}
+	return r, nil
+}
+
+// generadorJob es el job del scheduler interno con cron_job generador.
+func generadorJob(g *Generador, rt ContainerRuntime, base int64) CronJob {
+	return func(ctx context.Context, w io.Writer) error {
+		_, err := g.EjecutarRonda(ctx, rt, func(ronda int64) int64 { return semillaRonda(base, ronda) }, w)
+		return err
+	}
+}
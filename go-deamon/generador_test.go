@@ -0,0 +1,85 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGeneradorPlanDeterminista(t *testing.T) {
+	g := DefaultGenerador()
+	g.Nombre = "so1_{ronda}_{i}_{clase}_{rand}"
+	g.Labels = map[string]string{"equipo": "so1"}
+
+	cases := []struct {
+		name         string
+		ronda1, sem1 int64
+		ronda2, sem2 int64
+		iguales      bool
+	}{
+		{name: "misma ronda y semilla", ronda1: 7, sem1: 42, ronda2: 7, sem2: 42, iguales: true},
+		{name: "otra semilla", ronda1: 7, sem1: 42, ronda2: 7, sem2: 43},
+		{name: "otra ronda", ronda1: 7, sem1: 42, ronda2: 8, sem2: 42},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			a, b := g.Plan(tc.ronda1, tc.sem1), g.Plan(tc.ronda2, tc.sem2)
+			if len(a) != g.Cantidad || len(b) != g.Cantidad {
+				t.Fatalf("planes de %d y %d, se esperaban %d", len(a), len(b), g.Cantidad)
+			}
+			if got := reflect.DeepEqual(a, b); got != tc.iguales {
+				t.Fatalf("planes iguales=%v, se esperaba %v:\n%+v\n%+v", got, tc.iguales, a, b)
+			}
+		})
+	}
+
+	// la ronda solo cambia nombre y label so1.ronda: las imágenes salen de la semilla
+	a, b := g.Plan(7, 42), g.Plan(8, 42)
+	for i := range a {
+		if a[i].Imagen != b[i].Imagen || a[i].Clase != b[i].Clase {
+			t.Errorf("[%d] %s/%s vs %s/%s con la misma semilla", i, a[i].Clase, a[i].Imagen, b[i].Clase, b[i].Imagen)
+		}
+	}
+}
+
+func TestGeneradorPlanLabels(t *testing.T) {
+	g := DefaultGenerador()
+	g.Labels = map[string]string{"equipo": "so1"}
+
+	for i, c := range g.Plan(3, 99) {
+		if c.Orden != i+1 {
+			t.Errorf("orden %d en la posición %d", c.Orden, i)
+		}
+		want := map[string]string{"equipo": "so1", LabelOwner: OwnerDaemon, LabelClase: c.Clase, LabelRonda: "3"}
+		if !reflect.DeepEqual(c.Labels, want) {
+			t.Errorf("%s: labels %v, se esperaba %v", c.Nombre, c.Labels, want)
+		}
+	}
+	// el plan no comparte el mapa de labels del generador
+	if len(g.Labels) != 1 {
+		t.Errorf("Plan modificó g.Labels: %v", g.Labels)
+	}
+}
+
+func TestGeneradorPlanPesos(t *testing.T) {
+	g := DefaultGenerador()
+	g.Cantidad = 50
+	g.Imagenes[0].Peso, g.Imagenes[1].Peso, g.Imagenes[2].Peso = 0, 1, 0
+
+	for _, c := range g.Plan(1, 5) {
+		if c.Clase != g.Imagenes[1].Clase {
+			t.Fatalf("salió la clase %s con peso 0", c.Clase)
+		}
+	}
+}
+
+func TestSemillaRonda(t *testing.T) {
+	if semillaRonda(10, 1) != semillaRonda(10, 1) {
+		t.Error("con la misma base y ronda la semilla cambió")
+	}
+	if semillaRonda(10, 1) == semillaRonda(10, 2) {
+		t.Error("dos rondas con la misma semilla")
+	}
+	if s := semillaRonda(10, 1); s < 0 {
+		t.Errorf("semilla negativa %d", s)
+	}
+}
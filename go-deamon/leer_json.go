@@ -1,74 +1,144 @@
 package main
 
 import (
-	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
+	"io/fs"
 	"os"
 	"sort"
-	"time"
 	"strings"
-	"strconv"
+	"time"
 )
 
-const procPath = "/proc/sysinfo_so1_202300644"
+// runSysinfoCmd es el diagnóstico de /proc/sysinfo_so1_202300644
+// (`daemon sysinfo`): resumen, JSON o la vista interactiva (--tui).
+func runSysinfoCmd(args []string) int {
+	var (
+		tui   bool
+		every time.Duration
+	)
+	c, err := parseCmd("sysinfo", args, func(fs *flag.FlagSet) {
+		fs.BoolVar(&tui, "tui", false, "vista interactiva tipo top (se refresca sola)")
+		fs.DurationVar(&every, "every", 2*time.Second, "intervalo de refresco de la TUI")
+	})
+	if err != nil {
+		return cmdExit(err)
+	}
+	if every <= 0 {
+		return cmdExit(fmt.Errorf("--every debe ser > 0 (%s)", every))
+	}
+	path := c.cfg.SysinfoProc
+	fuente := NewFuente(c.cfg)
 
-type SysInfo struct {
-	Totalram   uint64    `json:"Totalram"`
-	Freeram    uint64    `json:"Freeram"`
-	Procs      int       `json:"Procs"`
-	Processes  []Process `json:"Processes"`
-}
+	if tui {
+		if err := runTUI(fuente, every); err != nil {
+			fmt.Printf("ERROR TUI: %v\n", err)
+			return 1
+		}
+		return 0
+	}
 
-type Process struct {
-	PID         int     `json:"PID"`
-	Name        string  `json:"Name"`
-	Cmdline     string  `json:"Cmdline"`
-	VSZ         uint64  `json:"vsz"`
-	RSS         uint64  `json:"rss"`
-	MemoryUsage float64 `json:"Memory_Usage"`
-	CPUUsage    float64 `json:"CPU_Usage"` // si lo sigues usando
-	UTime       uint64  `json:"utime"`
-	STime       uint64  `json:"stime"`
-	CPUPercent float64 `json:"-"`
-}
+	// sin módulo (o con --collector proc) no hay JSON crudo que diagnosticar
+	_, statErr := os.Stat(path)
+	if fuente.Modo == FuenteProc || (fuente.Modo == FuenteAuto && errors.Is(statErr, fs.ErrNotExist)) {
+		si, origen, err := fuente.SysInfo()
+		if err != nil {
+			return c.fail("sysinfo ("+origen+")", err)
+		}
+		cpuTotal, cpuErr := totalCPUPercent(500 * time.Millisecond)
+		r := sysinfoJSON(*si, cpuTotal, cpuErr)
+		r.Origen = origen
+		c.emit(r, func() { printSummary(fuente.ProcRoot+" (userspace)", *si, cpuTotal, cpuErr) })
+		return 0
+	}
 
-func main() {
-	raw, err := os.ReadFile(procPath)
+	raw, err := os.ReadFile(path)
 	if err != nil {
-		fmt.Printf("ERROR leyendo %s: %v\n", procPath, err)
-		os.Exit(1)
+		return c.fail("leyendo "+path, err)
 	}
 
-
 	clean := strings.TrimSpace(string(raw))
 
-	var si SysInfo
-	if err := json.Unmarshal([]byte(clean), &si); err != nil {
+	si, err := ReadSysInfo(path)
+	if err != nil {
+		if c.json {
+			return c.fail("JSON inválido", err)
+		}
 		fmt.Printf("ERROR: el contenido NO se pudo parsear como JSON válido.\n")
 		fmt.Printf("Causa: %v\n\n", err)
 		fmt.Println("TIP: revisa si Cmdline/Name tienen comillas sin escapar en el módulo.")
 		fmt.Println("Contenido (primeros 800 chars):")
 		fmt.Println(snippet(clean, 800))
-		os.Exit(1)
+		return 1
 	}
 
-	printSummary(si)
+	cpuTotal, cpuErr := totalCPUPercent(500 * time.Millisecond)
+	r := sysinfoJSON(*si, cpuTotal, cpuErr)
+	r.Origen = FuenteKernel
+	c.emit(r, func() { printSummary(path, *si, cpuTotal, cpuErr) })
+	return 0
 }
 
-func printSummary(si SysInfo) {
-	used := uint64(0)
+type sysinfoResumen struct {
+	Origen     string       `json:"origen"`
+	TotalRAMKB uint64       `json:"total_ram_kb"`
+	FreeRAMKB  uint64       `json:"free_ram_kb"`
+	UsedRAMKB  uint64       `json:"used_ram_kb"`
+	CPUTotal   *float64     `json:"cpu_total_pct"`
+	Procs      int          `json:"procs"`
+	Procesos   int          `json:"procesos_array"`
+	TopRAM     []apiProceso `json:"top_ram"`
+	TopCPU     []apiProceso `json:"top_cpu"`
+	Warning    string       `json:"warning,omitempty"`
+}
+
+func sysinfoJSON(si SysInfo, cpuTotal float64, cpuErr error) sysinfoResumen {
+	r := sysinfoResumen{
+		TotalRAMKB: si.Totalram,
+		FreeRAMKB:  si.Freeram,
+		UsedRAMKB:  usedRAM(si),
+		Procs:      si.Procs,
+		Procesos:   len(si.Processes),
+		TopRAM:     []apiProceso{},
+		TopCPU:     []apiProceso{},
+	}
+	if cpuErr == nil {
+		r.CPUTotal = &cpuTotal
+	}
+	for _, p := range topPor(si.Processes, 5, func(a, b Process) bool { return a.RSS > b.RSS }) {
+		r.TopRAM = append(r.TopRAM, toAPIProceso(p))
+	}
+	for _, p := range topPor(si.Processes, 5, func(a, b Process) bool { return a.CPUUsage > b.CPUUsage }) {
+		r.TopCPU = append(r.TopCPU, toAPIProceso(p))
+	}
+	if err := validate(si); err != nil {
+		r.Warning = err.Error()
+	}
+	return r
+}
+
+func usedRAM(si SysInfo) uint64 {
 	if si.Totalram >= si.Freeram {
-		used = si.Totalram - si.Freeram
+		return si.Totalram - si.Freeram
 	}
+	return 0
+}
 
-	fmt.Println("=== SYSINFO (/proc/sysinfo_so1_202300644) ===")
+// topPor devuelve los n primeros según less sin tocar el slice original.
+func topPor(procs []Process, n int, less func(a, b Process) bool) []Process {
+	top := append([]Process(nil), procs...)
+	sort.Slice(top, func(i, j int) bool { return less(top[i], top[j]) })
+	return top[:min(n, len(top))]
+}
+
+func printSummary(path string, si SysInfo, cpuTotal float64, cpuErr error) {
+	fmt.Printf("=== SYSINFO (%s) ===\n", path)
 	fmt.Printf("Total RAM (KB): %d\n", si.Totalram)
 	fmt.Printf("Free  RAM (KB): %d\n", si.Freeram)
-	fmt.Printf("Used  RAM (KB): %d\n", used)
-	cpuTotal, err := totalCPUPercent(500 * time.Millisecond)
-	if err != nil {
-		fmt.Printf("CPU Total (%%): N/A (%v)\n", err)
+	fmt.Printf("Used  RAM (KB): %d\n", usedRAM(si))
+	if cpuErr != nil {
+		fmt.Printf("CPU Total (%%): N/A (%v)\n", cpuErr)
 	} else {
 		fmt.Printf("CPU Total (%%): %.2f\n", cpuTotal)
 	}
@@ -76,30 +146,20 @@ func printSummary(si SysInfo) {
 	fmt.Println()
 
 
-	topMem := make([]Process, 0, len(si.Processes))
-	topMem = append(topMem, si.Processes...)
-	sort.Slice(topMem, func(i, j int) bool {
-		return topMem[i].RSS > topMem[j].RSS
-	})
+	topMem := topPor(si.Processes, 5, func(a, b Process) bool { return a.RSS > b.RSS })
 
 	fmt.Println("Top 5 por RAM (RSS KB):")
-	for i := 0; i < min(5, len(topMem)); i++ {
-		p := topMem[i]
+	for i, p := range topMem {
 		fmt.Printf("  #%d PID=%d Name=%s RSS=%dKB VSZ=%dKB Mem%%=%.1f Cmd=%s\n",
 			i+1, p.PID, p.Name, p.RSS, p.VSZ, p.MemoryUsage, safeOneLine(p.Cmdline, 60))
 	}
 	fmt.Println()
 
 	
-	topCPU := make([]Process, 0, len(si.Processes))
-	topCPU = append(topCPU, si.Processes...)
-	sort.Slice(topCPU, func(i, j int) bool {
-		return topCPU[i].CPUUsage > topCPU[j].CPUUsage
-	})
+	topCPU := topPor(si.Processes, 5, func(a, b Process) bool { return a.CPUUsage > b.CPUUsage })
 
 	fmt.Println("Top 5 por CPU (%):")
-	for i := 0; i < min(5, len(topCPU)); i++ {
-		p := topCPU[i]
+	for i, p := range topCPU {
 		fmt.Printf("  #%d PID=%d Name=%s CPU%%=%.2f RSS=%dKB Cmd=%s\n",
 			i+1, p.PID, p.Name, p.CPUUsage, p.RSS, safeOneLine(p.Cmdline, 60))
 	}
@@ -143,75 +203,3 @@ func safeOneLine(s string, max int) string {
 	}
 	return s
 }
-
-func min(a, b int) int {
-	if a < b {
-		return a
-	}
-	return b
-}
-
-func readCPUStat() (idle uint64, total uint64, err error) {
-	b, err := os.ReadFile("/proc/stat")
-	if err != nil {
-		return 0, 0, err
-	}
-	line := strings.SplitN(string(b), "\n", 2)[0] // primera línea: "cpu ..."
-	f := strings.Fields(line)
-	if len(f) < 8 || f[0] != "cpu" {
-		return 0, 0, fmt.Errorf("formato inválido en /proc/stat")
-	}
-
-	// cpu user nice system idle iowait irq softirq steal guest guest_nice...
-	var vals []uint64
-	for i := 1; i < len(f); i++ {
-		v, e := strconv.ParseUint(f[i], 10, 64)
-		if e != nil {
-			break
-		}
-		vals = append(vals, v)
-	}
-	if len(vals) < 5 {
-		return 0, 0, fmt.Errorf("no hay suficientes campos en /proc/stat")
-	}
-
-	idleAll := vals[3] // idle
-	if len(vals) > 4 {
-		idleAll += vals[4] // iowait
-	}
-
-	var tot uint64
-	for _, v := range vals {
-		tot += v
-	}
-
-	return idleAll, tot, nil
-}
-
-func totalCPUPercent(sample time.Duration) (float64, error) {
-	idle1, total1, err := readCPUStat()
-	if err != nil {
-		return 0, err
-	}
-	time.Sleep(sample)
-	idle2, total2, err := readCPUStat()
-	if err != nil {
-		return 0, err
-	}
-
-	if total2 <= total1 {
-		return 0, fmt.Errorf("delta total CPU inválido")
-	}
-
-	dTotal := float64(total2 - total1)
-	dIdle := float64(idle2 - idle1)
-
-	used := (dTotal - dIdle) / dTotal * 100.0
-	if used < 0 {
-		used = 0
-	}
-	if used > 100 {
-		used = 100
-	}
-	return used, nil
-}
\ No newline at end of file
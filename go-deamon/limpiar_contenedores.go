@@ -1,315 +1,425 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"errors"
 	"fmt"
-	"os/exec"
-	"regexp"
+	"io"
 	"sort"
-	"strconv"
-	"strings"
-)
-
-const (
-	lowImage = "img_bajo"
-	highCPU  = "img_cpu"
-	highRAM  = "img_ram"
-	keepLow  = 3
-	keepHigh = 2
+	"time"
 )
 
 type Container struct {
-	ID    string
-	Image string
-	Name  string
+	ID     string
+	Image  string
+	Name   string
+	Labels map[string]string
 
 	CPUPerc  float64
 	MemBytes uint64
+	// true si CPUPerc/MemBytes vienen de continfo y no del runtime
+	StatsFromKernel bool
+	// Ruta del cgroup relativa a la raíz del cgroup v2 (de continfo)
+	CgroupPath string
+
+	// Ya desalojado sin matarlo: pausado (lo dice el runtime) o limitado
+	// (lo sabe el Evictor)
+	Paused  bool
+	Limited bool
+}
+
+// Acciones de una decisión de la política
+const (
+	AccionConservar = "keep"
+	AccionEliminar  = "evict"
+	AccionProtegido = "protected"
+	AccionIgnorado  = "ignored"
+	AccionPospuesto = "deferred" // evict que no entró por presupuesto o cooldown
+	AccionThrottle  = "throttle" // evict que primero recibe topes (throttle)
+)
+
+// PolicyDecision explica qué hizo (o haría) la política con un contenedor.
+type PolicyDecision struct {
+	Container Container
+	Group     string
+	Score     float64
+	Action    string
+	Reason    string
+	Exited    bool
+}
+
+// PolicyRun son los parámetros de una ejecución de la política.
+type PolicyRun struct {
+	// Muestra de continfo con CPU% ya calculado (ContCPUTracker); nil = usar el runtime
+	Kernel *ContInfo
+	DryRun bool
+	// Evictor del daemon (recuerda cooldown, limitados y throttle); nil = uno nuevo, sin throttle
+	Evictor *Evictor
 }
 
-func EnforceContainerPolicy() error {
+// EnforceContainerPolicy aplica la política. Con DryRun solo calcula las
+// decisiones. Devuelve las decisiones y los eventos que ejecutó (también si
+// hubo errores); guardarlas en el lote y reportarlas queda a cargo de quien llama.
+//
+// Si ctx se cancela no empieza a desalojar más contenedores, pero el
+// desalojo de uno ya empezado se completa (ver Evictor).
+func EnforceContainerPolicy(ctx context.Context, rt ContainerRuntime, pol *Policy, opts PolicyRun) ([]PolicyDecision, []EventoEliminacion, error) {
+	var errs []error
+	dryRun := opts.DryRun
+
 	// ✅ 0) Limpia contenedores detenidos del proyecto (docker ps -a)
-	_ = removeStoppedProjectContainers()
+	decisions, eventos, err := removeStoppedProjectContainers(ctx, rt, pol, dryRun)
+	if err != nil {
+		errs = append(errs, err)
+	}
 
-	// 1) contenedores corriendo
-	containers, err := listRunningContainers()
+	// 1) contenedores corriendo, con CPU%/RAM
+	containers, err := runningConStats(ctx, rt, opts.Kernel, pol.OwnerLabels()...)
 	if err != nil {
-		return err
+		return decisions, eventos, errors.Join(append(errs, err)...)
 	}
-	if len(containers) == 0 {
-		return nil
+
+	ev := opts.Evictor
+	if ev == nil {
+		ev = NewEvictor(rt, pol, nil)
 	}
+	ev.Marcar(ctx, containers)
 
-	// 2) stats
-	stats, err := fetchStats()
+	// 2) decidir qué sobra (policy) y 3) desalojar según pol.Eviction
+	running, evs, err := ev.Aplicar(ctx, EvaluatePolicy(pol, containers), dryRun)
 	if err != nil {
-		return err
+		errs = append(errs, err)
 	}
+	decisions = append(decisions, running...)
+	eventos = append(eventos, evs...)
 
-	// 3) map ID -> stats
+	return decisions, eventos, errors.Join(errs...)
+}
+
+// runningConStats lista los contenedores corriendo (filtrados por labels)
+// con CPU% y RSS del módulo continfo; el runtime (docker stats, que tarda
+// segundos) solo se consulta para los que el kernel aún no tiene delta.
+func runningConStats(ctx context.Context, rt ContainerRuntime, ci *ContInfo, labels ...string) ([]Container, error) {
+	containers, err := rt.ListRunning(ctx, labels...)
+	if err != nil || len(containers) == 0 {
+		return containers, err
+	}
+	if missing := fillKernelStats(containers, ci); missing == 0 {
+		return containers, nil
+	}
+
+	stats, err := rt.Stats(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// map ID -> stats
 	idTo := map[string]Container{}
 	for _, s := range stats {
 		idTo[s.ID] = s
 	}
 	for i := range containers {
+		if containers[i].StatsFromKernel {
+			continue
+		}
 		if s, ok := idTo[containers[i].ID]; ok {
 			containers[i].CPUPerc = s.CPUPerc
 			containers[i].MemBytes = s.MemBytes
 		}
 	}
-
-	// 4) decidir qué borrar (policy)
-	toDelete := PickContainersToDelete(containers)
-
-	// 5) borrar
-	for _, c := range toDelete {
-		_, _ = run("docker", "stop", c.ID)
-		_, _ = run("docker", "rm", c.ID)
-	}
-
-	return nil
+	return containers, nil
 }
 
-func removeStoppedProjectContainers() error {
-	
-	out, err := run("docker", "ps", "-a", "--filter", "status=exited", "--format", "{{.ID}}|{{.Image}}|{{.Names}}")
+// SimulatePolicy calcula lo que haría la política ahora mismo sin detener,
+// borrar ni guardar nada (`daemon policy simulate`).
+func SimulatePolicy(ctx context.Context, rt ContainerRuntime, pol *Policy, ci *ContInfo) ([]PolicyDecision, error) {
+	decisions, _, err := removeStoppedProjectContainers(ctx, rt, pol, true)
 	if err != nil {
-		return err
-	}
-
-	lines := strings.Split(strings.TrimSpace(out), "\n")
-	for _, ln := range lines {
-		ln = strings.TrimSpace(ln)
-		if ln == "" {
-			continue
-		}
-
-		p := strings.Split(ln, "|")
-		if len(p) != 3 {
-			continue
-		}
-
-		id := p[0]
-		img := p[1]
-		name := p[2]
-
-		c := Container{ID: id, Image: img, Name: name}
-
-		// No tocar grafana
-		if isGrafana(c) {
-			continue
-		}
-
-		// Solo borrar imágenes del proyecto
-		if strings.Contains(img, lowImage) || strings.Contains(img, highCPU) || strings.Contains(img, highRAM) {
-			_, _ = run("docker", "rm", id)
-		}
+		return nil, err
 	}
-
-	return nil
-}
-
-func usageScore(c Container) float64 {
-	memMB := float64(c.MemBytes) / (1024.0 * 1024.0)
-	return memMB + (c.CPUPerc * 10.0)
-}
-
-func isGrafana(c Container) bool {
-	img := strings.ToLower(c.Image)
-	name := strings.ToLower(c.Name)
-	return strings.Contains(img, "grafana") || strings.Contains(name, "grafana")
-}
-
-func listRunningContainers() ([]Container, error) {
-	out, err := run("docker", "ps", "--format", "{{.ID}}|{{.Image}}|{{.Names}}")
+	containers, err := runningConStats(ctx, rt, ci, pol.OwnerLabels()...)
 	if err != nil {
 		return nil, err
 	}
+	// sin el Evictor del daemon no se conoce el cooldown, sí el presupuesto
+	running, _, err := NewEvictor(rt, pol, nil).Aplicar(ctx, EvaluatePolicy(pol, containers), true)
+	return append(decisions, running...), err
+}
 
-	lines := strings.Split(strings.TrimSpace(out), "\n")
-	var res []Container
-
-	for _, ln := range lines {
-		ln = strings.TrimSpace(ln)
-		if ln == "" {
-			continue
+// fillKernelStats copia CPU%, RSS y la ruta del cgroup de continfo a los contenedores y
+// devuelve cuántos quedaron sin datos del kernel.
+func fillKernelStats(containers []Container, ci *ContInfo) (missing int) {
+	for i := range containers {
+		e := ci.Find(containers[i].ID)
+		if e != nil && e.CgroupPath != "N/A" {
+			containers[i].CgroupPath = e.CgroupPath
 		}
-
-		p := strings.Split(ln, "|")
-		if len(p) != 3 {
+		if e == nil || !e.CPUPercentOK {
+			missing++
 			continue
 		}
-		res = append(res, Container{ID: p[0], Image: p[1], Name: p[2]})
+		containers[i].CPUPerc = e.CPUPercent
+		containers[i].MemBytes = e.RSSKB * 1024
+		containers[i].StatsFromKernel = true
 	}
-
-	return res, nil
+	return missing
 }
 
-func fetchStats() ([]Container, error) {
-	out, err := run("docker", "stats", "--no-stream", "--format", "{{.Container}}|{{.CPUPerc}}|{{.MemUsage}}")
+// removeStoppedProjectContainers borra los contenedores detenidos que son del
+// proyecto (label de dueño) y devuelve la decisión tomada con cada uno y los
+// rm ejecutados.
+func removeStoppedProjectContainers(ctx context.Context, rt ContainerRuntime, pol *Policy, dryRun bool) ([]PolicyDecision, []EventoEliminacion, error) {
+	exited, err := rt.ListExited(ctx, pol.OwnerLabels()...)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	lines := strings.Split(strings.TrimSpace(out), "\n")
-	var res []Container
-
-	for _, ln := range lines {
-		ln = strings.TrimSpace(ln)
-		if ln == "" {
-			continue
+	var (
+		decisions []PolicyDecision
+		eventos   []EventoEliminacion
+		errs      []error
+	)
+	for _, c := range exited {
+		d := PolicyDecision{Container: c, Exited: true, Action: AccionEliminar, Reason: "detenido (exited)"}
+		if g := pol.GroupOf(c); g != nil {
+			d.Group = g.Name
 		}
 
-		p := strings.Split(ln, "|")
-		if len(p) != 3 {
-			continue
+		// Solo borrar contenedores propios, de algún grupo y no protegidos
+		switch {
+		case !pol.IsOwned(c):
+			d.Action, d.Reason = AccionIgnorado, "sin el label de dueño "+pol.Owner
+		case pol.IsProtected(c):
+			d.Action, d.Reason = AccionProtegido, "protegido por la política"
+		case d.Group == "":
+			d.Action, d.Reason = AccionIgnorado, "no pertenece a ningún grupo"
+		case !dryRun:
+			ev := ejecutarEliminacion(ctx, rt, pol, d, EventoRmDetenido)
+			eventos = append(eventos, ev)
+			if ev.Err != nil {
+				errs = append(errs, ev.Err)
+			}
 		}
-
-		id := p[0]
-		cpu, _ := parsePercent(p[1])
-		mem, _ := parseMemUsage(p[2])
-
-		res = append(res, Container{ID: id, CPUPerc: cpu, MemBytes: mem})
+		decisions = append(decisions, d)
 	}
 
-	return res, nil
+	return decisions, eventos, errors.Join(errs...)
 }
 
-func parsePercent(s string) (float64, error) {
-	s = strings.TrimSpace(strings.TrimSuffix(s, "%"))
-	if s == "" {
-		return 0, errors.New("percent vacío")
-	}
-	return strconv.ParseFloat(s, 64)
-}
+// Acciones registradas en eventos_eliminacion
+const (
+	EventoTerm       = "sigterm"
+	EventoKill       = "sigkill" // solo si no terminó dentro de la gracia
+	EventoRm         = "rm"
+	EventoRmDetenido = "rm_detenido"
+	EventoPause      = "pause"
+	EventoLimit      = "limit"
+	EventoThrottle   = "throttle" // detalle en limites_cgroup
+)
 
-func parseMemUsage(s string) (uint64, error) {
-	s = strings.TrimSpace(s)
-	parts := strings.Split(s, "/")
-	if len(parts) < 1 {
-		return 0, errors.New("mem inválido")
-	}
-	used := strings.TrimSpace(parts[0])
-	return parseHumanBytes(used)
+// EventoEliminacion es una operación destructiva que el daemon ejecutó.
+type EventoEliminacion struct {
+	Decision PolicyDecision
+	Accion   string
+	Ts       time.Time
+	Err      error
+	// Solo en throttle: lo que se escribió en el cgroup
+	Limite *LimiteCgroup
 }
 
-var reBytes = regexp.MustCompile(`^\s*([0-9]*\.?[0-9]+)\s*([KMGTP]?i?B|[KMGTP]?B)\s*$`)
+// ErrNoPropio: el último control antes de tocar un contenedor lo rechazó
+// (protegido o sin el label de dueño), decida lo que decida quien llama.
+var ErrNoPropio = errors.New("contenedor protegido o ajeno, no se toca")
 
-func parseHumanBytes(s string) (uint64, error) {
-	m := reBytes.FindStringSubmatch(strings.TrimSpace(s))
-	if len(m) != 3 {
-		return 0, fmt.Errorf("no pude parsear bytes: %q", s)
-	}
+func ejecutarEliminacion(ctx context.Context, rt ContainerRuntime, pol *Policy, d PolicyDecision, accion string) EventoEliminacion {
+	ev := EventoEliminacion{Decision: d, Accion: accion, Ts: time.Now().UTC()}
 
-	val, err := strconv.ParseFloat(m[1], 64)
-	if err != nil {
-		return 0, err
+	if !pol.IsOwned(d.Container) || pol.IsProtected(d.Container) {
+		ev.Err = fmt.Errorf("%s %s: %w", accion, shortID(d.Container.ID), ErrNoPropio)
+		return ev
 	}
 
-	unit := m[2]
-	mult := float64(1)
-
-	switch unit {
-	case "B":
-		mult = 1
-	case "KiB", "KB":
-		mult = 1024
-	case "MiB", "MB":
-		mult = 1024 * 1024
-	case "GiB", "GB":
-		mult = 1024 * 1024 * 1024
-	case "TiB", "TB":
-		mult = 1024 * 1024 * 1024 * 1024
+	var err error
+	switch accion {
+	case EventoTerm:
+		// pausado por un desalojo anterior: docker no le manda SIGTERM
+		if d.Container.Paused {
+			err = rt.Unpause(ctx, d.Container.ID)
+		}
+		if err == nil {
+			err = rt.Kill(ctx, d.Container.ID, "SIGTERM")
+		}
+	case EventoKill:
+		err = rt.Kill(ctx, d.Container.ID, "SIGKILL")
+	case EventoPause:
+		err = rt.Pause(ctx, d.Container.ID)
+	case EventoLimit:
+		err = rt.Update(ctx, d.Container.ID, pol.Eviction.Limits())
 	default:
-		return 0, fmt.Errorf("unidad desconocida: %q", unit)
+		err = rt.Remove(ctx, d.Container.ID)
 	}
-
-	return uint64(val * mult), nil
+	if err != nil {
+		ev.Err = fmt.Errorf("%s %s: %w", accion, shortID(d.Container.ID), err)
+	} else {
+		metricas.incEviction(d.Group, accion)
+	}
+	return ev
 }
 
-func run(cmd string, args ...string) (string, error) {
-	c := exec.Command(cmd, args...)
-	var stdout, stderr bytes.Buffer
-	c.Stdout = &stdout
-	c.Stderr = &stderr
-
-	if err := c.Run(); err != nil {
-		msg := strings.TrimSpace(stderr.String())
-		if msg == "" {
-			msg = err.Error()
+func PickContainersToDelete(pol *Policy, containers []Container) (toDelete []Container) {
+	for _, d := range EvaluatePolicy(pol, containers) {
+		if d.Action == AccionEliminar {
+			toDelete = append(toDelete, d.Container)
 		}
-		return "", fmt.Errorf("%s %v: %s", cmd, args, msg)
 	}
-	return stdout.String(), nil
+	return toDelete
 }
 
-func PickContainersToDelete(containers []Container) (toDelete []Container) {
-	var low, high []Container
+// EvaluatePolicy decide qué pasa con cada contenedor corriendo y por qué.
+func EvaluatePolicy(pol *Policy, containers []Container) []PolicyDecision {
+	var decisions []PolicyDecision
+	byGroup := map[string][]Container{}
 
 	for _, c := range containers {
-		if isGrafana(c) {
+		d := PolicyDecision{Container: c, Score: pol.Score.Of(c)}
+		if !pol.IsOwned(c) {
+			d.Action, d.Reason = AccionIgnorado, "sin el label de dueño "+pol.Owner
+			decisions = append(decisions, d)
+			continue
+		}
+		if pol.IsProtected(c) {
+			d.Action, d.Reason = AccionProtegido, "protegido por la política"
+			decisions = append(decisions, d)
+			continue
+		}
+		// ya desalojado sin matarlo: no cuenta para el keep del grupo
+		if c.Paused || c.Limited {
+			d.Action, d.Reason = AccionIgnorado, "ya pausado o limitado por la política"
+			if g := pol.GroupOf(c); g != nil {
+				d.Group = g.Name
+			}
+			decisions = append(decisions, d)
 			continue
 		}
-		if strings.Contains(c.Image, lowImage) {
-			low = append(low, c)
+		g := pol.GroupOf(c)
+		if g == nil {
+			d.Action, d.Reason = AccionIgnorado, "no pertenece a ningún grupo"
+			decisions = append(decisions, d)
 			continue
 		}
-		if strings.Contains(c.Image, highCPU) || strings.Contains(c.Image, highRAM) {
-			high = append(high, c)
+		byGroup[g.Name] = append(byGroup[g.Name], c)
+	}
+
+	for i := range pol.Groups {
+		g := &pol.Groups[i]
+		group := byGroup[g.Name]
+		if len(group) == 0 {
 			continue
 		}
+
+		var del, kept []Container
+		reps := map[string]string{}
+		if len(g.Classes) == 0 {
+			del, kept = trimByUsage(pol.Score, group, g.Keep)
+		} else {
+			del, kept, reps = trimPreferClasses(pol.Score, group, g.Keep, g.Classes)
+		}
+
+		for _, c := range kept {
+			d := PolicyDecision{Container: c, Group: g.Name, Score: pol.Score.Of(c), Action: AccionConservar}
+			switch {
+			case len(group) <= g.Keep:
+				d.Reason = fmt.Sprintf("el grupo tiene %d <= keep=%d", len(group), g.Keep)
+			case reps[c.ID] != "":
+				d.Reason = fmt.Sprintf("menor score de la clase %s", reps[c.ID])
+			default:
+				d.Reason = fmt.Sprintf("entre los %d de menor score", g.Keep)
+			}
+			decisions = append(decisions, d)
+		}
+		for _, c := range del {
+			decisions = append(decisions, PolicyDecision{
+				Container: c,
+				Group:     g.Name,
+				Score:     pol.Score.Of(c),
+				Action:    AccionEliminar,
+				Reason:    fmt.Sprintf("excede keep=%d del grupo (%d corriendo)", g.Keep, len(group)),
+			})
+		}
 	}
 
-	delLow, _ := trimByUsage(low, keepLow)
-	delHigh, _ := trimHighPreferTypes(high, keepHigh)
+	return decisions
+}
+
+// PrintDecisionReport imprime una línea logfmt por decisión.
+func PrintDecisionReport(w io.Writer, idLote int64, dryRun bool, decisions []PolicyDecision) {
+	tag := "politica"
+	if dryRun {
+		tag = "politica dry-run"
+	}
+	for _, d := range decisions {
+		fmt.Fprintf(w, "[%s] lote=%d id=%s nombre=%s imagen=%s grupo=%s score=%.2f cpu=%.2f mem_mb=%.1f accion=%s razon=%q\n",
+			tag, idLote, shortID(d.Container.ID), d.Container.Name, d.Container.Image,
+			orDash(d.Group), d.Score, d.Container.CPUPerc, float64(d.Container.MemBytes)/(1024.0*1024.0),
+			d.Action, d.Reason)
+	}
+}
 
-	return append(delLow, delHigh...)
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
 }
 
-func trimByUsage(group []Container, keep int) (del []Container, kept []Container) {
+func trimByUsage(score ScoreFormula, group []Container, keep int) (del []Container, kept []Container) {
 	if len(group) <= keep {
 		return nil, group
 	}
-	sort.Slice(group, func(i, j int) bool { return usageScore(group[i]) > usageScore(group[j]) })
+	sort.Slice(group, func(i, j int) bool { return score.Of(group[i]) > score.Of(group[j]) })
 	del = append(del, group[:len(group)-keep]...)
 	kept = append(kept, group[len(group)-keep:]...)
 	return
 }
 
-func trimHighPreferTypes(high []Container, keep int) (del []Container, kept []Container) {
-	if len(high) <= keep {
-		return nil, high
+// trimPreferClasses devuelve además reps: ID -> clase de los que se
+// conservaron como representante de su clase.
+func trimPreferClasses(score ScoreFormula, group []Container, keep int, classes []PolicyClass) (del []Container, kept []Container, reps map[string]string) {
+	reps = map[string]string{}
+	if len(group) <= keep {
+		return nil, group, reps
 	}
 
-	var cpuList, ramList []Container
-	for _, c := range high {
-		if strings.Contains(c.Image, highCPU) {
-			cpuList = append(cpuList, c)
-		} else if strings.Contains(c.Image, highRAM) {
-			ramList = append(ramList, c)
-		}
+	byScore := func(l []Container) {
+		sort.Slice(l, func(i, j int) bool { return score.Of(l[i]) < score.Of(l[j]) })
 	}
 
-	sort.Slice(cpuList, func(i, j int) bool { return usageScore(cpuList[i]) < usageScore(cpuList[j]) })
-	sort.Slice(ramList, func(i, j int) bool { return usageScore(ramList[i]) < usageScore(ramList[j]) })
-
-	candidates := []Container{}
-	if len(cpuList) > 0 {
-		candidates = append(candidates, cpuList[0])
-	}
-	if len(ramList) > 0 && len(candidates) < keep {
-		candidates = append(candidates, ramList[0])
+	lists := make([][]Container, len(classes))
+	var rest []Container
+	for _, c := range group {
+		placed := false
+		for i := range classes {
+			if matchAny(classes[i].Match, c) {
+				lists[i] = append(lists[i], c)
+				placed = true
+				break
+			}
+		}
+		if !placed {
+			rest = append(rest, c)
+		}
 	}
 
-	rest := []Container{}
-	if len(cpuList) > 1 {
-		rest = append(rest, cpuList[1:]...)
-	}
-	if len(ramList) > 1 {
-		rest = append(rest, ramList[1:]...)
+	candidates := []Container{}
+	for i := range lists {
+		byScore(lists[i])
+		if len(lists[i]) > 0 && len(candidates) < keep {
+			candidates = append(candidates, lists[i][0])
+			reps[lists[i][0].ID] = classes[i].Name
+			lists[i] = lists[i][1:]
+		}
+		rest = append(rest, lists[i]...)
 	}
-	sort.Slice(rest, func(i, j int) bool { return usageScore(rest[i]) < usageScore(rest[j]) })
+	byScore(rest)
 
 	for _, r := range rest {
 		if len(candidates) >= keep {
@@ -323,7 +433,7 @@ func trimHighPreferTypes(high []Container, keep int) (del []Container, kept []Co
 		keepID[k.ID] = true
 	}
 
-	for _, c := range high {
+	for _, c := range group {
 		if keepID[c.ID] {
 			kept = append(kept, c)
 		} else {
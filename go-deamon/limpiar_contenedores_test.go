@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// contenedor arma un contenedor del generador de la clase dada; extra son
+// labels "clave=valor" que se suman (o reemplazan) a los de dueño y clase.
+func contenedor(id, clase string, memMB int64, extra ...string) Container {
+	labels := map[string]string{LabelOwner: OwnerDaemon, LabelClase: clase}
+	for _, kv := range extra {
+		k, v, _ := strings.Cut(kv, "=")
+		labels[k] = v
+	}
+	return Container{ID: id, Name: "so1_" + id, Image: "img_" + clase, Labels: labels, MemBytes: uint64(memMB) << 20}
+}
+
+// ajeno es un contenedor con la clase pero sin el label de dueño.
+func ajeno(id, clase string, memMB int64) Container {
+	c := contenedor(id, clase, memMB)
+	delete(c.Labels, LabelOwner)
+	return c
+}
+
+func acciones(ds []PolicyDecision) map[string]string {
+	res := map[string]string{}
+	for _, d := range ds {
+		res[d.Container.ID] = d.Action
+	}
+	return res
+}
+
+func TestEvaluatePolicy(t *testing.T) {
+	pol := DefaultPolicy()
+	cs := []Container{
+		contenedor("b1", "bajo", 10),
+		contenedor("b2", "bajo", 20),
+		contenedor("b3", "bajo", 30),
+		contenedor("b4", "bajo", 40),
+		ajeno("x1", "bajo", 500),
+		contenedor("p1", "bajo", 900, LabelProtect+"=true"),
+		contenedor("p2", "bajo", 900, LabelProtect+"=false"),
+		contenedor("z1", "otra", 5),
+	}
+
+	got := acciones(EvaluatePolicy(pol, cs))
+	want := map[string]string{
+		"b1": AccionConservar,
+		"b2": AccionConservar,
+		"b3": AccionConservar,
+		"b4": AccionEliminar,
+		"x1": AccionIgnorado,  // sin so1.owner
+		"p1": AccionProtegido, // so1.protect=true
+		"p2": AccionEliminar,  // so1.protect=false no protege
+		"z1": AccionIgnorado,  // sin grupo
+	}
+	for id, w := range want {
+		if got[id] != w {
+			t.Errorf("%s: acción %q, se esperaba %q", id, got[id], w)
+		}
+	}
+}
+
+func TestEnforceContainerPolicy(t *testing.T) {
+	cases := []struct {
+		name    string
+		running []Container
+		exited  []Container
+		removed []string
+		acc     map[string]string
+	}{
+		{
+			name: "sobra uno en bajo",
+			running: []Container{
+				contenedor("b1", "bajo", 10), contenedor("b2", "bajo", 20),
+				contenedor("b3", "bajo", 30), contenedor("b4", "bajo", 40),
+			},
+			removed: []string{"b4"},
+			acc:     map[string]string{"b3": AccionConservar, "b4": AccionEliminar},
+		},
+		{
+			name: "un ajeno no cuenta ni se toca",
+			running: []Container{
+				contenedor("b1", "bajo", 10), contenedor("b2", "bajo", 20),
+				contenedor("b3", "bajo", 30), ajeno("x1", "bajo", 900),
+			},
+			acc: map[string]string{"b3": AccionConservar},
+		},
+		{
+			name: "un protegido no cuenta ni se toca",
+			running: []Container{
+				contenedor("b1", "bajo", 10), contenedor("b2", "bajo", 20),
+				contenedor("b3", "bajo", 30), contenedor("p1", "bajo", 900, LabelProtect+"=1"),
+			},
+			acc: map[string]string{"b3": AccionConservar, "p1": AccionProtegido},
+		},
+		{
+			name: "alto conserva uno de cada clase",
+			running: []Container{
+				contenedor("c1", "cpu", 10), contenedor("c2", "cpu", 20),
+				contenedor("c3", "cpu", 30), contenedor("r1", "ram", 400),
+			},
+			removed: []string{"c2", "c3"},
+			acc:     map[string]string{"c1": AccionConservar, "r1": AccionConservar, "c2": AccionEliminar},
+		},
+		{
+			name:    "detenidos: solo los propios y no protegidos",
+			exited:  []Container{contenedor("e1", "bajo", 0), ajeno("e2", "bajo", 0), contenedor("e3", "bajo", 0, LabelProtect+"=true")},
+			removed: []string{"e1"},
+			acc:     map[string]string{"e1": AccionEliminar, "e3": AccionProtegido},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rt := NewFakeRuntime()
+			for _, c := range tc.running {
+				rt.Add(c, true)
+			}
+			for _, c := range tc.exited {
+				rt.Add(c, false)
+			}
+
+			ds, _, err := EnforceContainerPolicy(context.Background(), rt, DefaultPolicy(), PolicyRun{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			removed := slices.Sorted(slices.Values(rt.Removed))
+			if !slices.Equal(removed, tc.removed) {
+				t.Errorf("borrados %v, se esperaba %v", removed, tc.removed)
+			}
+			got := acciones(ds)
+			for id, w := range tc.acc {
+				if got[id] != w {
+					t.Errorf("%s: acción %q, se esperaba %q", id, got[id], w)
+				}
+			}
+		})
+	}
+}
+
+func TestEnforceContainerPolicyCooldown(t *testing.T) {
+	pol := DefaultPolicy()
+	pol.Eviction.Cooldown = time.Hour
+	rt := NewFakeRuntime()
+	for i, mem := range []int64{10, 20, 30, 40, 50} {
+		rt.Add(contenedor("b"+string(rune('1'+i)), "bajo", mem), true)
+	}
+	ev := NewEvictor(rt, pol, nil)
+	ctx := context.Background()
+
+	// primera corrida: sobran b4 y b5; sale el de mayor score y el otro
+	// queda pospuesto por el cooldown de la clase
+	ds, _, err := EnforceContainerPolicy(ctx, rt, pol, PolicyRun{Evictor: ev})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := acciones(ds); got["b5"] != AccionEliminar || got["b4"] != AccionPospuesto {
+		t.Fatalf("primera corrida: b5=%q b4=%q", got["b5"], got["b4"])
+	}
+	if !slices.Equal(rt.Removed, []string{"b5"}) {
+		t.Fatalf("borrados %v, se esperaba [b5]", rt.Removed)
+	}
+
+	// segunda corrida con el mismo Evictor: la clase sigue en cooldown
+	ds, _, err = EnforceContainerPolicy(ctx, rt, pol, PolicyRun{Evictor: ev})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := acciones(ds); got["b4"] != AccionPospuesto {
+		t.Errorf("segunda corrida: b4=%q, se esperaba %q", got["b4"], AccionPospuesto)
+	}
+	if len(rt.Removed) != 1 {
+		t.Errorf("borrados %v: el cooldown no se respetó", rt.Removed)
+	}
+
+	// otra clase no comparte el cooldown
+	rt.Add(contenedor("c1", "cpu", 10), true)
+	rt.Add(contenedor("c2", "cpu", 20), true)
+	rt.Add(contenedor("c3", "cpu", 30), true)
+	if _, _, err := EnforceContainerPolicy(ctx, rt, pol, PolicyRun{Evictor: ev}); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(rt.Removed, "c3") {
+		t.Errorf("borrados %v: c3 (clase cpu) debía desalojarse", rt.Removed)
+	}
+}
@@ -1,25 +1,17 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
-	"os/signal"
 	"strconv"
 	"strings"
-	"syscall"
 	"time"
 )
 
-const (
-	procSysinfo  = "/proc/sysinfo_so1_202300644"
-	
-
-	loopEvery = 20 * time.Second 
-)
-
-
-
 type SysInfo struct {
 	Totalram  uint64    `json:"Totalram"`
 	Freeram   uint64    `json:"Freeram"`
@@ -37,194 +29,321 @@ type Process struct {
 	CPUUsage    float64 `json:"CPU_Usage"`
 	UTime       uint64  `json:"utime"`
 	STime       uint64  `json:"stime"`
+
+	// CPU% en el intervalo entre lotes (ProcCPUTracker)
+	CPUPercent   float64 `json:"-"`
+	CPUPercentOK bool    `json:"-"`
+}
+
+// Daemon guarda lo que tiene que sobrevivir entre ticks del loop.
+type Daemon struct {
+	cfg     *Config
+	rt      ContainerRuntime
+	pol     *Policy
+	fuente  *Fuente
+	procCPU *ProcCPUTracker
+	contCPU *ContCPUTracker
+	actual  muestraActual
+	stream  *streamHub
+	cola    chan muestra   // colector -> writer
+	cron    *CronScheduler // nil salvo cron_mode internal
+	evictor *Evictor
+
+	origenes map[string]string // colector -> kernel|proc, solo lo toca el colector
 }
 
 
 
 func main() {
-	fmt.Println("Daemon iniciado...")
+	os.Exit(runCLI(os.Args[1:]))
+}
 
-	// 0) DB
-	if err := InitDB(); err != nil {
-		fmt.Printf("ERROR InitDB: %v\n", err)
-		os.Exit(1)
+// runDaemonCmd es el daemon de siempre (`daemon` o sin subcomando).
+func runDaemonCmd(args []string) int {
+	c, err := parseCmd("daemon", args, nil)
+	if err != nil {
+		return cmdExit(err)
 	}
-	defer CloseDB()
-
-	if err := ResetDB(); err != nil {
-		fmt.Printf("ERROR ResetDB: %v\n", err)
-		os.Exit(1)
+	if len(c.args) > 0 {
+		fmt.Printf("ERROR: argumento inesperado %q (ver `daemon help`)\n", c.args[0])
+		return 2
 	}
-	fmt.Println("DB inicializada y reseteada.")
+	cfg := c.cfg
 
-	// 1) Módulos kernel
-	loadModules()
-	defer unloadModules()
-
-	// 2) Cron
-	cron := CronManager{
-		ScriptPath: "/home/jeremy-kvm/Github/SO1_P1_202300644/bash/crear_contenedores.sh",
-		LogPath:    "/home/jeremy-kvm/Github/SO1_P1_202300644/bash/crear_contenedores.log",
-	}
-	if err := cron.InstallEveryMinute(); err != nil {
-		fmt.Printf("ERROR cron: %v\n", err)
-		os.Exit(1)
+	fmt.Println("Daemon iniciado...")
+	if cfg.DryRun {
+		fmt.Println("Modo dry-run: la política no detiene ni borra contenedores.")
 	}
-	defer cron.Remove()
-
-	// 3) Verificar /proc
-	checkProc()
 
-	// 4) Señales
-	stop := make(chan os.Signal, 1)
-	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	// Primera señal cancela ctx; la segunda fuerza la salida
+	ctx := signalContext()
 
-	// 5) LOOP PRINCIPAL
-	ticker := time.NewTicker(loopEvery)
-	defer ticker.Stop()
+	// Lo que se levanta se registra en el cierre, que corre en orden inverso
+	// con un timeout por paso
+	cierre := &cierre{timeout: cfg.ShutdownStepTimeout}
+	defer cierre.run()
 
-	fmt.Println("Loop principal iniciado (cada 20s)")
-
-	for {
-		select {
-		case <-stop:
-			fmt.Println("\nCerrando daemon...")
-			removeStoppedProjectContainers()
-			return
+	// Política primero: si el archivo es inválido se reporta antes de tocar nada
+	// (policy_file vacío = política por defecto)
+	pol, err := LoadPolicy(cfg.PolicyFile)
+	if err != nil {
+		fmt.Printf("ERROR política: %v\n", err)
+		return 1
+	}
+	// Igual con el generador, si es el job del scheduler interno
+	var gen *Generador
+	if cfg.CronMode == CronInternal && cfg.CronJob == CronJobGenerador {
+		if gen, err = LoadGenerador(cfg.GeneratorFile); err != nil {
+			fmt.Printf("ERROR generador: %v\n", err)
+			return 1
+		}
+	}
 
-		case <-ticker.C:
-			if err := loopOnce(); err != nil {
-				fmt.Printf("WARNING loop: %v\n", err)
-			}
+	// 0) DB
+	if err := InitDB(cfg.DBPath); err != nil {
+		fmt.Printf("ERROR InitDB: %v\n", err)
+		return 1
+	}
+	cierre.add("db", func(context.Context) error {
+		CloseDB()
+		return nil
+	})
+
+	// El historial se conserva; solo --reset lo borra
+	if cfg.Reset {
+		if err := ResetDB(); err != nil {
+			fmt.Printf("ERROR ResetDB: %v\n", err)
+			return 1
 		}
+		fmt.Println("DB inicializada y reseteada.")
+	} else {
+		fmt.Println("DB inicializada.")
 	}
-}
 
+	// Poda en segundo plano según la retención configurada
+	stopRetention := cfg.Retention().Start()
+	cierre.esperar("retención", stopRetention)
 
+	// 1) Módulos kernel (si no cargan, en modo auto/proc se lee de /proc)
+	if err := loadModules(ctx, cfg); err != nil && cfg.Collector == FuenteKernel {
+		fmt.Println("ERROR: --collector kernel necesita los módulos cargados")
+		return 1
+	}
+	cierre.add("módulos", func(ctx context.Context) error {
+		return unloadModules(ctx, cfg)
+	})
 
-func loopOnce() error {
-	
-	raw, err := os.ReadFile(procSysinfo)
+	// 2) Verificar /proc (en modo auto, lo que falte se lee de /proc)
+	fuente := NewFuente(cfg)
+	avisos, err := fuente.Check()
 	if err != nil {
-		return err
+		fmt.Printf("ERROR: %v\n", err)
+		return 1
 	}
-
-	var si SysInfo
-	if err := json.Unmarshal(raw, &si); err != nil {
-		return err
+	for _, a := range avisos {
+		fmt.Printf("WARNING colector: %s\n", a)
 	}
 
-	used := si.Totalram - si.Freeram
-	cpuTotal, _ := totalCPUPercent(200 * time.Millisecond)
-
-	fmt.Printf(
-		"[sysinfo] Total=%dKB Free=%dKB Used=%dKB Procs=%d CPU=%.2f%%\n",
-		si.Totalram, si.Freeram, used, si.Procs, cpuTotal,
-	)
-
-
-	ci, err := ReadContainerInfo()
+	// 3) Runtime de contenedores (docker | podman | docker-api | fake)
+	rt, err := NewContainerRuntime(cfg.Runtime, cfg.DockerSocket, cfg.DockerTimeout)
 	if err != nil {
-		fmt.Printf("WARNING continfo: %v\n", err)
-		ci = nil
+		fmt.Printf("ERROR runtime: %v\n", err)
+		return 1
 	}
 
-	
-	idLote, err := CrearLote()
-	if err != nil {
-		return err
+	// 4) Cron: bloque en el crontab del usuario, o el scheduler interno
+	// (que no toca el crontab del sistema)
+	var sched *CronScheduler
+	switch cfg.CronMode {
+	case CronCrontab:
+		cron := cronManager(cfg)
+		if cfg.CronJob == CronJobGenerador && binarioTemporal() {
+			fmt.Println("WARNING cron: el binario está en el directorio temporal (¿go run?); el crontab dejará de funcionar al salir")
+		}
+		if err := cron.Install(ctx); err != nil {
+			fmt.Printf("ERROR cron: %v\n", err)
+			return 1
+		}
+		cierre.add("cron", cron.Remove)
+	case CronInternal:
+		expr, err := ParseCron(cfg.CronSchedule)
+		if err != nil {
+			fmt.Printf("ERROR cron: %v\n", err)
+			return 1
+		}
+		job := scriptJob(cfg.CronScript)
+		if gen != nil {
+			job = generadorJob(gen, rt, int64(cfg.GenSeed))
+		}
+		sched = NewCronScheduler(expr, cfg.CronLog, job)
+		sched.Start()
+		cierre.add("cron", sched.Stop)
+		fmt.Printf("Cron interno (%s): %q, log en %s\n", cfg.CronJob, cfg.CronSchedule, cfg.CronLog)
 	}
 
-	if err := InsertarProcesosSnapshot(idLote, si.Processes); err != nil {
-		return err
+	// Throttle: lo que quedó puesto por un daemon anterior se revierte ahora;
+	// lo de esta ejecución, en el cierre (después de parar el pipeline)
+	thr := NewThrottler(rt, pol, fuente)
+	if n, err := thr.RevertirPendientes(ctx); err != nil {
+		fmt.Printf("WARNING throttle: %v\n", err)
+	} else if n > 0 {
+		fmt.Printf("Throttle: %d topes de una ejecución anterior revertidos\n", n)
+	}
+	cierre.add("throttle", thr.RevertirTodo)
+
+	d := &Daemon{
+		cfg:     cfg,
+		rt:      rt,
+		pol:     pol,
+		fuente:  fuente,
+		procCPU: NewProcCPUTracker(cfg.CPUTimeHz, cfg.ProcRoot),
+		contCPU: NewContCPUTracker(cfg.CPUTimeHz),
+		stream:  newStreamHub(),
+		cron:    sched,
+		evictor: NewEvictor(rt, pol, thr),
 	}
 
-	if ci != nil {
-		if err := InsertarContenedoresSnapshot(idLote, ci); err != nil {
-			return err
+	// API HTTP (http_addr vacío = desactivada)
+	if cfg.HTTPAddr != "" {
+		srv, err := d.StartAPI(cfg.HTTPAddr)
+		if err != nil {
+			fmt.Printf("ERROR api: %v\n", err)
+			return 1
 		}
+		cierre.add("api", func(ctx context.Context) error {
+			d.stream.closeAll()
+			return stopAPI(ctx, srv)
+		})
+		fmt.Printf("API HTTP en http://%s/api/\n", cfg.HTTPAddr)
 	}
 
-	
-	if err := EnforceContainerPolicy(); err != nil {
+	// En el cierre corre justo después de parar el pipeline: borrar los
+	// detenidos mientras docker, la DB y la API siguen disponibles
+	cierre.add("contenedores detenidos", func(ctx context.Context) error {
+		_, eventos, err := removeStoppedProjectContainers(ctx, rt, pol, cfg.DryRun)
+		if e := InsertarEventosEliminacion(ctx, eventos); e != nil {
+			err = errors.Join(err, e)
+		}
 		return err
-	}
+	})
+
+	// 5) Pipeline: colectores -> writer, y la política con su propio intervalo
+	wait := d.startPipeline(ctx)
+	cierre.esperar("pipeline", wait)
 
-	fmt.Printf(
-		"[LOTE %d] procesos=%d contenedores=%d\n",
-		idLote,
-		len(si.Processes),
-		func() int {
-			if ci == nil {
-				return 0
-			}
-			return len(ci.Containers)
-		}(),
-	)
+	fmt.Printf("Pipeline iniciado (procesos cada %s, contenedores cada %s, cpu cada %s, política cada %s)\n",
+		cfg.ProcesosSchedule().Every, cfg.ContenedoresSchedule().Every, cfg.CPUSchedule().Every, cfg.PolicySchedule().Every)
 
-	return nil
+	<-ctx.Done()
+	fmt.Println("Cerrando daemon...")
+	return 0
 }
 
 
-func readCPUStat() (idle, total uint64, err error) {
+
+// ReadSysInfo lee y parsea el JSON del módulo sysinfo.
+func ReadSysInfo(path string) (*SysInfo, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var si SysInfo
+	if err := json.Unmarshal(bytes.TrimSpace(raw), &si); err != nil {
+		return nil, err
+	}
+	return &si, nil
+}
+
+func readCPUStat() (idle uint64, total uint64, err error) {
 	b, err := os.ReadFile("/proc/stat")
 	if err != nil {
-		return
+		return 0, 0, err
+	}
+	line := strings.SplitN(string(b), "\n", 2)[0] // primera línea: "cpu ..."
+	f := strings.Fields(line)
+	if len(f) < 8 || f[0] != "cpu" {
+		return 0, 0, fmt.Errorf("formato inválido en /proc/stat")
 	}
-	f := strings.Fields(strings.SplitN(string(b), "\n", 2)[0])
 
+	// cpu user nice system idle iowait irq softirq steal guest guest_nice...
 	var vals []uint64
-	for _, v := range f[1:] {
-		n, e := strconv.ParseUint(v, 10, 64)
+	for i := 1; i < len(f); i++ {
+		v, e := strconv.ParseUint(f[i], 10, 64)
 		if e != nil {
 			break
 		}
-		vals = append(vals, n)
+		vals = append(vals, v)
+	}
+	if len(vals) < 5 {
+		return 0, 0, fmt.Errorf("no hay suficientes campos en /proc/stat")
+	}
+
+	idleAll := vals[3] // idle
+	if len(vals) > 4 {
+		idleAll += vals[4] // iowait
 	}
 
-	idle = vals[3] + vals[4]
+	var tot uint64
 	for _, v := range vals {
-		total += v
+		tot += v
 	}
-	return
+
+	return idleAll, tot, nil
 }
 
 func totalCPUPercent(sample time.Duration) (float64, error) {
-	i1, t1, _ := readCPUStat()
+	idle1, total1, err := readCPUStat()
+	if err != nil {
+		return 0, err
+	}
 	time.Sleep(sample)
-	i2, t2, _ := readCPUStat()
-
-	dt := float64(t2 - t1)
-	di := float64(i2 - i1)
+	idle2, total2, err := readCPUStat()
+	if err != nil {
+		return 0, err
+	}
 
-	return (dt-di)/dt*100.0, nil
-}
+	if total2 <= total1 {
+		return 0, fmt.Errorf("delta total CPU inválido")
+	}
 
+	dTotal := float64(total2 - total1)
+	dIdle := float64(idle2 - idle1)
 
-func checkProc() {
-	if _, err := os.Stat(procSysinfo); err != nil {
-		fmt.Println("ERROR:", procSysinfo)
-		os.Exit(1)
+	used := (dTotal - dIdle) / dTotal * 100.0
+	if used < 0 {
+		used = 0
 	}
-	if _, err := os.Stat(procContinfo); err != nil {
-		fmt.Println("ERROR:", procContinfo)
-		os.Exit(1)
+	if used > 100 {
+		used = 100
 	}
+	return used, nil
 }
 
-func loadModules() {
-	ModuleManager{
-		KoPath:     "/home/jeremy-kvm/Github/SO1_P1_202300644/modulo-kernel/sysinfo/sysinfo.ko",
-		ModuleName: "sysinfo",
-	}.Load()
 
-	ModuleManager{
-		KoPath:     "/home/jeremy-kvm/Github/SO1_P1_202300644/modulo-kernel/continfo/continfo.ko",
-		ModuleName: "continfo",
-	}.Load()
+// loadModules carga en orden y reporta cada falla con su paso; devuelve
+// todas juntas (errors.As(err, *ModuleError) para inspeccionarlas).
+func loadModules(ctx context.Context, cfg *Config) error {
+	var errs []error
+	for _, m := range moduleManagers(cfg) {
+		start := time.Now()
+		if err := m.Load(ctx); err != nil {
+			fmt.Printf("WARNING %v\n", err)
+			errs = append(errs, err)
+			continue
+		}
+		fmt.Printf("[módulos] %s listo (%s)\n", m.ModuleName, time.Since(start).Round(time.Millisecond))
+	}
+	return errors.Join(errs...)
 }
 
-func unloadModules() {
-	ModuleManager{ModuleName: "continfo"}.Unload()
-	ModuleManager{ModuleName: "sysinfo"}.Unload()
+// unloadModules descarga en orden inverso a la carga.
+func unloadModules(ctx context.Context, cfg *Config) error {
+	var errs []error
+	mods := moduleManagers(cfg)
+	for i := len(mods) - 1; i >= 0; i-- {
+		if err := mods[i].Unload(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
 }
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Métricas propias del daemon (formato de exposición de Prometheus 0.0.4,
+// sin depender de client_golang). Las del host y contenedores se leen de la
+// última muestra al momento del scrape.
+var metricas = newDaemonMetrics()
+
+var stageBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// Etapas del pipeline con histograma de duración
+const (
+	StageCollect = "collect"
+	StageWrite   = "write"
+	StagePolicy  = "policy"
+)
+
+type stageHist struct {
+	buckets []uint64
+	sum     float64
+	count   uint64
+	ultimo  time.Time // fin de la última corrida sin errores
+}
+
+type daemonMetrics struct {
+	mu sync.Mutex
+
+	stages      map[string]*stageHist
+	ultimoLote  int64
+	evictions   map[[2]string]uint64 // {grupo, accion}
+	errorsStage map[string]uint64
+	descartadas uint64          // muestras que el writer no alcanzó a tomar
+	cronRuns    map[bool]uint64 // scheduler interno: ok -> ejecuciones
+}
+
+func newDaemonMetrics() *daemonMetrics {
+	return &daemonMetrics{
+		stages:      map[string]*stageHist{},
+		evictions:   map[[2]string]uint64{},
+		errorsStage: map[string]uint64{},
+		cronRuns:    map[bool]uint64{},
+	}
+}
+
+func (m *daemonMetrics) observeStage(stage string, d time.Duration, ok bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	h := m.stages[stage]
+	if h == nil {
+		h = &stageHist{buckets: make([]uint64, len(stageBuckets))}
+		m.stages[stage] = h
+	}
+	s := d.Seconds()
+	h.sum += s
+	h.count++
+	for i, b := range stageBuckets {
+		if s <= b {
+			h.buckets[i]++
+		}
+	}
+	if ok {
+		h.ultimo = time.Now()
+	}
+}
+
+func (m *daemonMetrics) incDescartada() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.descartadas++
+}
+
+func (m *daemonMetrics) observeCron(ok bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cronRuns[ok]++
+}
+
+func (m *daemonMetrics) setLote(id int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ultimoLote = id
+}
+
+func (m *daemonMetrics) incEviction(grupo, accion string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.evictions[[2]string{grupo, accion}]++
+}
+
+// incError cuenta un error por etapa: sysinfo, continfo, db, policy, ...
+func (m *daemonMetrics) incError(stage string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.errorsStage[stage]++
+}
+
+// stageError marca el error con su etapa para contarlo y lo devuelve igual.
+func stageError(stage string, err error) error {
+	if err != nil {
+		metricas.incError(stage)
+	}
+	return err
+}
+
+func (d *Daemon) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	d.writeMetrics(w)
+}
+
+func (d *Daemon) writeMetrics(w io.Writer) {
+	p := promWriter{w: w}
+
+	// ---- host / contenedores (última muestra) ----
+	d.actual.mu.RLock()
+	if si := d.actual.si; si != nil {
+		used := uint64(0)
+		if si.Totalram >= si.Freeram {
+			used = si.Totalram - si.Freeram
+		}
+		p.header("so1_host_ram_total_bytes", "gauge", "RAM total del host (módulo sysinfo)")
+		p.sample("so1_host_ram_total_bytes", nil, float64(si.Totalram*1024))
+		p.header("so1_host_ram_free_bytes", "gauge", "RAM libre del host")
+		p.sample("so1_host_ram_free_bytes", nil, float64(si.Freeram*1024))
+		p.header("so1_host_ram_used_bytes", "gauge", "RAM usada del host")
+		p.sample("so1_host_ram_used_bytes", nil, float64(used*1024))
+		p.header("so1_host_processes", "gauge", "Procesos reportados por el módulo sysinfo")
+		p.sample("so1_host_processes", nil, float64(si.Procs))
+	}
+
+	if !d.actual.cpuTs.IsZero() {
+		p.header("so1_host_cpu_percent", "gauge", "Uso total de CPU del host (/proc/stat)")
+		p.sample("so1_host_cpu_percent", nil, d.actual.cpuTotal)
+	}
+
+	p.header("so1_daemon_collector_last_timestamp_seconds", "gauge", "Última lectura guardada de cada colector (epoch)")
+	for _, c := range []struct {
+		nombre string
+		ts     time.Time
+	}{{ColProcesos, d.actual.siTs}, {ColContenedores, d.actual.ciTs}, {ColCPU, d.actual.cpuTs}} {
+		if !c.ts.IsZero() {
+			p.sample("so1_daemon_collector_last_timestamp_seconds", [][2]string{{"collector", c.nombre}}, float64(c.ts.UnixNano())/1e9)
+		}
+	}
+
+	if ci := d.actual.ci; ci != nil {
+		p.header("so1_containers", "gauge", "Contenedores reportados por el módulo continfo")
+		p.sample("so1_containers", nil, float64(len(ci.Containers)))
+
+		p.header("so1_container_rss_bytes", "gauge", "RSS del contenedor (suma de sus procesos)")
+		for _, c := range ci.Containers {
+			p.sample("so1_container_rss_bytes", contLabels(c), float64(c.RSSKB*1024))
+		}
+		p.header("so1_container_cpu_jiffies_total", "counter", "Tiempo de CPU acumulado del contenedor (unidades cpu_time_hz)")
+		for _, c := range ci.Containers {
+			p.sample("so1_container_cpu_jiffies_total", contLabels(c), float64(c.CPUJiffies))
+		}
+		p.header("so1_container_cpu_percent", "gauge", "CPU% del contenedor en el último intervalo")
+		for _, c := range ci.Containers {
+			if c.CPUPercentOK {
+				p.sample("so1_container_cpu_percent", contLabels(c), c.CPUPercent)
+			}
+		}
+		p.header("so1_container_processes", "gauge", "Procesos del contenedor")
+		for _, c := range ci.Containers {
+			p.sample("so1_container_processes", contLabels(c), float64(c.Procs))
+		}
+	}
+	d.actual.mu.RUnlock()
+
+	// ---- daemon ----
+	m := metricas
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	names := make([]string, 0, len(m.stages))
+	for n := range m.stages {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	p.header("so1_daemon_stage_duration_seconds", "histogram", "Duración de cada etapa del pipeline (collect, write, policy)")
+	for _, n := range names {
+		h := m.stages[n]
+		for i, b := range stageBuckets {
+			p.sample("so1_daemon_stage_duration_seconds_bucket", [][2]string{{"stage", n}, {"le", formatFloat(b)}}, float64(h.buckets[i]))
+		}
+		p.sample("so1_daemon_stage_duration_seconds_bucket", [][2]string{{"stage", n}, {"le", "+Inf"}}, float64(h.count))
+		p.sample("so1_daemon_stage_duration_seconds_sum", [][2]string{{"stage", n}}, h.sum)
+		p.sample("so1_daemon_stage_duration_seconds_count", [][2]string{{"stage", n}}, float64(h.count))
+	}
+
+	p.header("so1_daemon_last_success_timestamp_seconds", "gauge", "Fin de la última corrida sin errores de cada etapa (epoch)")
+	for _, n := range names {
+		if h := m.stages[n]; !h.ultimo.IsZero() {
+			p.sample("so1_daemon_last_success_timestamp_seconds", [][2]string{{"stage", n}}, float64(h.ultimo.UnixNano())/1e9)
+		}
+	}
+
+	p.header("so1_daemon_lote_id", "gauge", "Último id_lote guardado")
+	p.sample("so1_daemon_lote_id", nil, float64(m.ultimoLote))
+
+	if d.cola != nil {
+		p.header("so1_daemon_pipeline_queue_length", "gauge", "Muestras esperando al writer")
+		p.sample("so1_daemon_pipeline_queue_length", nil, float64(len(d.cola)))
+	}
+	p.header("so1_daemon_pipeline_dropped_total", "counter", "Muestras descartadas porque el writer estaba atrasado")
+	p.sample("so1_daemon_pipeline_dropped_total", nil, float64(m.descartadas))
+
+	p.header("so1_daemon_policy_evictions_total", "counter", "Operaciones destructivas exitosas de la política")
+	keys := make([][2]string, 0, len(m.evictions))
+	for k := range m.evictions {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i][0]+keys[i][1] < keys[j][0]+keys[j][1] })
+	for _, k := range keys {
+		p.sample("so1_daemon_policy_evictions_total", [][2]string{{"group", k[0]}, {"action", k[1]}}, float64(m.evictions[k]))
+	}
+
+	if d.stream != nil {
+		subs, dropped := d.stream.stats()
+		p.header("so1_daemon_stream_subscribers", "gauge", "Clientes conectados a /api/stream")
+		p.sample("so1_daemon_stream_subscribers", nil, float64(subs))
+		p.header("so1_daemon_stream_dropped_total", "counter", "Clientes de /api/stream cortados por lentos")
+		p.sample("so1_daemon_stream_dropped_total", nil, float64(dropped))
+	}
+
+	if d.cron != nil {
+		p.header("so1_daemon_cron_runs_total", "counter", "Ejecuciones del job en el scheduler interno")
+		p.sample("so1_daemon_cron_runs_total", [][2]string{{"result", "ok"}}, float64(m.cronRuns[true]))
+		p.sample("so1_daemon_cron_runs_total", [][2]string{{"result", "error"}}, float64(m.cronRuns[false]))
+	}
+
+	p.header("so1_daemon_errors_total", "counter", "Errores por etapa del daemon")
+	stages := make([]string, 0, len(m.errorsStage))
+	for s := range m.errorsStage {
+		stages = append(stages, s)
+	}
+	sort.Strings(stages)
+	for _, s := range stages {
+		p.sample("so1_daemon_errors_total", [][2]string{{"stage", s}}, float64(m.errorsStage[s]))
+	}
+}
+
+func contLabels(c ContainerEntry) [][2]string {
+	return [][2]string{{"container_id", shortID(c.ContainerID)}, {"cgroup", c.CgroupPath}}
+}
+
+type promWriter struct {
+	w io.Writer
+}
+
+func (p promWriter) header(name, typ, help string) {
+	fmt.Fprintf(p.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func (p promWriter) sample(name string, labels [][2]string, v float64) {
+	if len(labels) == 0 {
+		fmt.Fprintf(p.w, "%s %s\n", name, formatFloat(v))
+		return
+	}
+	parts := make([]string, len(labels))
+	for i, l := range labels {
+		parts[i] = l[0] + `="` + escapeLabel(l[1]) + `"`
+	}
+	fmt.Fprintf(p.w, "%s{%s} %s\n", name, strings.Join(parts, ","), formatFloat(v))
+}
+
+func escapeLabel(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return strings.ReplaceAll(s, "\n", `\n`)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
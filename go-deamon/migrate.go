@@ -0,0 +1,291 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
+// Migration es un par NNNN_nombre.up.sql / NNNN_nombre.down.sql
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationState struct {
+	Migration
+	Applied   bool
+	AppliedAt string
+}
+
+const schemaVersionDDL = `
+CREATE TABLE IF NOT EXISTS schema_version (
+  version       INTEGER PRIMARY KEY,
+  nombre        TEXT NOT NULL,
+  aplicada_utc  TEXT NOT NULL
+);
+`
+
+func loadMigrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationsFS, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, e := range entries {
+		name := e.Name()
+		base, dir, ok := strings.Cut(strings.TrimSuffix(name, ".sql"), ".")
+		if !ok || (dir != "up" && dir != "down") {
+			return nil, fmt.Errorf("migración con nombre inválido: %s", name)
+		}
+		num, label, _ := strings.Cut(base, "_")
+		v, err := strconv.Atoi(num)
+		if err != nil || v <= 0 {
+			return nil, fmt.Errorf("migración con versión inválida: %s", name)
+		}
+
+		raw, err := migrationsFS.ReadFile("migrations/" + name)
+		if err != nil {
+			return nil, err
+		}
+
+		m := byVersion[v]
+		if m == nil {
+			m = &Migration{Version: v, Name: label}
+			byVersion[v] = m
+		}
+		if dir == "up" {
+			m.Up = string(raw)
+		} else {
+			m.Down = string(raw)
+		}
+	}
+
+	res := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migración %04d_%s sin up o down", m.Version, m.Name)
+		}
+		res = append(res, *m)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Version < res[j].Version })
+	return res, nil
+}
+
+func appliedVersions() (map[int]string, error) {
+	if _, err := db.Exec(schemaVersionDDL); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`SELECT version, aplicada_utc FROM schema_version`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := map[int]string{}
+	for rows.Next() {
+		var (
+			v  int
+			ts string
+		)
+		if err := rows.Scan(&v, &ts); err != nil {
+			return nil, err
+		}
+		res[v] = ts
+	}
+	return res, rows.Err()
+}
+
+func MigrationStatus() ([]MigrationState, error) {
+	all, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedVersions()
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]MigrationState, 0, len(all))
+	for _, m := range all {
+		ts, ok := applied[m.Version]
+		res = append(res, MigrationState{Migration: m, Applied: ok, AppliedAt: ts})
+	}
+	return res, nil
+}
+
+// MigrateUp aplica las pendientes hasta target (0 = todas).
+func MigrateUp(target int) ([]Migration, error) {
+	states, err := MigrationStatus()
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, s := range states {
+		if s.Applied || (target > 0 && s.Version > target) {
+			continue
+		}
+		if err := applyMigration(s.Migration, true); err != nil {
+			return done, err
+		}
+		done = append(done, s.Migration)
+	}
+	return done, nil
+}
+
+// MigrateDown revierte las últimas steps migraciones aplicadas.
+func MigrateDown(steps int) ([]Migration, error) {
+	states, err := MigrationStatus()
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for i := len(states) - 1; i >= 0 && len(done) < steps; i-- {
+		if !states[i].Applied {
+			continue
+		}
+		if err := applyMigration(states[i].Migration, false); err != nil {
+			return done, err
+		}
+		done = append(done, states[i].Migration)
+	}
+	return done, nil
+}
+
+// applyMigration corre el SQL y actualiza schema_version en la misma transacción.
+func applyMigration(m Migration, up bool) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	script := m.Down
+	if up {
+		script = m.Up
+	}
+	if _, err := tx.Exec(script); err != nil {
+		return fmt.Errorf("migración %04d_%s: %w", m.Version, m.Name, err)
+	}
+
+	if up {
+		_, err = tx.Exec(`INSERT INTO schema_version (version, nombre, aplicada_utc) VALUES (?, ?, ?)`,
+			m.Version, m.Name, time.Now().UTC().Format(time.RFC3339Nano))
+	} else {
+		_, err = tx.Exec(`DELETE FROM schema_version WHERE version = ?`, m.Version)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// runMigrateCmd implementa `migrate status|up [N]|down [N]`:
+// up N migra hasta la versión N, down N revierte N pasos (por defecto 1).
+func runMigrateCmd(args []string) int {
+	const uso = "migrate status|up [version]|down [pasos] [--json] [flags de configuración]"
+	c, err := parseCmd("migrate", args, nil)
+	if err != nil {
+		return cmdExit(err)
+	}
+	if len(c.args) == 0 || len(c.args) > 2 {
+		return c.uso(uso)
+	}
+	action := c.args[0]
+
+	n := 0
+	if len(c.args) == 2 {
+		v, err := strconv.Atoi(c.args[1])
+		if err != nil {
+			return c.uso(uso)
+		}
+		n = v
+	}
+
+	if err := OpenDB(c.cfg.DBPath); err != nil {
+		return c.fail("DB", err)
+	}
+	defer CloseDB()
+
+	type migracionJSON struct {
+		Version   int    `json:"version"`
+		Nombre    string `json:"nombre"`
+		Aplicada  bool   `json:"aplicada"`
+		AplicadaA string `json:"aplicada_utc,omitempty"`
+	}
+
+	switch action {
+	case "status":
+		states, err := MigrationStatus()
+		if err != nil {
+			return c.fail("migrate", err)
+		}
+		out := []migracionJSON{}
+		for _, s := range states {
+			out = append(out, migracionJSON{s.Version, s.Name, s.Applied, s.AppliedAt})
+		}
+		c.emit(out, func() {
+			for _, s := range states {
+				estado := "pendiente"
+				if s.Applied {
+					estado = "aplicada " + s.AppliedAt
+				}
+				fmt.Printf("%04d_%-28s %s\n", s.Version, s.Name, estado)
+			}
+		})
+		return 0
+
+	case "up", "down":
+		var done []Migration
+		if action == "up" {
+			done, err = MigrateUp(n)
+		} else {
+			if n <= 0 {
+				n = 1
+			}
+			done, err = MigrateDown(n)
+		}
+		out := struct {
+			Accion      string          `json:"accion"`
+			Migraciones []migracionJSON `json:"migraciones"`
+			Error       string          `json:"error,omitempty"`
+		}{Accion: action, Migraciones: []migracionJSON{}}
+		for _, m := range done {
+			out.Migraciones = append(out.Migraciones, migracionJSON{Version: m.Version, Nombre: m.Name, Aplicada: action == "up"})
+		}
+		if err != nil {
+			out.Error = err.Error()
+		}
+		c.emit(out, func() {
+			for _, m := range done {
+				fmt.Printf("%s %04d_%s\n", action, m.Version, m.Name)
+			}
+			if err != nil {
+				fmt.Printf("ERROR migrate: %v\n", err)
+			} else if len(done) == 0 {
+				fmt.Println("nada que hacer")
+			}
+		})
+		if err != nil {
+			return 1
+		}
+		return 0
+
+	default:
+		fmt.Printf("acción desconocida: %s\n", action)
+		return c.uso(uso)
+	}
+}
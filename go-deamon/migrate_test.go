@@ -0,0 +1,137 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// dbTemporal abre una DB vacía en un directorio temporal y la deja como la
+// DB global mientras dure el test (OpenDB abre una sola vez por proceso).
+func dbTemporal(t *testing.T) {
+	t.Helper()
+	nueva, err := sql.Open("sqlite", "file:"+filepath.Join(t.TempDir(), "metrics.db")+"?_pragma=busy_timeout(5000)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	anterior := db
+	db = nueva
+	t.Cleanup(func() {
+		_ = nueva.Close()
+		db = anterior
+	})
+}
+
+// esquema lista "tabla.columna" de todas las tablas y los nombres de índices
+// y vistas, sin schema_version.
+func esquema(t *testing.T) []string {
+	t.Helper()
+	rows, err := db.Query(`
+		SELECT m.name || '.' || p.name FROM sqlite_master m, pragma_table_info(m.name) p
+		WHERE m.type = 'table' AND m.name NOT IN ('schema_version', 'sqlite_sequence')
+		UNION ALL
+		SELECT type || ' ' || name FROM sqlite_master
+		WHERE type IN ('index', 'view') AND name NOT LIKE 'sqlite_autoindex%'
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var res []string
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			t.Fatal(err)
+		}
+		res = append(res, s)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(res)
+	return res
+}
+
+func TestMigrateUpDownUp(t *testing.T) {
+	dbTemporal(t)
+	all, err := loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done, err := MigrateUp(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != len(all) {
+		t.Fatalf("up aplicó %d de %d migraciones", len(done), len(all))
+	}
+
+	// bajando de a una se guarda el esquema de cada versión
+	esquemas := make([][]string, len(all)+1)
+	esquemas[len(all)] = esquema(t)
+	for i := len(all) - 1; i >= 0; i-- {
+		if _, err := MigrateDown(1); err != nil {
+			t.Fatalf("down de %04d_%s: %v", all[i].Version, all[i].Name, err)
+		}
+		esquemas[i] = esquema(t)
+	}
+	if len(esquemas[0]) != 0 {
+		t.Fatalf("quedó esquema después de bajar todo: %v", esquemas[0])
+	}
+
+	// subiendo de a una cada versión tiene que quedar igual que antes
+	for i, m := range all {
+		if _, err := MigrateUp(m.Version); err != nil {
+			t.Fatalf("up de %04d_%s después del down: %v", m.Version, m.Name, err)
+		}
+		if got := esquema(t); !slices.Equal(got, esquemas[i+1]) {
+			t.Fatalf("down/up de %04d_%s cambió el esquema:\n%v\n%v", m.Version, m.Name, got, esquemas[i+1])
+		}
+	}
+}
+
+func TestMigrateUpTarget(t *testing.T) {
+	dbTemporal(t)
+	if _, err := MigrateUp(3); err != nil {
+		t.Fatal(err)
+	}
+	states, err := MigrationStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range states {
+		if s.Applied != (s.Version <= 3) {
+			t.Errorf("%04d_%s aplicada=%v con up 3", s.Version, s.Name, s.Applied)
+		}
+	}
+}
+
+// Una DB creada a mano con dashboard/data/metrics.sql tiene que poder
+// migrarse: 0001 la adopta y las demás agregan lo que falta.
+func TestMigrateUpSobreMetricsSQL(t *testing.T) {
+	base, err := os.ReadFile("../dashboard/data/metrics.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dbTemporal(t)
+	if _, err := MigrateUp(0); err != nil {
+		t.Fatal(err)
+	}
+	completo := esquema(t)
+
+	dbTemporal(t)
+	if _, err := db.Exec(string(base)); err != nil {
+		t.Fatalf("metrics.sql: %v", err)
+	}
+	if _, err := MigrateUp(0); err != nil {
+		t.Fatalf("up sobre metrics.sql: %v", err)
+	}
+	if got := esquema(t); !slices.Equal(got, completo) {
+		t.Errorf("esquema distinto al de una DB nueva:\n%v\n%v", got, completo)
+	}
+}
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS contenedores_snapshot;
+DROP TABLE IF EXISTS procesos_snapshot;
+DROP TABLE IF EXISTS lotes;
@@ -0,0 +1,20 @@
+-- Reporte de la política de contenedores por lote (dry-run o real)
+
+CREATE TABLE IF NOT EXISTS decisiones_politica (
+  id_lote         INTEGER NOT NULL,
+  id_contenedor   TEXT NOT NULL,
+  nombre          TEXT,
+  imagen          TEXT,
+  grupo           TEXT,
+  score           REAL,
+  cpu_pct         REAL,
+  mem_bytes       INTEGER,
+  accion          TEXT NOT NULL,
+  razon           TEXT,
+  detenido        INTEGER NOT NULL DEFAULT 0,
+  dry_run         INTEGER NOT NULL DEFAULT 0,
+  PRIMARY KEY (id_lote, id_contenedor),
+  FOREIGN KEY (id_lote) REFERENCES lotes(id_lote)
+);
+
+CREATE INDEX IF NOT EXISTS idx_dec_lote_accion ON decisiones_politica(id_lote, accion);
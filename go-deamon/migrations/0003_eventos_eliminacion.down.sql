@@ -0,0 +1,3 @@
+DROP VIEW IF EXISTS v_eliminaciones_por_razon;
+DROP VIEW IF EXISTS v_eliminaciones_por_minuto;
+DROP TABLE IF EXISTS eventos_eliminacion;
@@ -0,0 +1,41 @@
+-- Operaciones destructivas ejecutadas por el daemon (stop / rm)
+
+CREATE TABLE IF NOT EXISTS eventos_eliminacion (
+  id_evento       INTEGER PRIMARY KEY AUTOINCREMENT,
+  id_lote         INTEGER,
+  ts_utc          TEXT NOT NULL,
+  id_contenedor   TEXT NOT NULL,
+  nombre          TEXT,
+  imagen          TEXT,
+  grupo           TEXT,
+  cpu_pct         REAL,
+  mem_bytes       INTEGER,
+  score           REAL,
+  accion          TEXT NOT NULL,
+  razon           TEXT,
+  error           TEXT,
+  FOREIGN KEY (id_lote) REFERENCES lotes(id_lote)
+);
+
+CREATE INDEX IF NOT EXISTS idx_evt_lote ON eventos_eliminacion(id_lote);
+CREATE INDEX IF NOT EXISTS idx_evt_ts ON eventos_eliminacion(ts_utc);
+
+-- Vistas para Grafana (time = epoch en segundos, agrupado por minuto)
+CREATE VIEW IF NOT EXISTS v_eliminaciones_por_minuto AS
+SELECT
+  CAST(strftime('%s', substr(ts_utc, 1, 16) || ':00') AS INTEGER) AS time,
+  accion,
+  COUNT(*)                                           AS total,
+  SUM(CASE WHEN error IS NULL THEN 0 ELSE 1 END)     AS errores
+FROM eventos_eliminacion
+GROUP BY 1, accion;
+
+CREATE VIEW IF NOT EXISTS v_eliminaciones_por_razon AS
+SELECT
+  CAST(strftime('%s', substr(ts_utc, 1, 16) || ':00') AS INTEGER) AS time,
+  COALESCE(grupo, '-')  AS grupo,
+  COALESCE(razon, '-')  AS razon,
+  COUNT(*)              AS total
+FROM eventos_eliminacion
+WHERE accion IN ('rm', 'rm_detenido') AND error IS NULL
+GROUP BY 1, grupo, razon;
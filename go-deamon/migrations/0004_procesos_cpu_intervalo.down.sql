@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_proc_lote_cpu_int;
+
+ALTER TABLE procesos_snapshot DROP COLUMN porcentaje_cpu_intervalo;
@@ -0,0 +1,5 @@
+-- CPU% real del proceso en el intervalo entre lotes (delta de utime+stime).
+-- NULL en la primera muestra de cada PID.
+ALTER TABLE procesos_snapshot ADD COLUMN porcentaje_cpu_intervalo REAL;
+
+CREATE INDEX IF NOT EXISTS idx_proc_lote_cpu_int ON procesos_snapshot(id_lote, porcentaje_cpu_intervalo DESC);
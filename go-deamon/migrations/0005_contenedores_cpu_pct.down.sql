@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_cont_lote_cpu_pct;
+
+ALTER TABLE contenedores_snapshot DROP COLUMN porcentaje_cpu;
@@ -0,0 +1,5 @@
+-- CPU% del contenedor en el intervalo entre lotes (delta de cpu_jiffies).
+-- NULL en la primera muestra o cuando el acumulado se reinicia.
+ALTER TABLE contenedores_snapshot ADD COLUMN porcentaje_cpu REAL;
+
+CREATE INDEX IF NOT EXISTS idx_cont_lote_cpu_pct ON contenedores_snapshot(id_lote, porcentaje_cpu DESC);
@@ -0,0 +1,4 @@
+ALTER TABLE lotes DROP COLUMN cpu_total_pct;
+ALTER TABLE lotes DROP COLUMN free_ram_kb;
+ALTER TABLE lotes DROP COLUMN total_ram_kb;
+ALTER TABLE lotes DROP COLUMN colectores;
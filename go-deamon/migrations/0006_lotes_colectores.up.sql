@@ -0,0 +1,10 @@
+-- Cada colector corre con su propio intervalo: un lote guarda solo lo que
+-- se recolectó en ese tick. colectores = lista separada por comas
+-- (procesos,contenedores,cpu); NULL = lote anterior, que traía todo.
+ALTER TABLE lotes ADD COLUMN colectores TEXT;
+
+-- Host: RAM viene con sysinfo (colector procesos), CPU% con el colector cpu.
+-- NULL cuando ese colector no corrió en el lote.
+ALTER TABLE lotes ADD COLUMN total_ram_kb INTEGER;
+ALTER TABLE lotes ADD COLUMN free_ram_kb INTEGER;
+ALTER TABLE lotes ADD COLUMN cpu_total_pct REAL;
@@ -0,0 +1,3 @@
+DROP VIEW IF EXISTS v_generador_por_minuto;
+DROP TABLE IF EXISTS generador_contenedores;
+DROP TABLE IF EXISTS generador_rondas;
@@ -0,0 +1,39 @@
+-- Rondas del generador de contenedores (reemplaza a crear_contenedores.sh).
+-- seed es la semilla efectiva de la ronda: con la misma semilla y el mismo
+-- generador.yaml se repite exactamente la misma mezcla y los mismos nombres.
+CREATE TABLE IF NOT EXISTS generador_rondas (
+  id_ronda   INTEGER PRIMARY KEY AUTOINCREMENT,
+  ts_inicio  TEXT NOT NULL,
+  ts_fin     TEXT,
+  seed       INTEGER NOT NULL,
+  pedidos    INTEGER NOT NULL,
+  creados    INTEGER NOT NULL DEFAULT 0,
+  fallidos   INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_gen_ronda_ts ON generador_rondas(ts_inicio);
+
+-- Un contenedor pedido en la ronda; id_contenedor NULL si docker run falló
+CREATE TABLE IF NOT EXISTS generador_contenedores (
+  id_ronda       INTEGER NOT NULL,
+  orden          INTEGER NOT NULL,
+  ts_utc         TEXT NOT NULL,
+  nombre         TEXT NOT NULL,
+  imagen         TEXT NOT NULL,
+  clase          TEXT,
+  env            TEXT,
+  id_contenedor  TEXT,
+  error          TEXT,
+  PRIMARY KEY (id_ronda, orden),
+  FOREIGN KEY (id_ronda) REFERENCES generador_rondas(id_ronda)
+);
+
+-- Contenedores creados por minuto y clase (time = epoch en segundos)
+CREATE VIEW IF NOT EXISTS v_generador_por_minuto AS
+SELECT
+  CAST(strftime('%s', substr(ts_utc, 1, 16) || ':00') AS INTEGER) AS time,
+  COALESCE(clase, '-')                                 AS clase,
+  SUM(CASE WHEN error IS NULL THEN 1 ELSE 0 END)       AS creados,
+  SUM(CASE WHEN error IS NULL THEN 0 ELSE 1 END)       AS fallidos
+FROM generador_contenedores
+GROUP BY 1, clase;
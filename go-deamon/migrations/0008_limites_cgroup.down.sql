@@ -0,0 +1,2 @@
+DROP VIEW IF EXISTS v_limites_activos;
+DROP TABLE IF EXISTS limites_cgroup;
@@ -0,0 +1,41 @@
+-- Topes de throttle (cpu.max, memory.high, memory.max) que la política puso
+-- antes de desalojar. *_antes es lo que había en el cgroup y se vuelve a
+-- escribir al revertir; ts_revertido NULL = el tope sigue puesto.
+CREATE TABLE IF NOT EXISTS limites_cgroup (
+  id_limite          INTEGER PRIMARY KEY AUTOINCREMENT,
+  id_lote            INTEGER,
+  ts_utc             TEXT NOT NULL,
+  id_contenedor      TEXT NOT NULL,
+  nombre             TEXT,
+  grupo              TEXT,
+  via                TEXT NOT NULL,
+  ruta_cgroup        TEXT,
+  cpu_max            TEXT,
+  memory_high        TEXT,
+  memory_max         TEXT,
+  cpu_max_antes      TEXT,
+  memory_high_antes  TEXT,
+  memory_max_antes   TEXT,
+  ts_revertido       TEXT,
+  motivo_revertido   TEXT,
+  error_revertido    TEXT,
+  FOREIGN KEY (id_lote) REFERENCES lotes(id_lote)
+);
+
+CREATE INDEX IF NOT EXISTS idx_lim_lote ON limites_cgroup(id_lote);
+CREATE INDEX IF NOT EXISTS idx_lim_activos ON limites_cgroup(id_contenedor) WHERE ts_revertido IS NULL;
+
+-- Contenedores con throttle puesto ahora mismo
+CREATE VIEW IF NOT EXISTS v_limites_activos AS
+SELECT
+  id_lote,
+  CAST(strftime('%s', substr(ts_utc, 1, 19)) AS INTEGER) AS time,
+  id_contenedor,
+  COALESCE(nombre, '-') AS nombre,
+  COALESCE(grupo, '-')  AS grupo,
+  via,
+  cpu_max,
+  memory_high,
+  memory_max
+FROM limites_cgroup
+WHERE ts_revertido IS NULL;
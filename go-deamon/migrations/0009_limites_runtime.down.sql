@@ -0,0 +1,3 @@
+ALTER TABLE limites_cgroup DROP COLUMN memory_swap_antes;
+ALTER TABLE limites_cgroup DROP COLUMN memory_antes;
+ALTER TABLE limites_cgroup DROP COLUMN nano_cpus_antes;
@@ -0,0 +1,6 @@
+-- Throttle via runtime: NanoCpus, Memory y MemorySwap que tenía el
+-- contenedor (HostConfig de docker inspect, 0 = sin tope) para volver a
+-- dejarlos igual al revertir. NULL con via cgroup.
+ALTER TABLE limites_cgroup ADD COLUMN nano_cpus_antes INTEGER;
+ALTER TABLE limites_cgroup ADD COLUMN memory_antes INTEGER;
+ALTER TABLE limites_cgroup ADD COLUMN memory_swap_antes INTEGER;
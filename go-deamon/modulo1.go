@@ -1,68 +1,285 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"debug/elf"
+	"errors"
 	"fmt"
+	"os"
 	"os/exec"
+	"strconv"
 	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
 )
 
 type ModuleManager struct {
-	KoPath     string 
-	ModuleName string 
+	KoPath     string
+	ModuleName string
+	Params     []string // parámetros de insmod (nombre=valor)
+
+	ProcPath    string        // entrada que crea el módulo al cargar
+	ProcWait    time.Duration // cuánto esperar a que aparezca ProcPath
+	ProcModules string        // normalmente /proc/modules
+}
+
+// moduleManagers devuelve los módulos del proyecto en orden de carga.
+func moduleManagers(cfg *Config) []ModuleManager {
+	procModules := cfg.ProcRoot + "/modules"
+	return []ModuleManager{
+		{
+			KoPath: cfg.SysinfoKo, ModuleName: "sysinfo", Params: strings.Fields(cfg.SysinfoParams),
+			ProcPath: cfg.SysinfoProc, ProcWait: cfg.ModuleWait, ProcModules: procModules,
+		},
+		{
+			KoPath: cfg.ContinfoKo, ModuleName: "continfo", Params: strings.Fields(cfg.ContinfoParams),
+			ProcPath: cfg.ContinfoProc, ProcWait: cfg.ModuleWait, ProcModules: procModules,
+		},
+	}
+}
+
+// Pasos en los que puede fallar un módulo (ModuleError.Paso)
+const (
+	PasoEstado   = "estado"   // leyendo /proc/modules
+	PasoKo       = "ko"       // el .ko no existe o no es un ELF válido
+	PasoVermagic = "vermagic" // el .ko es de otro kernel
+	PasoParams   = "params"   // parámetro mal formado
+	PasoInsmod   = "insmod"
+	PasoProc     = "proc" // cargó pero la entrada /proc no apareció a tiempo
+	PasoRmmod    = "rmmod"
+)
+
+// ModuleError dice qué módulo falló, en qué paso y por qué.
+type ModuleError struct {
+	Modulo string
+	Paso   string
+	Err    error
 }
 
-func (m ModuleManager) Load() error {
-	loaded, err := isModuleLoaded(m.ModuleName)
+func (e *ModuleError) Error() string {
+	return fmt.Sprintf("módulo %s [%s]: %v", e.Modulo, e.Paso, e.Err)
+}
+
+func (e *ModuleError) Unwrap() error { return e.Err }
+
+var ErrVermagic = errors.New("vermagic no coincide con el kernel")
+
+func (m ModuleManager) fallo(paso string, err error) error {
+	return &ModuleError{Modulo: m.ModuleName, Paso: paso, Err: err}
+}
+
+// ModuleStatus es lo que se sabe del módulo sin tocarlo.
+type ModuleStatus struct {
+	Cargado bool   `json:"cargado"`
+	Estado  string `json:"estado,omitempty"` // Live | Loading | Unloading
+	Tamano  int64  `json:"tamano,omitempty"`
+	Usos    int    `json:"usos"`
+
+	KoExiste   bool   `json:"ko_existe"`
+	Vermagic   string `json:"vermagic,omitempty"`
+	Kernel     string `json:"kernel"`
+	VermagicOK bool   `json:"vermagic_ok"`
+
+	ProcOK bool `json:"proc_ok"`
+}
+
+// Status lee /proc/modules y el .modinfo del .ko; los errores del .ko no
+// impiden reportar el resto.
+func (m ModuleManager) Status() (ModuleStatus, error) {
+	var st ModuleStatus
+	var errs []error
+
+	mods, err := leerProcModules(m.ProcModules)
 	if err != nil {
-		return err
+		errs = append(errs, m.fallo(PasoEstado, err))
 	}
-	if loaded {
-		return nil
+	if pm, ok := mods[m.ModuleName]; ok {
+		st.Cargado, st.Estado, st.Tamano, st.Usos = true, pm.estado, pm.tamano, pm.usos
 	}
-	_, err = runCmd("sudo", "insmod", m.KoPath)
+
+	st.Kernel = kernelRelease()
+	if _, err := os.Stat(m.KoPath); err == nil {
+		st.KoExiste = true
+		st.Vermagic, err = leerVermagic(m.KoPath)
+		if err != nil {
+			errs = append(errs, m.fallo(PasoKo, err))
+		}
+		st.VermagicOK = vermagicCoincide(st.Vermagic, st.Kernel)
+	}
+
+	_, err = os.Stat(m.ProcPath)
+	st.ProcOK = err == nil
+	return st, errors.Join(errs...)
+}
+
+func (m ModuleManager) Load(ctx context.Context) error {
+	mods, err := leerProcModules(m.ProcModules)
 	if err != nil {
-		return fmt.Errorf("insmod falló: %w", err)
+		return m.fallo(PasoEstado, err)
+	}
+
+	if _, loaded := mods[m.ModuleName]; !loaded {
+		// 1) el .ko tiene que ser del kernel que está corriendo
+		vermagic, err := leerVermagic(m.KoPath)
+		if err != nil {
+			return m.fallo(PasoKo, err)
+		}
+		if kernel := kernelRelease(); !vermagicCoincide(vermagic, kernel) {
+			return m.fallo(PasoVermagic, fmt.Errorf("%w: %s compilado para %q, corriendo %q",
+				ErrVermagic, m.KoPath, vermagicRelease(vermagic), kernel))
+		}
+
+		// 2) parámetros nombre=valor
+		for _, p := range m.Params {
+			if k, _, ok := strings.Cut(p, "="); !ok || k == "" {
+				return m.fallo(PasoParams, fmt.Errorf("parámetro inválido %q (se espera nombre=valor)", p))
+			}
+		}
+
+		// 3) insmod
+		args := append([]string{"insmod", m.KoPath}, m.Params...)
+		if _, err := runPrivileged(ctx, args...); err != nil {
+			return m.fallo(PasoInsmod, err)
+		}
+	}
+
+	// 4) la entrada /proc aparece cuando termina el init del módulo
+	if err := esperarArchivo(ctx, m.ProcPath, m.ProcWait); err != nil {
+		return m.fallo(PasoProc, err)
 	}
 	return nil
 }
 
-func (m ModuleManager) Unload() error {
-	loaded, err := isModuleLoaded(m.ModuleName)
+func (m ModuleManager) Unload(ctx context.Context) error {
+	mods, err := leerProcModules(m.ProcModules)
 	if err != nil {
-		return err
+		return m.fallo(PasoEstado, err)
 	}
+	pm, loaded := mods[m.ModuleName]
 	if !loaded {
 		return nil
 	}
-	_, err = runCmd("sudo", "rmmod", m.ModuleName)
-	if err != nil {
-		return fmt.Errorf("rmmod falló: %w", err)
+	if pm.usos > 0 {
+		return m.fallo(PasoRmmod, fmt.Errorf("en uso (%d referencias)", pm.usos))
+	}
+	if _, err := runPrivileged(ctx, "rmmod", m.ModuleName); err != nil {
+		return m.fallo(PasoRmmod, err)
 	}
 	return nil
 }
 
-func isModuleLoaded(moduleName string) (bool, error) {
-	out, err := runCmd("bash", "-lc", "lsmod")
+type procModule struct {
+	tamano int64
+	usos   int
+	estado string
+}
+
+// leerProcModules parsea líneas "nombre tamaño usos deps estado dirección".
+func leerProcModules(path string) (map[string]procModule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	mods := map[string]procModule{}
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		campos := strings.Fields(sc.Text())
+		if len(campos) < 5 {
+			continue
+		}
+		tamano, _ := strconv.ParseInt(campos[1], 10, 64)
+		usos, _ := strconv.Atoi(campos[2])
+		mods[campos[0]] = procModule{tamano: tamano, usos: usos, estado: campos[4]}
+	}
+	return mods, sc.Err()
+}
+
+// leerVermagic saca "vermagic=..." de la sección .modinfo del .ko.
+func leerVermagic(koPath string) (string, error) {
+	f, err := elf.Open(koPath)
 	if err != nil {
-		return false, err
+		return "", err
 	}
-	for _, line := range strings.Split(out, "\n") {
-		fields := strings.Fields(line)
-		if len(fields) > 0 && fields[0] == moduleName {
-			return true, nil
+	defer f.Close()
+
+	sec := f.Section(".modinfo")
+	if sec == nil {
+		return "", fmt.Errorf("%s no tiene sección .modinfo", koPath)
+	}
+	data, err := sec.Data()
+	if err != nil {
+		return "", err
+	}
+	for _, kv := range bytes.Split(data, []byte{0}) {
+		if v, ok := bytes.CutPrefix(kv, []byte("vermagic=")); ok {
+			return string(v), nil
 		}
 	}
-	return false, nil
+	return "", fmt.Errorf("%s no tiene vermagic", koPath)
 }
 
-func runCmd(name string, args ...string) (string, error) {
-	cmd := exec.Command(name, args...)
+// vermagicRelease es el primer campo de vermagic ("6.8.0-45-generic SMP preempt ...").
+func vermagicRelease(vermagic string) string {
+	if f := strings.Fields(vermagic); len(f) > 0 {
+		return f[0]
+	}
+	return ""
+}
+
+func vermagicCoincide(vermagic, kernel string) bool {
+	return kernel != "" && vermagicRelease(vermagic) == kernel
+}
+
+// kernelRelease equivale a `uname -r`.
+func kernelRelease() string {
+	var u unix.Utsname
+	if err := unix.Uname(&u); err != nil {
+		return ""
+	}
+	return unix.ByteSliceToString(u.Release[:])
+}
+
+func esperarArchivo(ctx context.Context, path string, timeout time.Duration) error {
+	limite := time.Now().Add(timeout)
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return nil
+		}
+		if time.Now().After(limite) {
+			return fmt.Errorf("%s no apareció después de %s", path, timeout)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// runPrivileged corre insmod/rmmod con sudo salvo que ya seamos root.
+func runPrivileged(ctx context.Context, args ...string) (string, error) {
+	if os.Geteuid() == 0 {
+		return runCmd(ctx, args[0], args[1:]...)
+	}
+	return runCmd(ctx, "sudo", args...)
+}
+
+// runCmd ejecuta un comando externo; ctx lo mata si se vence (cierre del daemon).
+func runCmd(ctx context.Context, name string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 	err := cmd.Run()
 	if err != nil {
+		if ctx.Err() != nil {
+			return "", fmt.Errorf("%s %v: %w", name, args, ctx.Err())
+		}
 		msg := strings.TrimSpace(stderr.String())
 		if msg == "" {
 			msg = err.Error()
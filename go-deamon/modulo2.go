@@ -4,10 +4,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
 )
 
-const procContinfo = "/proc/continfo_so1_202300644"
-
 type ContInfo struct {
 	Count      int              `json:"Count"`
 	Containers []ContainerEntry `json:"Containers"`
@@ -19,12 +18,29 @@ type ContainerEntry struct {
 	RSSKB       uint64 `json:"RSS_KB"`
 	CPUJiffies  uint64 `json:"CPU_Jiffies"`
 	Procs       uint32 `json:"Procs"`
+
+	// CPU% en el intervalo entre lotes (ContCPUTracker)
+	CPUPercent   float64 `json:"-"`
+	CPUPercentOK bool    `json:"-"`
+}
+
+// Find busca por ID completo o por prefijo (docker ps da IDs de 12 caracteres).
+func (ci *ContInfo) Find(id string) *ContainerEntry {
+	if ci == nil || id == "" {
+		return nil
+	}
+	for i := range ci.Containers {
+		if strings.HasPrefix(ci.Containers[i].ContainerID, id) {
+			return &ci.Containers[i]
+		}
+	}
+	return nil
 }
 
-func ReadContainerInfo() (*ContInfo, error) {
-	raw, err := os.ReadFile(procContinfo)
+func ReadContainerInfo(path string) (*ContInfo, error) {
+	raw, err := os.ReadFile(path)
 	if err != nil {
-		return nil, fmt.Errorf("no se pudo leer %s: %w", procContinfo, err)
+		return nil, fmt.Errorf("no se pudo leer %s: %w", path, err)
 	}
 
 	var ci ContInfo
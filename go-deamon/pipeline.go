@@ -0,0 +1,336 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// El daemon corre como pipeline de tres etapas independientes:
+//
+//	colectores --(cola, pipeline_buffer)--> writer (SQLite, API, stream)
+//	política (intervalo propio, usa la última muestra de contenedores)
+//
+// Docker lento solo atrasa a la política; un SQLite lento llena la cola y
+// se descartan muestras (contadas en /metrics) sin frenar la recolección.
+//
+// Cada colector (procesos, contenedores, cpu) tiene su intervalo y jitter;
+// los que vencen en la misma ventana se leen juntos y forman un lote. Con
+// la configuración por defecto los tres vencen a la vez y cada lote trae
+// todo, como antes.
+
+// Colectores, tal como quedan en lotes.colectores
+const (
+	ColProcesos     = "procesos"
+	ColContenedores = "contenedores"
+	ColCPU          = "cpu"
+)
+
+// ventanaLote: colectores que vencen con menos de esto de diferencia van
+// al mismo lote en lugar de generar dos lotes casi simultáneos.
+const ventanaLote = 500 * time.Millisecond
+
+// muestra es lo que el colector entrega al writer en cada tick; solo trae
+// lo de los colectores que corrieron (el resto queda en nil).
+type muestra struct {
+	ts         time.Time
+	colectores []string
+	si         *SysInfo
+	ci         *ContInfo
+	cpuTotal   *float64
+}
+
+// colector es un lector con su propio calendario.
+type colector struct {
+	nombre string
+	sched  Schedule
+	leer   func(m *muestra) error
+	base   time.Time // vencimiento sin jitter (evita que el intervalo derive)
+	vence  time.Time // próximo vencimiento con jitter
+}
+
+func (c *colector) programar() {
+	c.base = c.base.Add(c.sched.Every)
+	c.vence = c.base.Add(jitter(c.sched.Jitter))
+}
+
+// jitter devuelve un desplazamiento uniforme en [-max, +max].
+func jitter(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int64N(int64(2*max)+1)) - max
+}
+
+// startPipeline arranca las etapas; wait espera a que terminen después de
+// cancelar ctx (el writer vacía la cola antes de salir).
+func (d *Daemon) startPipeline(ctx context.Context) (wait func()) {
+	d.cola = make(chan muestra, d.cfg.PipelineBuffer)
+
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		defer close(d.cola)
+		d.runCollector(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		d.runWriter(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		d.runPolicy(ctx)
+	}()
+	return wg.Wait
+}
+
+// ---------- colector ----------
+
+func (d *Daemon) colectores() []*colector {
+	cfg := d.cfg
+	return []*colector{
+		{nombre: ColProcesos, sched: cfg.ProcesosSchedule(), leer: d.leerProcesos},
+		{nombre: ColContenedores, sched: cfg.ContenedoresSchedule(), leer: d.leerContenedores},
+		{nombre: ColCPU, sched: cfg.CPUSchedule(), leer: d.leerCPU},
+	}
+}
+
+func (d *Daemon) runCollector(ctx context.Context) {
+	cols := d.colectores()
+	now := time.Now()
+	for _, c := range cols {
+		c.base = now
+		c.programar()
+	}
+
+	t := time.NewTimer(0)
+	defer t.Stop()
+	for {
+		proximo := cols[0].vence
+		for _, c := range cols[1:] {
+			if c.vence.Before(proximo) {
+				proximo = c.vence
+			}
+		}
+		t.Reset(time.Until(proximo))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		// todos los que vencen dentro de la ventana van al mismo lote
+		limite := time.Now().Add(ventanaLote)
+		var toca []*colector
+		for _, c := range cols {
+			if !c.vence.After(limite) {
+				toca = append(toca, c)
+				c.programar()
+			}
+		}
+		// si un tick tardó más que el intervalo no se acumulan atrasados
+		now := time.Now()
+		for _, c := range cols {
+			for c.vence.Before(now) {
+				c.programar()
+			}
+		}
+
+		m, err := d.collect(toca)
+		if err != nil {
+			fmt.Printf("WARNING colector: %v\n", err)
+		}
+		if len(m.colectores) == 0 {
+			continue
+		}
+
+		// nunca bloquear la recolección: si el writer está atrasado se descarta
+		select {
+		case d.cola <- m:
+		default:
+			metricas.incDescartada()
+			fmt.Printf("WARNING colector: writer atrasado (%d en cola), muestra descartada\n", len(d.cola))
+		}
+	}
+}
+
+// collect corre los colectores que vencieron; uno que falla queda fuera del
+// lote sin arrastrar a los demás.
+func (d *Daemon) collect(toca []*colector) (m muestra, err error) {
+	start := time.Now()
+	defer func() { metricas.observeStage(StageCollect, time.Since(start), err == nil) }()
+
+	m.ts = start
+	var errs []error
+	for _, c := range toca {
+		if e := c.leer(&m); e != nil {
+			errs = append(errs, e)
+			continue
+		}
+		m.colectores = append(m.colectores, c.nombre)
+	}
+
+	if m.si != nil {
+		cpu := ""
+		if m.cpuTotal != nil {
+			cpu = fmt.Sprintf(" CPU=%.2f%%", *m.cpuTotal)
+		}
+		fmt.Printf("[sysinfo] Total=%dKB Free=%dKB Used=%dKB Procs=%d%s\n",
+			m.si.Totalram, m.si.Freeram, usedRAM(*m.si), m.si.Procs, cpu)
+	}
+	return m, errors.Join(errs...)
+}
+
+// leerProcesos: sysinfo y CPU% de intervalo de cada proceso.
+func (d *Daemon) leerProcesos(m *muestra) error {
+	si, origen, err := d.fuente.SysInfo()
+	d.avisarOrigen(ColProcesos, origen)
+	if err != nil {
+		return stageError("sysinfo", fmt.Errorf("sysinfo (%s): %w", origen, err))
+	}
+	d.procCPU.Update(si.Processes, time.Now())
+	m.si = si
+	return nil
+}
+
+// leerContenedores: continfo y CPU% de intervalo de cada contenedor.
+func (d *Daemon) leerContenedores(m *muestra) error {
+	ci, origen, err := d.fuente.ContInfo()
+	d.avisarOrigen(ColContenedores, origen)
+	if err != nil {
+		return stageError("continfo", fmt.Errorf("continfo (%s): %w", origen, err))
+	}
+	d.contCPU.Update(ci, time.Now())
+	m.ci = ci
+	return nil
+}
+
+// avisarOrigen imprime cuando un colector pasa del módulo a /proc o
+// vuelve (en modo auto, al cargar o descargar el módulo).
+func (d *Daemon) avisarOrigen(col, origen string) {
+	if d.origenes == nil {
+		d.origenes = map[string]string{}
+	}
+	if prev, ok := d.origenes[col]; ok && prev != origen {
+		fmt.Printf("[colector] %s: ahora lee de %s (antes %s)\n", col, origen, prev)
+	}
+	d.origenes[col] = origen
+}
+
+// leerCPU: uso total de CPU del host (/proc/stat).
+func (d *Daemon) leerCPU(m *muestra) error {
+	pct, err := totalCPUPercent(200 * time.Millisecond)
+	if err != nil {
+		return stageError("cpu", fmt.Errorf("cpu: %w", err))
+	}
+	m.cpuTotal = &pct
+	return nil
+}
+
+// ---------- writer ----------
+
+// runWriter guarda cada muestra como lote hasta que el colector cierra la
+// cola. No usa la cancelación de ctx: lo que ya está en cola se guarda.
+func (d *Daemon) runWriter(ctx context.Context) {
+	wctx := context.WithoutCancel(ctx)
+	for m := range d.cola {
+		if err := d.writeLote(wctx, m); err != nil {
+			fmt.Printf("WARNING writer: %v\n", err)
+		}
+	}
+}
+
+func (d *Daemon) writeLote(ctx context.Context, m muestra) (err error) {
+	start := time.Now()
+	defer func() { metricas.observeStage(StageWrite, time.Since(start), err == nil) }()
+
+	idLote, err := GuardarLote(ctx, LoteDatos{
+		Ts:           m.ts,
+		Colectores:   m.colectores,
+		SysInfo:      m.si,
+		Contenedores: m.ci,
+		CPUTotal:     m.cpuTotal,
+	})
+	if err != nil {
+		return stageError("db", err)
+	}
+	metricas.setLote(idLote)
+	d.actual.merge(idLote, m)
+	d.stream.publish("lote", idLote, nuevoLoteEvento(idLote, m))
+
+	procs, conts := 0, 0
+	if m.si != nil {
+		procs = len(m.si.Processes)
+	}
+	if m.ci != nil {
+		conts = len(m.ci.Containers)
+	}
+	fmt.Printf("[LOTE %d] colectores=%s procesos=%d contenedores=%d (%s)\n",
+		idLote, strings.Join(m.colectores, ","), procs, conts, time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// ---------- política ----------
+
+func (d *Daemon) runPolicy(ctx context.Context) {
+	sched := d.cfg.PolicySchedule()
+	t := time.NewTimer(sched.Every + jitter(sched.Jitter))
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		// el próximo turno se cuenta desde que termina este: con Docker
+		// lento la política simplemente corre menos seguido
+		if err := d.policyOnce(ctx); err != nil {
+			fmt.Printf("WARNING política: %v\n", err)
+		}
+		t.Reset(sched.Every + jitter(sched.Jitter))
+	}
+}
+
+// policyOnce aplica la política con la última muestra de continfo y
+// registra decisiones y desalojos en el lote que la trajo.
+func (d *Daemon) policyOnce(ctx context.Context) (err error) {
+	d.actual.mu.RLock()
+	idLote, ci := d.actual.ciLote, d.actual.ci
+	d.actual.mu.RUnlock()
+	if idLote == 0 {
+		return nil // todavía no hay ningún lote con contenedores
+	}
+
+	start := time.Now()
+	defer func() { metricas.observeStage(StagePolicy, time.Since(start), err == nil) }()
+
+	cfg := d.cfg
+	decisions, eventos, polErr := EnforceContainerPolicy(ctx, d.rt, d.pol, PolicyRun{
+		Kernel:  ci,
+		DryRun:  cfg.DryRun,
+		Evictor: d.evictor,
+	})
+
+	// lo que se hizo se registra aunque el daemon esté cerrando
+	if err := GuardarPolitica(context.WithoutCancel(ctx), idLote, cfg.DryRun, decisions, eventos); err != nil {
+		return stageError("db", errors.Join(err, polErr))
+	}
+
+	if cfg.DryRun || cfg.Explain {
+		PrintDecisionReport(os.Stdout, idLote, cfg.DryRun, decisions)
+	}
+	d.stream.publish("politica", idLote, nuevoPoliticaEvento(idLote, cfg.DryRun, decisions, eventos))
+	if len(eventos) > 0 {
+		fmt.Printf("[politica] lote=%d decisiones=%d eventos=%d (%s)\n",
+			idLote, len(decisions), len(eventos), time.Since(start).Round(time.Millisecond))
+	}
+	return stageError("policy", polErr)
+}
@@ -0,0 +1,438 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Policy describe qué contenedores maneja el daemon y cuántos conserva.
+// Se carga de un archivo YAML o JSON (JSON es YAML válido).
+type Policy struct {
+	// Label "clave=valor" (o "clave") que marca los contenedores del daemon:
+	// los listados del runtime se filtran por él, así un contenedor ajeno no
+	// entra a la política aunque su imagen se llame parecido. Vacío = todos
+	// los contenedores, clasificados solo por los grupos.
+	Owner string `yaml:"owner"`
+	// Un contenedor con este label (y valor distinto de "false"/"0") no se
+	// toca en ningún camino destructivo: política, detenidos ni cierre
+	ProtectLabel string `yaml:"protect_label"`
+	// Contenedores que nunca se tocan (ni la política ni la limpieza de detenidos)
+	Protected []Matcher `yaml:"protected"`
+	// Grupos en orden: cada contenedor cae en el primer grupo que lo matchea
+	Groups []PolicyGroup `yaml:"groups"`
+	Score  ScoreFormula  `yaml:"score"`
+	// Cómo se desaloja lo que sobra (ver Evictor)
+	Eviction EvictionPolicy `yaml:"eviction"`
+	// Topes de CPU/memoria que se prueban antes de desalojar (ver Throttler)
+	Throttle ThrottlePolicy `yaml:"throttle"`
+}
+
+// Modos de desalojo (eviction.mode)
+const (
+	EvictKill  = "kill"  // SIGTERM, gracia, SIGKILL y rm
+	EvictPause = "pause" // docker pause: deja de usar CPU, conserva la RAM
+	EvictLimit = "limit" // topes de CPU/memoria (eviction.limit)
+)
+
+type EvictionPolicy struct {
+	Mode string `yaml:"mode"`
+	// Espera entre SIGTERM y SIGKILL (0 = SIGKILL enseguida)
+	Grace time.Duration `yaml:"grace"`
+	// Desalojos por corrida de la política (0 = sin límite); el resto queda
+	// pospuesto para la siguiente, empezando por los de mayor score
+	MaxPerTick int `yaml:"max_per_tick"`
+	// Después de desalojar un contenedor de una clase (label so1.clase o,
+	// sin él, el grupo), no se desaloja otro de esa clase hasta que pase
+	Cooldown time.Duration `yaml:"cooldown"`
+	// Un contenedor pausado o limitado que sigue así más de TTL se mata
+	// (SIGTERM, gracia, SIGKILL y rm) contando para max_per_tick y cooldown
+	// (0 = quedan pausados o limitados hasta que alguien los saque)
+	TTL   time.Duration `yaml:"ttl"`
+	Limit struct {
+		CPUs     float64 `yaml:"cpus"`
+		MemoryMB int64   `yaml:"memory_mb"`
+	} `yaml:"limit"`
+}
+
+// Limits son los topes del modo limit en el formato del runtime, con
+// memory-swap igual a memory: sin swap, y docker no deja bajar memory por
+// debajo del swap que ya tenía.
+func (e EvictionPolicy) Limits() ResourceLimits {
+	mem := e.Limit.MemoryMB * 1024 * 1024
+	return ResourceLimits{NanoCPUs: int64(e.Limit.CPUs * 1e9), Memory: mem, MemorySwap: mem}
+}
+
+// Cómo se ponen los topes de throttle (throttle.via)
+const (
+	ThrottleCgroup  = "cgroup"  // cpu.max, memory.high y memory.max del cgroup v2
+	ThrottleRuntime = "runtime" // docker update: CPU y memoria, sin memory.high
+)
+
+// ThrottlePolicy: un contenedor que la política desalojaría primero recibe
+// topes en su cgroup; solo si después de Wait sigue sobrando se desaloja.
+type ThrottlePolicy struct {
+	Enabled bool   `yaml:"enabled"`
+	Via     string `yaml:"via"`
+	// A qué contenedores se aplica (vacío = a todos los de algún grupo)
+	Match        []Matcher `yaml:"match"`
+	CPUs         float64   `yaml:"cpus"`           // cpu.max = cpus * periodo
+	MemoryHighMB int64     `yaml:"memory_high_mb"` // memory.high: reclama sin matar
+	MemoryMaxMB  int64     `yaml:"memory_max_mb"`  // memory.max: OOM dentro del contenedor
+	// Tiempo mínimo con topes antes de poder desalojarlo
+	Wait time.Duration `yaml:"wait"`
+}
+
+// Applies indica si al contenedor se le pone throttle antes de desalojarlo.
+func (t ThrottlePolicy) Applies(c Container) bool {
+	return t.Enabled && (len(t.Match) == 0 || matchAny(t.Match, c))
+}
+
+type PolicyGroup struct {
+	Name  string    `yaml:"name"`
+	Match []Matcher `yaml:"match"`
+	Keep  int       `yaml:"keep"`
+	// Si hay clases, primero se conserva el de menor score de cada clase
+	// (en orden) y luego se completa "keep" con los de menor score.
+	Classes []PolicyClass `yaml:"classes"`
+}
+
+type PolicyClass struct {
+	Name  string    `yaml:"name"`
+	Match []Matcher `yaml:"match"`
+}
+
+// Matcher: todos los campos definidos deben cumplirse (AND).
+// Una lista de matchers se cumple si alguno se cumple (OR).
+//
+// image/name son globs (* y ?) sobre la cadena completa,
+// image_regex/name_regex son regex de Go y label es "clave" o "clave=glob".
+type Matcher struct {
+	Image      string `yaml:"image,omitempty"`
+	ImageRegex string `yaml:"image_regex,omitempty"`
+	Name       string `yaml:"name,omitempty"`
+	NameRegex  string `yaml:"name_regex,omitempty"`
+	Label      string `yaml:"label,omitempty"`
+
+	image, name *regexp.Regexp
+	labelKey    string
+	labelVal    *regexp.Regexp
+	compiled    bool
+}
+
+// ScoreFormula: score = mem_mb*MemMB + cpu_percent*CPUPercent.
+// Dentro de un grupo se conservan los de menor score.
+type ScoreFormula struct {
+	MemMB      float64 `yaml:"mem_mb"`
+	CPUPercent float64 `yaml:"cpu_percent"`
+}
+
+// DefaultPolicy reproduce la política original (3 bajo, 2 entre cpu/ram
+// intentando conservar uno de cada tipo) sobre los contenedores que creó el
+// generador, identificados por sus labels y no por el nombre de la imagen.
+func DefaultPolicy() *Policy {
+	p := &Policy{
+		Owner:        LabelOwner + "=" + OwnerDaemon,
+		ProtectLabel: LabelProtect,
+		Groups: []PolicyGroup{
+			{
+				Name:  "bajo",
+				Match: []Matcher{{Label: LabelClase + "=bajo"}},
+				Keep:  3,
+			},
+			{
+				Name:  "alto",
+				Match: []Matcher{{Label: LabelClase + "=cpu"}, {Label: LabelClase + "=ram"}},
+				Keep:  2,
+				Classes: []PolicyClass{
+					{Name: "cpu", Match: []Matcher{{Label: LabelClase + "=cpu"}}},
+					{Name: "ram", Match: []Matcher{{Label: LabelClase + "=ram"}}},
+				},
+			},
+		},
+		Score:    ScoreFormula{MemMB: 1, CPUPercent: 10},
+		Eviction: EvictionPolicy{Mode: EvictKill, Grace: 10 * time.Second, TTL: 10 * time.Minute},
+		// apagado: con enabled: true limita a los ruidosos (img_cpu/img_ram)
+		Throttle: ThrottlePolicy{
+			Via:   ThrottleCgroup,
+			Match: []Matcher{{Label: LabelClase + "=cpu"}, {Label: LabelClase + "=ram"}},
+			Wait:  30 * time.Second,
+		},
+	}
+	if err := p.Validate(); err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// LoadPolicy lee y valida el archivo de política. Si path es vacío usa DefaultPolicy.
+func LoadPolicy(path string) (*Policy, error) {
+	if path == "" {
+		return DefaultPolicy(), nil
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("no se pudo leer la política %s: %w", path, err)
+	}
+
+	// sin sección eviction: lo mismo que docker stop (10s de gracia) y los
+	// pausados o limitados se matan a los 10 minutos;
+	// sin sección throttle: apagado
+	base := DefaultPolicy()
+	p := Policy{Eviction: base.Eviction, Throttle: base.Throttle}
+	dec := yaml.NewDecoder(bytes.NewReader(raw))
+	dec.KnownFields(true)
+	if err := dec.Decode(&p); err != nil {
+		return nil, fmt.Errorf("política %s inválida: %w", path, err)
+	}
+
+	if err := p.Validate(); err != nil {
+		return nil, fmt.Errorf("política %s inválida:\n%w", path, err)
+	}
+	return &p, nil
+}
+
+// Validate compila los matchers y reporta todos los errores juntos.
+func (p *Policy) Validate() error {
+	var errs []error
+	add := func(where string, err error) {
+		errs = append(errs, fmt.Errorf("  %s: %w", where, err))
+	}
+
+	if k, _, _ := strings.Cut(p.Owner, "="); p.Owner != "" && strings.TrimSpace(k) == "" {
+		add("owner", fmt.Errorf("label %q sin clave", p.Owner))
+	}
+	if strings.ContainsAny(p.ProtectLabel, "= ") {
+		add("protect_label", fmt.Errorf("%q debe ser solo la clave del label", p.ProtectLabel))
+	}
+	compileList(p.Protected, "protected", add)
+
+	if len(p.Groups) == 0 {
+		add("groups", errors.New("debe haber al menos un grupo"))
+	}
+	seen := map[string]bool{}
+	for i := range p.Groups {
+		g := &p.Groups[i]
+		where := fmt.Sprintf("groups[%d]", i)
+
+		if g.Name == "" {
+			add(where+".name", errors.New("requerido"))
+		} else if seen[g.Name] {
+			add(where+".name", fmt.Errorf("grupo duplicado %q", g.Name))
+		}
+		seen[g.Name] = true
+
+		if g.Keep < 0 {
+			add(where+".keep", fmt.Errorf("no puede ser negativo (%d)", g.Keep))
+		}
+		if len(g.Match) == 0 {
+			add(where+".match", errors.New("debe tener al menos un matcher"))
+		}
+		compileList(g.Match, where+".match", add)
+
+		for j := range g.Classes {
+			cw := fmt.Sprintf("%s.classes[%d]", where, j)
+			if g.Classes[j].Name == "" {
+				add(cw+".name", errors.New("requerido"))
+			}
+			if len(g.Classes[j].Match) == 0 {
+				add(cw+".match", errors.New("debe tener al menos un matcher"))
+			}
+			compileList(g.Classes[j].Match, cw+".match", add)
+		}
+	}
+
+	if p.Score.MemMB < 0 || p.Score.CPUPercent < 0 {
+		add("score", errors.New("los pesos no pueden ser negativos"))
+	}
+	if p.Score.MemMB == 0 && p.Score.CPUPercent == 0 {
+		add("score", errors.New("al menos un peso debe ser > 0"))
+	}
+
+	ev := &p.Eviction
+	switch ev.Mode {
+	case "":
+		ev.Mode = EvictKill
+	case EvictKill, EvictPause, EvictLimit:
+	default:
+		add("eviction.mode", fmt.Errorf("debe ser kill, pause o limit (%q)", ev.Mode))
+	}
+	if ev.Grace < 0 || ev.Cooldown < 0 || ev.MaxPerTick < 0 || ev.TTL < 0 {
+		add("eviction", errors.New("grace, cooldown, max_per_tick y ttl no pueden ser negativos"))
+	}
+	if ev.Limit.CPUs < 0 || ev.Limit.MemoryMB < 0 {
+		add("eviction.limit", errors.New("cpus y memory_mb no pueden ser negativos"))
+	}
+	if ev.Mode == EvictLimit && ev.Limit.CPUs == 0 && ev.Limit.MemoryMB == 0 {
+		add("eviction.limit", errors.New("el modo limit necesita cpus o memory_mb"))
+	}
+
+	th := &p.Throttle
+	switch th.Via {
+	case "":
+		th.Via = ThrottleCgroup
+	case ThrottleCgroup, ThrottleRuntime:
+	default:
+		add("throttle.via", fmt.Errorf("debe ser cgroup o runtime (%q)", th.Via))
+	}
+	if th.CPUs < 0 || th.MemoryHighMB < 0 || th.MemoryMaxMB < 0 || th.Wait < 0 {
+		add("throttle", errors.New("cpus, memory_high_mb, memory_max_mb y wait no pueden ser negativos"))
+	}
+	if th.Enabled && th.CPUs == 0 && th.MemoryHighMB == 0 && th.MemoryMaxMB == 0 {
+		add("throttle", errors.New("enabled necesita cpus, memory_high_mb o memory_max_mb"))
+	}
+	if th.MemoryHighMB > 0 && th.MemoryMaxMB > 0 && th.MemoryHighMB > th.MemoryMaxMB {
+		add("throttle", fmt.Errorf("memory_high_mb (%d) no puede superar memory_max_mb (%d)", th.MemoryHighMB, th.MemoryMaxMB))
+	}
+	if th.Via == ThrottleRuntime && th.MemoryHighMB > 0 {
+		add("throttle.memory_high_mb", errors.New("docker update no maneja memory.high; usar via: cgroup"))
+	}
+	compileList(th.Match, "throttle.match", add)
+
+	return errors.Join(errs...)
+}
+
+func compileList(ms []Matcher, where string, add func(string, error)) {
+	for i := range ms {
+		if err := ms[i].compile(); err != nil {
+			add(fmt.Sprintf("%s[%d]", where, i), err)
+		}
+	}
+}
+
+func (m *Matcher) compile() error {
+	if m.Image != "" && m.ImageRegex != "" {
+		return errors.New("usar image o image_regex, no ambos")
+	}
+	if m.Name != "" && m.NameRegex != "" {
+		return errors.New("usar name o name_regex, no ambos")
+	}
+
+	var err error
+	if m.image, err = globOrRegex(m.Image, m.ImageRegex); err != nil {
+		return fmt.Errorf("image: %w", err)
+	}
+	if m.name, err = globOrRegex(m.Name, m.NameRegex); err != nil {
+		return fmt.Errorf("name: %w", err)
+	}
+
+	m.labelKey, m.labelVal = "", nil
+	if m.Label != "" {
+		k, v, hasVal := strings.Cut(m.Label, "=")
+		k = strings.TrimSpace(k)
+		if k == "" {
+			return fmt.Errorf("label %q sin clave", m.Label)
+		}
+		m.labelKey = k
+		if hasVal {
+			m.labelVal = globToRegexp(v)
+		}
+	}
+
+	if m.image == nil && m.name == nil && m.labelKey == "" {
+		return errors.New("matcher vacío (definir image, name o label)")
+	}
+	m.compiled = true
+	return nil
+}
+
+func globOrRegex(glob, re string) (*regexp.Regexp, error) {
+	if re != "" {
+		return regexp.Compile(re)
+	}
+	if glob != "" {
+		return globToRegexp(glob), nil
+	}
+	return nil, nil
+}
+
+// globToRegexp: a diferencia de path.Match, "*" también cruza "/"
+// (las imágenes tienen registry/repo:tag).
+func globToRegexp(glob string) *regexp.Regexp {
+	q := regexp.QuoteMeta(glob)
+	q = strings.ReplaceAll(q, `\*`, ".*")
+	q = strings.ReplaceAll(q, `\?`, ".")
+	return regexp.MustCompile("^" + q + "$")
+}
+
+func (m *Matcher) Matches(c Container) bool {
+	if !m.compiled {
+		if err := m.compile(); err != nil {
+			return false
+		}
+	}
+	if m.image != nil && !m.image.MatchString(c.Image) {
+		return false
+	}
+	if m.name != nil && !m.name.MatchString(c.Name) {
+		return false
+	}
+	if m.labelKey != "" {
+		v, ok := c.Labels[m.labelKey]
+		if !ok {
+			return false
+		}
+		if m.labelVal != nil && !m.labelVal.MatchString(v) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchAny(ms []Matcher, c Container) bool {
+	for i := range ms {
+		if ms[i].Matches(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// OwnerLabels es el filtro para ListRunning/ListExited (nil = sin filtro).
+func (p *Policy) OwnerLabels() []string {
+	if p.Owner == "" {
+		return nil
+	}
+	return []string{p.Owner}
+}
+
+// IsOwned indica si el contenedor tiene el label de dueño.
+func (p *Policy) IsOwned(c Container) bool {
+	return tieneLabels(c.Labels, p.OwnerLabels())
+}
+
+func (p *Policy) IsProtected(c Container) bool {
+	if p.ProtectLabel != "" {
+		if v, ok := c.Labels[p.ProtectLabel]; ok && v != "false" && v != "0" {
+			return true
+		}
+	}
+	return matchAny(p.Protected, c)
+}
+
+// GroupOf devuelve el grupo del contenedor o nil si no es del proyecto.
+func (p *Policy) GroupOf(c Container) *PolicyGroup {
+	for i := range p.Groups {
+		if matchAny(p.Groups[i].Match, c) {
+			return &p.Groups[i]
+		}
+	}
+	return nil
+}
+
+// Owns indica si el daemon puede borrar el contenedor (suyo, de algún grupo y no protegido).
+func (p *Policy) Owns(c Container) bool {
+	return p.IsOwned(c) && !p.IsProtected(c) && p.GroupOf(c) != nil
+}
+
+func (s ScoreFormula) Of(c Container) float64 {
+	memMB := float64(c.MemBytes) / (1024.0 * 1024.0)
+	return memMB*s.MemMB + c.CPUPerc*s.CPUPercent
+}
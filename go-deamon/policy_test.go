@@ -0,0 +1,86 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPolicyValidate(t *testing.T) {
+	cases := []struct {
+		name string
+		mod  func(p *Policy)
+		err  string // "" = válida; si no, parte del mensaje
+	}{
+		{name: "por defecto", mod: func(p *Policy) {}},
+		{name: "owner sin clave", mod: func(p *Policy) { p.Owner = "=x" }, err: "owner"},
+		{name: "protect_label con valor", mod: func(p *Policy) { p.ProtectLabel = "so1.protect=true" }, err: "protect_label"},
+		{name: "sin grupos", mod: func(p *Policy) { p.Groups = nil }, err: "al menos un grupo"},
+		{name: "grupo duplicado", mod: func(p *Policy) { p.Groups[1].Name = p.Groups[0].Name }, err: "grupo duplicado"},
+		{name: "keep negativo", mod: func(p *Policy) { p.Groups[0].Keep = -1 }, err: "groups[0].keep"},
+		{name: "grupo sin matchers", mod: func(p *Policy) { p.Groups[0].Match = nil }, err: "groups[0].match"},
+		{name: "regex inválida", mod: func(p *Policy) { p.Groups[0].Match = []Matcher{{ImageRegex: "("}} }, err: "groups[0].match[0]"},
+		{name: "clase sin nombre", mod: func(p *Policy) { p.Groups[1].Classes[0].Name = "" }, err: "groups[1].classes[0].name"},
+		{name: "score en cero", mod: func(p *Policy) { p.Score = ScoreFormula{} }, err: "al menos un peso"},
+		{name: "score negativo", mod: func(p *Policy) { p.Score.MemMB = -1 }, err: "no pueden ser negativos"},
+		{name: "modo desconocido", mod: func(p *Policy) { p.Eviction.Mode = "stop" }, err: "eviction.mode"},
+		{name: "ttl negativo", mod: func(p *Policy) { p.Eviction.TTL = -1 }, err: "eviction:"},
+		{name: "limit sin topes", mod: func(p *Policy) { p.Eviction.Mode = EvictLimit }, err: "el modo limit necesita"},
+		{name: "throttle sin topes", mod: func(p *Policy) { p.Throttle.Enabled = true }, err: "enabled necesita"},
+		{name: "memory_high mayor que memory_max", mod: func(p *Policy) {
+			p.Throttle.MemoryHighMB, p.Throttle.MemoryMaxMB = 256, 128
+		}, err: "no puede superar"},
+		{name: "memory_high con via runtime", mod: func(p *Policy) {
+			p.Throttle.Via, p.Throttle.MemoryHighMB = ThrottleRuntime, 64
+		}, err: "throttle.memory_high_mb"},
+		{name: "via desconocida", mod: func(p *Policy) { p.Throttle.Via = "systemd" }, err: "throttle.via"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := DefaultPolicy()
+			tc.mod(p)
+			err := p.Validate()
+			switch {
+			case tc.err == "" && err != nil:
+				t.Fatalf("error inesperado: %v", err)
+			case tc.err != "" && err == nil:
+				t.Fatalf("se esperaba un error con %q", tc.err)
+			case tc.err != "" && !strings.Contains(err.Error(), tc.err):
+				t.Fatalf("error %q no menciona %q", err, tc.err)
+			}
+		})
+	}
+}
+
+func TestPolicyValidateDefaults(t *testing.T) {
+	p := DefaultPolicy()
+	p.Eviction.Mode, p.Throttle.Via = "", ""
+	if err := p.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if p.Eviction.Mode != EvictKill || p.Throttle.Via != ThrottleCgroup {
+		t.Errorf("mode=%q via=%q, se esperaba %q y %q", p.Eviction.Mode, p.Throttle.Via, EvictKill, ThrottleCgroup)
+	}
+}
+
+func TestLoadPolicyEjemplo(t *testing.T) {
+	// politica.yaml es la referencia de la documentación: tiene que cargar
+	p, err := LoadPolicy("politica.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Groups) == 0 {
+		t.Error("politica.yaml sin grupos")
+	}
+
+	// campos desconocidos se rechazan (un typo no debe pasar en silencio)
+	path := filepath.Join(t.TempDir(), "p.yaml")
+	if err := os.WriteFile(path, []byte("groups: []\nkeeep: 3\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadPolicy(path); err == nil || !strings.Contains(err.Error(), "keeep") {
+		t.Errorf("LoadPolicy con campo desconocido: %v", err)
+	}
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"compress/gzip"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Tablas hijas de lotes: se archivan y borran junto con su lote (salvo los
+// throttles de limites_cgroup que siguen puestos, ver podar)
+var tablasPorLote = []string{
+	"procesos_snapshot",
+	"contenedores_snapshot",
+	"decisiones_politica",
+	"eventos_eliminacion",
+	"limites_cgroup",
+}
+
+// Retention poda los lotes viejos en segundo plano en lugar de borrar
+// todo al arrancar. MaxAge y MaxLotes en 0 desactivan cada criterio.
+type Retention struct {
+	MaxAge     time.Duration
+	MaxLotes   int
+	Every      time.Duration
+	Batch      int
+	ArchiveDir string
+}
+
+func (r Retention) Enabled() bool {
+	return r.MaxAge > 0 || r.MaxLotes > 0
+}
+
+// Start corre PruneOnce cada Every hasta que se llame a la función devuelta.
+func (r Retention) Start() (stop func()) {
+	done := make(chan struct{})
+	finished := make(chan struct{})
+
+	go func() {
+		defer close(finished)
+		if !r.Enabled() {
+			return
+		}
+
+		t := time.NewTicker(r.Every)
+		defer t.Stop()
+		for {
+			n, err := r.PruneOnce(done)
+			if err != nil {
+				fmt.Printf("WARNING retención: %v\n", err)
+			} else if n > 0 {
+				fmt.Printf("[retención] lotes podados=%d\n", n)
+			}
+
+			select {
+			case <-done:
+				return
+			case <-t.C:
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-finished
+	}
+}
+
+// PruneOnce poda por lotes de Batch hasta que no quede nada vencido
+// (o hasta que done se cierre). Devuelve cuántos lotes se eliminaron.
+func (r Retention) PruneOnce(done <-chan struct{}) (int, error) {
+	total := 0
+	for {
+		select {
+		case <-done:
+			return total, nil
+		default:
+		}
+
+		ids, err := r.lotesVencidos()
+		if err != nil {
+			return total, err
+		}
+		if len(ids) == 0 {
+			break
+		}
+
+		if err := r.podar(ids); err != nil {
+			return total, err
+		}
+		total += len(ids)
+
+		// respiro para no acaparar la DB frente al loop principal
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	// eventos de cierre (sin lote) también envejecen
+	if r.MaxAge > 0 {
+		cutoff := time.Now().UTC().Add(-r.MaxAge).Format(time.RFC3339Nano)
+		if _, err := db.Exec(`DELETE FROM eventos_eliminacion WHERE id_lote IS NULL AND ts_utc < ?`, cutoff); err != nil {
+			return total, err
+		}
+		// throttles desligados de su lote: solo cuando ya se revirtieron
+		if _, err := db.Exec(`DELETE FROM limites_cgroup WHERE id_lote IS NULL AND ts_revertido IS NOT NULL AND ts_utc < ?`, cutoff); err != nil {
+			return total, err
+		}
+		// las rondas del generador no dependen de un lote: solo envejecen
+		if _, err := db.Exec(`DELETE FROM generador_contenedores WHERE id_ronda IN
+			(SELECT id_ronda FROM generador_rondas WHERE ts_inicio < ?)`, cutoff); err != nil {
+			return total, err
+		}
+		if _, err := db.Exec(`DELETE FROM generador_rondas WHERE ts_inicio < ?`, cutoff); err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+func (r Retention) lotesVencidos() ([]int64, error) {
+	var (
+		conds []string
+		args  []any
+	)
+	if r.MaxAge > 0 {
+		conds = append(conds, `ts_utc < ?`)
+		args = append(args, time.Now().UTC().Add(-r.MaxAge).Format(time.RFC3339Nano))
+	}
+	if r.MaxLotes > 0 {
+		conds = append(conds, `id_lote <= (SELECT MAX(id_lote) FROM lotes) - ?`)
+		args = append(args, r.MaxLotes)
+	}
+	args = append(args, r.Batch)
+
+	rows, err := db.Query(`
+		SELECT id_lote FROM lotes
+		WHERE `+strings.Join(conds, " OR ")+`
+		ORDER BY id_lote
+		LIMIT ?
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// podar archiva (si hay ArchiveDir) y borra un grupo de lotes en una transacción.
+func (r Retention) podar(ids []int64) error {
+	in := make([]string, len(ids))
+	for i, id := range ids {
+		in[i] = strconv.FormatInt(id, 10)
+	}
+	where := "id_lote IN (" + strings.Join(in, ",") + ")"
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if r.ArchiveDir != "" {
+		if err := archivarLotes(tx, r.ArchiveDir, ids, where); err != nil {
+			return fmt.Errorf("archivar lotes %d-%d: %w", ids[0], ids[len(ids)-1], err)
+		}
+	}
+
+	// un throttle sin revertir se desliga del lote en vez de borrarse: es lo
+	// que usan RevertirTodo/RevertirPendientes para dejar el cgroup como estaba
+	if _, err := tx.Exec(`UPDATE limites_cgroup SET id_lote = NULL WHERE ts_revertido IS NULL AND ` + where); err != nil {
+		return err
+	}
+	for _, t := range tablasPorLote {
+		if _, err := tx.Exec(`DELETE FROM ` + t + ` WHERE ` + where); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(`DELETE FROM lotes WHERE ` + where); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// archivarLotes escribe lotes_<desde>-<hasta>.jsonl.gz con una línea
+// {"tabla": ..., "fila": {...}} por cada fila de los lotes.
+func archivarLotes(tx *sql.Tx, dir string, ids []int64, where string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	f, name, err := crearArchivo(dir, fmt.Sprintf("lotes_%d-%d", ids[0], ids[len(ids)-1]))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	zw := gzip.NewWriter(f)
+	enc := json.NewEncoder(zw)
+
+	for _, t := range append([]string{"lotes"}, tablasPorLote...) {
+		if err := volcarTabla(tx, enc, t, where); err != nil {
+			_ = os.Remove(name)
+			return err
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		_ = os.Remove(name)
+		return err
+	}
+	return f.Sync()
+}
+
+// crearArchivo crea <base>.jsonl.gz sin pisar uno existente: después de un
+// --reset los id_lote vuelven a empezar y el rango puede repetirse, así que
+// en ese caso se agrega la hora al nombre.
+func crearArchivo(dir, base string) (*os.File, string, error) {
+	name := filepath.Join(dir, base+".jsonl.gz")
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if errors.Is(err, fs.ErrExist) {
+		name = filepath.Join(dir, base+"_"+time.Now().UTC().Format("20060102T150405.000000000")+".jsonl.gz")
+		f, err = os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	}
+	return f, name, err
+}
+
+func volcarTabla(tx *sql.Tx, enc *json.Encoder, tabla, where string) error {
+	rows, err := tx.Query(`SELECT * FROM ` + tabla + ` WHERE ` + where)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	vals := make([]any, len(cols))
+	ptrs := make([]any, len(cols))
+	for i := range vals {
+		ptrs[i] = &vals[i]
+	}
+
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return err
+		}
+		fila := make(map[string]any, len(cols))
+		for i, c := range cols {
+			if b, ok := vals[i].([]byte); ok {
+				fila[c] = string(b)
+			} else {
+				fila[c] = vals[i]
+			}
+		}
+		if err := enc.Encode(map[string]any{"tabla": tabla, "fila": fila}); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// lotesViejos guarda n lotes de hace un día marcados con colectores.
+func lotesViejos(t *testing.T, n int, colectores string) []int64 {
+	t.Helper()
+	var ids []int64
+	for range n {
+		id, err := GuardarLote(context.Background(), LoteDatos{Ts: time.Now().Add(-24 * time.Hour), Colectores: []string{colectores}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// colectoresArchivados lee el archivo y devuelve los colectores de sus lotes.
+func colectoresArchivados(t *testing.T, path string) []string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var res []string
+	sc := bufio.NewScanner(zr)
+	for sc.Scan() {
+		var l struct {
+			Tabla string         `json:"tabla"`
+			Fila  map[string]any `json:"fila"`
+		}
+		if err := json.Unmarshal(sc.Bytes(), &l); err != nil {
+			t.Fatal(err)
+		}
+		if l.Tabla == "lotes" {
+			res = append(res, l.Fila["colectores"].(string))
+		}
+	}
+	if err := sc.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestRetentionArchivoNoSePisa(t *testing.T) {
+	dbTemporal(t)
+	if _, err := MigrateUp(0); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	r := Retention{MaxAge: time.Hour, Batch: 10, ArchiveDir: dir}
+
+	// después de --reset los id_lote vuelven a empezar: las dos podas
+	// archivan el mismo rango 1-3
+	for _, ronda := range []string{"primera", "segunda"} {
+		if ids := lotesViejos(t, 3, ronda); !slices.Equal(ids, []int64{1, 2, 3}) {
+			t.Fatalf("%s: ids %v, se esperaban 1-3", ronda, ids)
+		}
+		if n, err := r.PruneOnce(nil); err != nil || n != 3 {
+			t.Fatalf("%s: podados %d (err %v), se esperaban 3", ronda, n, err)
+		}
+		if err := ResetDB(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	archivos, err := filepath.Glob(filepath.Join(dir, "lotes_1-3*.jsonl.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(archivos) != 2 {
+		t.Fatalf("archivos %v, se esperaban 2", archivos)
+	}
+	if got := colectoresArchivados(t, filepath.Join(dir, "lotes_1-3.jsonl.gz")); !slices.Equal(got, []string{"primera", "primera", "primera"}) {
+		t.Errorf("el primer archivo tiene %v", got)
+	}
+	otro := archivos[0]
+	if filepath.Base(otro) == "lotes_1-3.jsonl.gz" {
+		otro = archivos[1]
+	}
+	if got := colectoresArchivados(t, otro); !slices.Equal(got, []string{"segunda", "segunda", "segunda"}) {
+		t.Errorf("%s tiene %v", filepath.Base(otro), got)
+	}
+}
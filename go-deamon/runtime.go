@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	goruntime "runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ContainerRuntime abstrae el motor de contenedores que usa la política.
+// Así la política no depende del CLI de docker y se puede probar sin daemon.
+// Todas las llamadas respetan ctx: al cerrar el daemon se cancelan.
+type ContainerRuntime interface {
+	// labels filtra como `docker ps --filter label=...`: cada uno es "clave"
+	// o "clave=valor" y tienen que cumplirse todos.
+	ListRunning(ctx context.Context, labels ...string) ([]Container, error)
+	ListExited(ctx context.Context, labels ...string) ([]Container, error)
+	// Stats devuelve solo ID, CPUPerc y MemBytes de cada contenedor corriendo.
+	Stats(ctx context.Context) ([]Container, error)
+	// Kill manda una señal (SIGTERM, SIGKILL) sin esperar a que termine.
+	Kill(ctx context.Context, id, signal string) error
+	// State devuelve el estado del contenedor: running, paused, exited, ...
+	State(ctx context.Context, id string) (string, error)
+	Pause(ctx context.Context, id string) error
+	// Unpause reanuda un contenedor pausado (docker no le manda SIGTERM a
+	// uno pausado).
+	Unpause(ctx context.Context, id string) error
+	// Update cambia los límites de CPU/memoria de un contenedor corriendo.
+	Update(ctx context.Context, id string, lim ResourceLimits) error
+	// Limits devuelve los límites actuales del contenedor, como los reporta
+	// inspect (0 = sin tope).
+	Limits(ctx context.Context, id string) (ResourceLimits, error)
+	Remove(ctx context.Context, id string) error
+	// Run crea y arranca un contenedor en segundo plano (docker run -d) y
+	// devuelve su ID.
+	Run(ctx context.Context, spec RunSpec) (string, error)
+}
+
+// RunSpec es lo que necesita Run: nombre, imagen, variables de entorno y labels.
+type RunSpec struct {
+	Name   string
+	Image  string
+	Env    map[string]string
+	Labels map[string]string
+}
+
+// tieneLabels aplica el filtro de ListRunning/ListExited del lado del cliente.
+func tieneLabels(have map[string]string, labels []string) bool {
+	for _, l := range labels {
+		k, v, conValor := strings.Cut(l, "=")
+		got, ok := have[k]
+		if !ok || (conValor && got != v) {
+			return false
+		}
+	}
+	return true
+}
+
+// ResourceLimits son los campos NanoCpus, Memory y MemorySwap del
+// HostConfig de docker (nanonúcleos y bytes). En Update 0 = no cambiar ese
+// recurso y SinLimite le quita el tope; Limits devuelve 0 para "sin tope".
+type ResourceLimits struct {
+	NanoCPUs   int64
+	Memory     int64
+	MemorySwap int64
+}
+
+// SinLimite en un campo de ResourceLimits quita ese tope en Update.
+const SinLimite = -1
+
+// restaurar pasa lo que devolvió Limits a lo que hay que mandarle a Update
+// para volver a dejarlo igual: ahí 0 es "no cambiar", no "sin tope".
+func (l ResourceLimits) restaurar() ResourceLimits {
+	sinTope := func(v int64) int64 {
+		if v == 0 {
+			return SinLimite
+		}
+		return v
+	}
+	return ResourceLimits{NanoCPUs: sinTope(l.NanoCPUs), Memory: sinTope(l.Memory), MemorySwap: sinTope(l.MemorySwap)}
+}
+
+// nanoCPUsUpdate: docker no acepta NanoCpus negativo y 0 no cambia nada,
+// así que sin tope de CPU es darle todos los núcleos del host.
+func nanoCPUsUpdate(v int64) int64 {
+	if v < 0 {
+		return int64(goruntime.NumCPU()) * 1e9
+	}
+	return v
+}
+
+// sortedKV devuelve "k=v" ordenado por clave (env y labels en orden estable).
+func sortedKV(m map[string]string) []string {
+	res := make([]string, 0, len(m))
+	for k, v := range m {
+		res = append(res, k+"="+v)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// NewContainerRuntime crea el runtime según su nombre:
+//   - "docker" / "podman": CLI (docker ps, docker stats, ...)
+//   - "docker-api": Docker Engine API por socket unix (sirve también con el socket de Podman)
+//   - "fake": runtime en memoria, vacío
+//
+// timeout es el deadline de cada llamada al motor (0 = solo el de ctx).
+func NewContainerRuntime(kind, socket string, timeout time.Duration) (ContainerRuntime, error) {
+	switch strings.ToLower(strings.TrimSpace(kind)) {
+	case "", "docker":
+		return DockerCLI{Bin: "docker", Timeout: timeout}, nil
+	case "podman":
+		return DockerCLI{Bin: "podman", Timeout: timeout}, nil
+	case "docker-api":
+		return NewDockerAPI(socket, timeout), nil
+	case "fake":
+		return NewFakeRuntime(), nil
+	default:
+		return nil, fmt.Errorf("runtime desconocido: %q", kind)
+	}
+}
+
+// callCtx agrega a ctx el deadline por llamada del runtime.
+func callCtx(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
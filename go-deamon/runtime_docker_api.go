@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultDockerSocket = "/var/run/docker.sock"
+
+// DockerAPI implementa ContainerRuntime hablando directo con la Docker Engine
+// API por el socket unix. Podman expone la misma API (podman system service),
+// así que basta con apuntar Socket a /run/podman/podman.sock.
+type DockerAPI struct {
+	Socket string
+	// Timeout de cada request (0 = solo el deadline del ctx)
+	Timeout time.Duration
+	client  *http.Client
+}
+
+func NewDockerAPI(socket string, timeout time.Duration) *DockerAPI {
+	if socket == "" {
+		socket = defaultDockerSocket
+	}
+	return &DockerAPI{
+		Socket:  socket,
+		Timeout: timeout,
+		client: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", socket)
+				},
+			},
+		},
+	}
+}
+
+type apiContainer struct {
+	ID     string            `json:"Id"`
+	Image  string            `json:"Image"`
+	Names  []string          `json:"Names"`
+	Labels map[string]string `json:"Labels"`
+	State  string            `json:"State"`
+}
+
+type apiStats struct {
+	CPUStats    apiCPUStats `json:"cpu_stats"`
+	PreCPUStats apiCPUStats `json:"precpu_stats"`
+	MemoryStats struct {
+		Usage uint64            `json:"usage"`
+		Stats map[string]uint64 `json:"stats"`
+	} `json:"memory_stats"`
+}
+
+type apiCPUStats struct {
+	CPUUsage struct {
+		TotalUsage  uint64   `json:"total_usage"`
+		PercpuUsage []uint64 `json:"percpu_usage"`
+	} `json:"cpu_usage"`
+	SystemUsage uint64 `json:"system_cpu_usage"`
+	OnlineCPUs  uint32 `json:"online_cpus"`
+}
+
+func (d *DockerAPI) ListRunning(ctx context.Context, labels ...string) ([]Container, error) {
+	return d.list(ctx, url.Values{}, map[string][]string{"label": labels})
+}
+
+func (d *DockerAPI) ListExited(ctx context.Context, labels ...string) ([]Container, error) {
+	q := url.Values{}
+	q.Set("all", "1")
+	return d.list(ctx, q, map[string][]string{"status": {"exited"}, "label": labels})
+}
+
+// list agrega filters (los vacíos se omiten) como JSON en la query.
+func (d *DockerAPI) list(ctx context.Context, q url.Values, filters map[string][]string) ([]Container, error) {
+	for k, v := range filters {
+		if len(v) == 0 {
+			delete(filters, k)
+		}
+	}
+	if len(filters) > 0 {
+		b, err := json.Marshal(filters)
+		if err != nil {
+			return nil, err
+		}
+		q.Set("filters", string(b))
+	}
+
+	var raw []apiContainer
+	if err := d.do(ctx, http.MethodGet, "/containers/json", q, nil, &raw); err != nil {
+		return nil, err
+	}
+
+	res := make([]Container, 0, len(raw))
+	for _, c := range raw {
+		name := ""
+		if len(c.Names) > 0 {
+			name = strings.TrimPrefix(c.Names[0], "/")
+		}
+		res = append(res, Container{ID: c.ID, Image: c.Image, Name: name, Labels: c.Labels, Paused: c.State == "paused"})
+	}
+	return res, nil
+}
+
+// Stats pide /containers/{id}/stats?stream=false en paralelo para cada
+// contenedor corriendo y calcula CPU% igual que `docker stats`.
+func (d *DockerAPI) Stats(ctx context.Context) ([]Container, error) {
+	running, err := d.ListRunning(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]Container, len(running))
+	errs := make([]error, len(running))
+	var wg sync.WaitGroup
+
+	for i, c := range running {
+		wg.Add(1)
+		go func(i int, id string) {
+			defer wg.Done()
+			q := url.Values{}
+			q.Set("stream", "false")
+
+			var st apiStats
+			if err := d.do(ctx, http.MethodGet, "/containers/"+id+"/stats", q, nil, &st); err != nil {
+				errs[i] = err
+				return
+			}
+			res[i] = Container{ID: id, CPUPerc: st.cpuPercent(), MemBytes: st.memUsed()}
+		}(i, c.ID)
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	out := res[:0]
+	for i := range res {
+		// un contenedor que terminó entre el list y el stats no es error
+		if errs[i] != nil {
+			continue
+		}
+		out = append(out, res[i])
+	}
+	return out, nil
+}
+
+func (s apiStats) cpuPercent() float64 {
+	cpuDelta := float64(s.CPUStats.CPUUsage.TotalUsage) - float64(s.PreCPUStats.CPUUsage.TotalUsage)
+	sysDelta := float64(s.CPUStats.SystemUsage) - float64(s.PreCPUStats.SystemUsage)
+	if cpuDelta <= 0 || sysDelta <= 0 {
+		return 0
+	}
+
+	cpus := float64(s.CPUStats.OnlineCPUs)
+	if cpus == 0 {
+		cpus = float64(len(s.CPUStats.CPUUsage.PercpuUsage))
+	}
+	if cpus == 0 {
+		cpus = 1
+	}
+	return cpuDelta / sysDelta * cpus * 100.0
+}
+
+// memUsed descuenta el page cache como lo hace `docker stats`
+// (inactive_file en cgroup v2, cache en v1).
+func (s apiStats) memUsed() uint64 {
+	used := s.MemoryStats.Usage
+	if v, ok := s.MemoryStats.Stats["inactive_file"]; ok && v < used {
+		return used - v
+	}
+	if v, ok := s.MemoryStats.Stats["cache"]; ok && v < used {
+		return used - v
+	}
+	return used
+}
+
+func (d *DockerAPI) Kill(ctx context.Context, id, signal string) error {
+	q := url.Values{}
+	q.Set("signal", signal)
+	return d.do(ctx, http.MethodPost, "/containers/"+id+"/kill", q, nil, nil)
+}
+
+func (d *DockerAPI) State(ctx context.Context, id string) (string, error) {
+	var info struct {
+		State struct {
+			Status string `json:"Status"`
+		} `json:"State"`
+	}
+	if err := d.do(ctx, http.MethodGet, "/containers/"+id+"/json", nil, nil, &info); err != nil {
+		return "", err
+	}
+	return info.State.Status, nil
+}
+
+func (d *DockerAPI) Pause(ctx context.Context, id string) error {
+	return d.do(ctx, http.MethodPost, "/containers/"+id+"/pause", nil, nil, nil)
+}
+
+func (d *DockerAPI) Unpause(ctx context.Context, id string) error {
+	return d.do(ctx, http.MethodPost, "/containers/"+id+"/unpause", nil, nil, nil)
+}
+
+// Update manda los tres campos siempre: para el engine 0 es "no cambiar" y
+// -1 en Memory/MemorySwap es sin tope.
+func (d *DockerAPI) Update(ctx context.Context, id string, lim ResourceLimits) error {
+	body := struct {
+		NanoCpus   int64 `json:"NanoCpus"`
+		Memory     int64 `json:"Memory"`
+		MemorySwap int64 `json:"MemorySwap"`
+	}{nanoCPUsUpdate(lim.NanoCPUs), lim.Memory, lim.MemorySwap}
+	return d.do(ctx, http.MethodPost, "/containers/"+id+"/update", nil, body, nil)
+}
+
+func (d *DockerAPI) Limits(ctx context.Context, id string) (ResourceLimits, error) {
+	var info struct {
+		HostConfig struct {
+			NanoCpus   int64 `json:"NanoCpus"`
+			Memory     int64 `json:"Memory"`
+			MemorySwap int64 `json:"MemorySwap"`
+		} `json:"HostConfig"`
+	}
+	if err := d.do(ctx, http.MethodGet, "/containers/"+id+"/json", nil, nil, &info); err != nil {
+		return ResourceLimits{}, err
+	}
+	h := info.HostConfig
+	return ResourceLimits{NanoCPUs: h.NanoCpus, Memory: h.Memory, MemorySwap: h.MemorySwap}, nil
+}
+
+func (d *DockerAPI) Remove(ctx context.Context, id string) error {
+	return d.do(ctx, http.MethodDelete, "/containers/"+id, nil, nil, nil)
+}
+
+// Run hace lo mismo que `docker run -d`: create y después start.
+func (d *DockerAPI) Run(ctx context.Context, spec RunSpec) (string, error) {
+	q := url.Values{}
+	q.Set("name", spec.Name)
+	body := struct {
+		Image  string            `json:"Image"`
+		Env    []string          `json:"Env,omitempty"`
+		Labels map[string]string `json:"Labels,omitempty"`
+	}{spec.Image, sortedKV(spec.Env), spec.Labels}
+
+	var creado struct {
+		ID string `json:"Id"`
+	}
+	if err := d.do(ctx, http.MethodPost, "/containers/create", q, body, &creado); err != nil {
+		return "", err
+	}
+	if err := d.do(ctx, http.MethodPost, "/containers/"+creado.ID+"/start", nil, nil, nil); err != nil {
+		return creado.ID, err
+	}
+	return creado.ID, nil
+}
+
+// do hace el request; in (si no es nil) va como cuerpo JSON y la respuesta
+// se decodifica en out.
+func (d *DockerAPI) do(ctx context.Context, method, path string, q url.Values, in, out any) error {
+	ctx, cancel := callCtx(ctx, d.Timeout)
+	defer cancel()
+
+	u := "http://docker" + path
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("docker api %s %s: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	// 304 = ya estaba en ese estado
+	if resp.StatusCode == http.StatusNotModified {
+		return nil
+	}
+	if resp.StatusCode >= 300 {
+		var msg struct {
+			Message string `json:"message"`
+		}
+		b, _ := io.ReadAll(resp.Body)
+		if json.Unmarshal(b, &msg) != nil || msg.Message == "" {
+			msg.Message = strings.TrimSpace(string(b))
+		}
+		return fmt.Errorf("docker api %s %s: %d %s", method, path, resp.StatusCode, msg.Message)
+	}
+
+	if out == nil {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// DockerCLI implementa ContainerRuntime invocando el CLI (docker o podman)
+// y parseando la salida de --format separada por "|".
+type DockerCLI struct {
+	Bin string
+	// Timeout de cada invocación del CLI (0 = sin límite propio)
+	Timeout time.Duration
+}
+
+// Sin labels: {{.Labels}} los junta con "," y un valor puede traer comas;
+// se leen aparte con inspect (ver conLabels)
+const psFormat = "{{.ID}}|{{.Image}}|{{.Names}}|{{.State}}"
+
+func (d DockerCLI) bin() string {
+	if d.Bin == "" {
+		return "docker"
+	}
+	return d.Bin
+}
+
+func (d DockerCLI) ListRunning(ctx context.Context, labels ...string) ([]Container, error) {
+	out, err := d.run(ctx, append([]string{"ps", "--format", psFormat}, labelFilters(labels)...)...)
+	if err != nil {
+		return nil, err
+	}
+	return d.conLabels(ctx, parsePsOutput(out))
+}
+
+func (d DockerCLI) ListExited(ctx context.Context, labels ...string) ([]Container, error) {
+	out, err := d.run(ctx, append([]string{"ps", "-a", "--filter", "status=exited", "--format", psFormat}, labelFilters(labels)...)...)
+	if err != nil {
+		return nil, err
+	}
+	return d.conLabels(ctx, parsePsOutput(out))
+}
+
+// inspectLabels: ID completo y labels en JSON, una línea por contenedor
+const inspectLabels = "{{.Id}} {{json .Config.Labels}}"
+
+// conLabels completa los labels con un solo `inspect` para todos. Si falla
+// (un contenedor se borró entre ps e inspect) se repite de a uno y los que
+// ya no existen se descartan.
+func (d DockerCLI) conLabels(ctx context.Context, cs []Container) ([]Container, error) {
+	if len(cs) == 0 {
+		return cs, nil
+	}
+	ids := make([]string, len(cs))
+	for i, c := range cs {
+		ids[i] = c.ID
+	}
+
+	out, err := d.run(ctx, append([]string{"inspect", "--format", inspectLabels}, ids...)...)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		out = ""
+		for _, id := range ids {
+			if uno, err := d.run(ctx, "inspect", "--format", inspectLabels, id); err == nil {
+				out += uno + "\n"
+			}
+		}
+	}
+	porID := map[string]map[string]string{}
+	if err := parseInspectLabels(out, porID); err != nil {
+		return nil, err
+	}
+
+	res := cs[:0]
+	for _, c := range cs {
+		for full, labels := range porID {
+			if strings.HasPrefix(full, c.ID) {
+				c.Labels = labels
+				res = append(res, c)
+				break
+			}
+		}
+	}
+	return res, nil
+}
+
+func parseInspectLabels(out string, porID map[string]map[string]string) error {
+	for _, ln := range strings.Split(strings.TrimSpace(out), "\n") {
+		id, raw, ok := strings.Cut(strings.TrimSpace(ln), " ")
+		if !ok {
+			continue
+		}
+		var labels map[string]string
+		if err := json.Unmarshal([]byte(raw), &labels); err != nil {
+			return fmt.Errorf("labels de %s: %w", shortID(id), err)
+		}
+		porID[id] = labels
+	}
+	return nil
+}
+
+func labelFilters(labels []string) []string {
+	var args []string
+	for _, l := range labels {
+		args = append(args, "--filter", "label="+l)
+	}
+	return args
+}
+
+func (d DockerCLI) Stats(ctx context.Context) ([]Container, error) {
+	out, err := d.run(ctx, "stats", "--no-stream", "--format", "{{.Container}}|{{.CPUPerc}}|{{.MemUsage}}")
+	if err != nil {
+		return nil, err
+	}
+
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	var res []Container
+
+	for _, ln := range lines {
+		ln = strings.TrimSpace(ln)
+		if ln == "" {
+			continue
+		}
+
+		p := strings.Split(ln, "|")
+		if len(p) != 3 {
+			continue
+		}
+
+		id := p[0]
+		cpu, _ := parsePercent(p[1])
+		mem, _ := parseMemUsage(p[2])
+
+		res = append(res, Container{ID: id, CPUPerc: cpu, MemBytes: mem})
+	}
+
+	return res, nil
+}
+
+func (d DockerCLI) Kill(ctx context.Context, id, signal string) error {
+	_, err := d.run(ctx, "kill", "--signal", signal, id)
+	return err
+}
+
+func (d DockerCLI) State(ctx context.Context, id string) (string, error) {
+	out, err := d.run(ctx, "inspect", "--format", "{{.State.Status}}", id)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+func (d DockerCLI) Pause(ctx context.Context, id string) error {
+	_, err := d.run(ctx, "pause", id)
+	return err
+}
+
+func (d DockerCLI) Unpause(ctx context.Context, id string) error {
+	_, err := d.run(ctx, "unpause", id)
+	return err
+}
+
+// Update pasa solo los campos distintos de 0. --memory no acepta -1 (sí
+// --memory-swap): sin tope de memoria es toda la RAM del host.
+func (d DockerCLI) Update(ctx context.Context, id string, lim ResourceLimits) error {
+	args := []string{"update"}
+	if lim.NanoCPUs != 0 {
+		cpus := float64(nanoCPUsUpdate(lim.NanoCPUs)) / 1e9
+		args = append(args, "--cpus", strconv.FormatFloat(cpus, 'f', -1, 64))
+	}
+	if mem := lim.Memory; mem != 0 {
+		if mem < 0 {
+			var si unix.Sysinfo_t
+			if err := unix.Sysinfo(&si); err != nil {
+				return fmt.Errorf("sysinfo: %w", err)
+			}
+			mem = int64(si.Totalram) * int64(si.Unit)
+		}
+		args = append(args, "--memory", strconv.FormatInt(mem, 10))
+	}
+	if lim.MemorySwap != 0 {
+		args = append(args, "--memory-swap", strconv.FormatInt(lim.MemorySwap, 10))
+	}
+	_, err := d.run(ctx, append(args, id)...)
+	return err
+}
+
+func (d DockerCLI) Limits(ctx context.Context, id string) (ResourceLimits, error) {
+	out, err := d.run(ctx, "inspect", "--format", "{{.HostConfig.NanoCpus}} {{.HostConfig.Memory}} {{.HostConfig.MemorySwap}}", id)
+	if err != nil {
+		return ResourceLimits{}, err
+	}
+	var l ResourceLimits
+	if _, err := fmt.Sscan(out, &l.NanoCPUs, &l.Memory, &l.MemorySwap); err != nil {
+		return ResourceLimits{}, fmt.Errorf("inspect %s: %q: %w", shortID(id), strings.TrimSpace(out), err)
+	}
+	return l, nil
+}
+
+func (d DockerCLI) Remove(ctx context.Context, id string) error {
+	_, err := d.run(ctx, "rm", id)
+	return err
+}
+
+func (d DockerCLI) Run(ctx context.Context, spec RunSpec) (string, error) {
+	args := []string{"run", "-d", "--name", spec.Name}
+	for _, kv := range sortedKV(spec.Labels) {
+		args = append(args, "--label", kv)
+	}
+	for _, kv := range sortedKV(spec.Env) {
+		args = append(args, "-e", kv)
+	}
+	out, err := d.run(ctx, append(args, spec.Image)...)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+func parsePsOutput(out string) []Container {
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	var res []Container
+
+	for _, ln := range lines {
+		ln = strings.TrimSpace(ln)
+		if ln == "" {
+			continue
+		}
+
+		p := strings.Split(ln, "|")
+		if len(p) < 3 {
+			continue
+		}
+		c := Container{ID: p[0], Image: p[1], Name: p[2]}
+		if len(p) >= 4 {
+			c.Paused = p[3] == "paused"
+		}
+		res = append(res, c)
+	}
+
+	return res
+}
+
+func parsePercent(s string) (float64, error) {
+	s = strings.TrimSpace(strings.TrimSuffix(s, "%"))
+	if s == "" {
+		return 0, errors.New("percent vacío")
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+func parseMemUsage(s string) (uint64, error) {
+	s = strings.TrimSpace(s)
+	parts := strings.Split(s, "/")
+	if len(parts) < 1 {
+		return 0, errors.New("mem inválido")
+	}
+	used := strings.TrimSpace(parts[0])
+	return parseHumanBytes(used)
+}
+
+var reBytes = regexp.MustCompile(`^\s*([0-9]*\.?[0-9]+)\s*([KMGTP]?i?B|[KMGTP]?B)\s*$`)
+
+func parseHumanBytes(s string) (uint64, error) {
+	m := reBytes.FindStringSubmatch(strings.TrimSpace(s))
+	if len(m) != 3 {
+		return 0, fmt.Errorf("no pude parsear bytes: %q", s)
+	}
+
+	val, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0, err
+	}
+
+	unit := m[2]
+	mult := float64(1)
+
+	switch unit {
+	case "B":
+		mult = 1
+	case "KiB", "KB":
+		mult = 1024
+	case "MiB", "MB":
+		mult = 1024 * 1024
+	case "GiB", "GB":
+		mult = 1024 * 1024 * 1024
+	case "TiB", "TB":
+		mult = 1024 * 1024 * 1024 * 1024
+	default:
+		return 0, fmt.Errorf("unidad desconocida: %q", unit)
+	}
+
+	return uint64(val * mult), nil
+}
+
+func (d DockerCLI) run(ctx context.Context, args ...string) (string, error) {
+	ctx, cancel := callCtx(ctx, d.Timeout)
+	defer cancel()
+
+	cmd := d.bin()
+	c := exec.CommandContext(ctx, cmd, args...)
+	var stdout, stderr bytes.Buffer
+	c.Stdout = &stdout
+	c.Stderr = &stderr
+
+	if err := c.Run(); err != nil {
+		if ctx.Err() != nil {
+			return "", fmt.Errorf("%s %v: %w", cmd, args, ctx.Err())
+		}
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return "", fmt.Errorf("%s %v: %s", cmd, args, msg)
+	}
+	return stdout.String(), nil
+}
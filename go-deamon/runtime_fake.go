@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// FakeRuntime es un ContainerRuntime en memoria para probar la política
+// sin Docker. Registra las señales, qué contenedores terminaron, se
+// pausaron, se limitaron y se borraron.
+type FakeRuntime struct {
+	mu         sync.Mutex
+	containers map[string]*fakeContainer
+	order      []string
+
+	Signals  []string // "<id> <señal>"
+	Stopped  []string
+	Paused   []string
+	Unpaused []string
+	Updated  map[string]ResourceLimits
+	Removed  []string
+	Runs     []RunSpec
+
+	// Contenedores que no terminan con SIGTERM (para probar la escalada)
+	IgnoreTerm map[string]bool
+
+	// Errores a devolver por operación, clave "kill:<id>", "pause:<id>",
+	// "unpause:<id>", "update:<id>", "rm:<id>" o "run:<nombre>"
+	Fail map[string]error
+}
+
+type fakeContainer struct {
+	Container
+	running bool
+	paused  bool
+	limits  ResourceLimits // como las reporta inspect (0 = sin tope)
+}
+
+func NewFakeRuntime() *FakeRuntime {
+	return &FakeRuntime{
+		containers: map[string]*fakeContainer{},
+		Updated:    map[string]ResourceLimits{},
+		IgnoreTerm: map[string]bool{},
+		Fail:       map[string]error{},
+	}
+}
+
+// Add agrega (o reemplaza) un contenedor; CPUPerc y MemBytes se usan como stats.
+func (f *FakeRuntime) Add(c Container, running bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.containers[c.ID]; !ok {
+		f.order = append(f.order, c.ID)
+	}
+	f.containers[c.ID] = &fakeContainer{Container: c, running: running}
+}
+
+func (f *FakeRuntime) ListRunning(ctx context.Context, labels ...string) ([]Container, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return f.list(true, labels), nil
+}
+
+func (f *FakeRuntime) ListExited(ctx context.Context, labels ...string) ([]Container, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return f.list(false, labels), nil
+}
+
+func (f *FakeRuntime) list(running bool, labels []string) []Container {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var res []Container
+	for _, id := range f.order {
+		c, ok := f.containers[id]
+		if !ok || c.running != running || !tieneLabels(c.Labels, labels) {
+			continue
+		}
+		// el listado real no trae stats
+		res = append(res, Container{ID: c.ID, Image: c.Image, Name: c.Name, Labels: c.Labels, Paused: c.paused})
+	}
+	return res
+}
+
+func (f *FakeRuntime) Stats(ctx context.Context) ([]Container, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var res []Container
+	for _, id := range f.order {
+		c, ok := f.containers[id]
+		if !ok || !c.running {
+			continue
+		}
+		res = append(res, Container{ID: c.ID, CPUPerc: c.CPUPerc, MemBytes: c.MemBytes})
+	}
+	return res, nil
+}
+
+// Kill con SIGTERM detiene el contenedor salvo que esté en IgnoreTerm;
+// cualquier otra señal lo detiene siempre. Como docker, a uno pausado solo
+// le llega SIGKILL.
+func (f *FakeRuntime) Kill(ctx context.Context, id, signal string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.Fail["kill:"+id]; err != nil {
+		return err
+	}
+	c, ok := f.containers[id]
+	if !ok {
+		return fmt.Errorf("no existe el contenedor %s", id)
+	}
+	if !c.running {
+		return fmt.Errorf("el contenedor %s no está corriendo", id)
+	}
+	if c.paused && signal != "SIGKILL" {
+		return fmt.Errorf("el contenedor %s está pausado", id)
+	}
+	f.Signals = append(f.Signals, id+" "+signal)
+	if signal == "SIGTERM" && f.IgnoreTerm[id] {
+		return nil
+	}
+	c.running, c.paused = false, false
+	f.Stopped = append(f.Stopped, id)
+	return nil
+}
+
+func (f *FakeRuntime) State(ctx context.Context, id string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	c, ok := f.containers[id]
+	switch {
+	case !ok:
+		return "", fmt.Errorf("no existe el contenedor %s", id)
+	case c.paused:
+		return "paused", nil
+	case c.running:
+		return "running", nil
+	}
+	return "exited", nil
+}
+
+func (f *FakeRuntime) Pause(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.Fail["pause:"+id]; err != nil {
+		return err
+	}
+	c, ok := f.containers[id]
+	if !ok || !c.running {
+		return fmt.Errorf("el contenedor %s no está corriendo", id)
+	}
+	c.paused = true
+	f.Paused = append(f.Paused, id)
+	return nil
+}
+
+func (f *FakeRuntime) Unpause(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.Fail["unpause:"+id]; err != nil {
+		return err
+	}
+	c, ok := f.containers[id]
+	if !ok || !c.paused {
+		return fmt.Errorf("el contenedor %s no está pausado", id)
+	}
+	c.paused = false
+	f.Unpaused = append(f.Unpaused, id)
+	return nil
+}
+
+// Update registra el pedido en Updated y lo aplica sobre los límites del
+// contenedor con la semántica de docker (0 = no cambia, -1 = sin tope).
+func (f *FakeRuntime) Update(ctx context.Context, id string, lim ResourceLimits) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.Fail["update:"+id]; err != nil {
+		return err
+	}
+	c, ok := f.containers[id]
+	if !ok || !c.running {
+		return fmt.Errorf("el contenedor %s no está corriendo", id)
+	}
+	f.Updated[id] = lim
+	for _, campo := range []struct {
+		dst *int64
+		v   int64
+	}{
+		{&c.limits.NanoCPUs, lim.NanoCPUs},
+		{&c.limits.Memory, lim.Memory},
+		{&c.limits.MemorySwap, lim.MemorySwap},
+	} {
+		switch {
+		case campo.v < 0:
+			*campo.dst = 0
+		case campo.v > 0:
+			*campo.dst = campo.v
+		}
+	}
+	return nil
+}
+
+func (f *FakeRuntime) Limits(ctx context.Context, id string) (ResourceLimits, error) {
+	if err := ctx.Err(); err != nil {
+		return ResourceLimits{}, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	c, ok := f.containers[id]
+	if !ok {
+		return ResourceLimits{}, fmt.Errorf("no existe el contenedor %s", id)
+	}
+	return c.limits, nil
+}
+
+func (f *FakeRuntime) Remove(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.Fail["rm:"+id]; err != nil {
+		return err
+	}
+	c, ok := f.containers[id]
+	if !ok {
+		return fmt.Errorf("no existe el contenedor %s", id)
+	}
+	if c.running {
+		return fmt.Errorf("el contenedor %s sigue corriendo", id)
+	}
+	delete(f.containers, id)
+	f.Removed = append(f.Removed, id)
+	return nil
+}
+
+// Run agrega el contenedor corriendo, sin stats; el ID sale del nombre.
+func (f *FakeRuntime) Run(ctx context.Context, spec RunSpec) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.Fail["run:"+spec.Name]; err != nil {
+		return "", err
+	}
+	for _, c := range f.containers {
+		if c.Name == spec.Name {
+			return "", fmt.Errorf("el nombre %s ya está en uso", spec.Name)
+		}
+	}
+	id := fmt.Sprintf("fake%012x", len(f.order)+1)
+	labels := make(map[string]string, len(spec.Labels))
+	for k, v := range spec.Labels {
+		labels[k] = v
+	}
+	f.order = append(f.order, id)
+	f.containers[id] = &fakeContainer{
+		Container: Container{ID: id, Image: spec.Image, Name: spec.Name, Labels: labels},
+		running:   true,
+	}
+	f.Runs = append(f.Runs, spec)
+	return id, nil
+}
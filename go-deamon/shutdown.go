@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// signalContext se cancela con la primera SIGINT/SIGTERM; la segunda
+// fuerza la salida sin esperar al cierre ordenado.
+func signalContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	sig := make(chan os.Signal, 2)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		s := <-sig
+		fmt.Printf("\nSeñal %s: cerrando daemon (otra señal fuerza la salida)...\n", s)
+		cancel()
+
+		s = <-sig
+		fmt.Printf("Señal %s otra vez: salida forzada sin terminar el cierre\n", s)
+		os.Exit(130)
+	}()
+	return ctx
+}
+
+// cierre guarda los pasos de apagado a medida que el daemon arranca y los
+// ejecuta en orden inverso, cada uno con su propio timeout (salvo los de
+// esperar): un paso colgado (docker, sudo rmmod, crontab) no impide que
+// corran los demás.
+type cierre struct {
+	timeout time.Duration
+	pasos   []pasoCierre
+}
+
+type pasoCierre struct {
+	nombre     string
+	fn         func(ctx context.Context) error
+	sinTimeout bool
+}
+
+func (c *cierre) add(nombre string, fn func(ctx context.Context) error) {
+	c.pasos = append(c.pasos, pasoCierre{nombre: nombre, fn: fn})
+}
+
+// esperar agrega un paso que corre sin timeout: goroutines que usan la DB y
+// el throttler, que no pueden seguir vivas cuando los pasos siguientes
+// revierten los throttles y cierran la DB. Si se cuelgan, la segunda señal
+// fuerza la salida.
+func (c *cierre) esperar(nombre string, fn func()) {
+	c.pasos = append(c.pasos, pasoCierre{
+		nombre:     nombre,
+		fn:         func(context.Context) error { fn(); return nil },
+		sinTimeout: true,
+	})
+}
+
+func (c *cierre) run() {
+	for i := len(c.pasos) - 1; i >= 0; i-- {
+		p := c.pasos[i]
+		start := time.Now()
+
+		if p.sinTimeout {
+			_ = p.fn(context.Background())
+			fmt.Printf("[cierre] %s ok (%s)\n", p.nombre, time.Since(start).Round(time.Millisecond))
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+		done := make(chan error, 1)
+		go func() { done <- p.fn(ctx) }()
+
+		select {
+		case err := <-done:
+			if err != nil {
+				fmt.Printf("WARNING cierre %s: %v\n", p.nombre, err)
+			} else {
+				fmt.Printf("[cierre] %s ok (%s)\n", p.nombre, time.Since(start).Round(time.Millisecond))
+			}
+		case <-ctx.Done():
+			fmt.Printf("WARNING cierre %s: sin terminar tras %s, se continúa\n", p.nombre, c.timeout)
+		}
+		cancel()
+	}
+	c.pasos = nil
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// streamBuffer: eventos que puede tener pendientes un suscriptor antes de
+// considerarlo lento y cortarlo (el pipeline nunca se bloquea por un cliente).
+const streamBuffer = 8
+
+// LoteEvento es lo que se empuja por /api/stream (event: lote) al guardar cada lote.
+// Solo trae lo de los colectores que corrieron: sin "procesos" el resumen de
+// RAM y los top quedan vacíos, sin "cpu" cpu_total_pct es null.
+type LoteEvento struct {
+	IDLote       int64           `json:"id_lote"`
+	Ts           time.Time       `json:"ts"`
+	Colectores   []string        `json:"colectores"`
+	Resumen      loteResumenVivo `json:"resumen"`
+	TopRAM       []apiProceso    `json:"top_ram"`
+	TopCPU       []apiProceso    `json:"top_cpu"`
+	Contenedores []apiContenedor `json:"contenedores"`
+}
+
+// PoliticaEvento (event: politica) sale cada vez que corre la política;
+// id_lote es el lote cuya muestra de continfo se usó.
+type PoliticaEvento struct {
+	IDLote        int64            `json:"id_lote"`
+	Ts            time.Time        `json:"ts"`
+	DryRun        bool             `json:"dry_run"`
+	Decisiones    int              `json:"decisiones"`
+	Eliminaciones []apiEliminacion `json:"eliminaciones"`
+}
+
+type loteResumenVivo struct {
+	TotalRAMKB   uint64   `json:"total_ram_kb"`
+	FreeRAMKB    uint64   `json:"free_ram_kb"`
+	UsedRAMKB    uint64   `json:"used_ram_kb"`
+	CPUTotal     *float64 `json:"cpu_total_pct"`
+	Procs        int      `json:"procs"`
+	Contenedores int      `json:"contenedores"`
+}
+
+type apiEliminacion struct {
+	ID     string  `json:"id"`
+	Nombre string  `json:"nombre"`
+	Imagen string  `json:"imagen"`
+	Grupo  string  `json:"grupo"`
+	Score  float64 `json:"score"`
+	Accion string  `json:"accion"`
+	Razon  string  `json:"razon"`
+	Error  string  `json:"error,omitempty"`
+}
+
+func nuevoLoteEvento(idLote int64, m muestra) LoteEvento {
+	ev := LoteEvento{
+		IDLote:       idLote,
+		Ts:           time.Now().UTC(),
+		Colectores:   m.colectores,
+		TopRAM:       []apiProceso{},
+		TopCPU:       []apiProceso{},
+		Contenedores: []apiContenedor{},
+		Resumen:      loteResumenVivo{CPUTotal: m.cpuTotal},
+	}
+
+	if si := m.si; si != nil {
+		ev.Resumen.TotalRAMKB, ev.Resumen.FreeRAMKB, ev.Resumen.Procs = si.Totalram, si.Freeram, si.Procs
+		if si.Totalram >= si.Freeram {
+			ev.Resumen.UsedRAMKB = si.Totalram - si.Freeram
+		}
+
+		procs := append([]Process(nil), si.Processes...)
+		sort.Slice(procs, func(i, j int) bool { return procs[i].RSS > procs[j].RSS })
+		for i := 0; i < len(procs) && i < 5; i++ {
+			ev.TopRAM = append(ev.TopRAM, toAPIProceso(procs[i]))
+		}
+		sort.Slice(procs, func(i, j int) bool { return procs[i].CPUPercent > procs[j].CPUPercent })
+		for i := 0; i < len(procs) && i < 5; i++ {
+			ev.TopCPU = append(ev.TopCPU, toAPIProceso(procs[i]))
+		}
+	}
+
+	if ci := m.ci; ci != nil {
+		ev.Resumen.Contenedores = len(ci.Containers)
+		for _, c := range ci.Containers {
+			ev.Contenedores = append(ev.Contenedores, toAPIContenedor(c))
+		}
+	}
+	return ev
+}
+
+func nuevoPoliticaEvento(idLote int64, dryRun bool, decisions []PolicyDecision, eventos []EventoEliminacion) PoliticaEvento {
+	ev := PoliticaEvento{
+		IDLote:        idLote,
+		Ts:            time.Now().UTC(),
+		DryRun:        dryRun,
+		Decisiones:    len(decisions),
+		Eliminaciones: []apiEliminacion{},
+	}
+	for _, e := range eventos {
+		a := apiEliminacion{
+			ID:     e.Decision.Container.ID,
+			Nombre: e.Decision.Container.Name,
+			Imagen: e.Decision.Container.Image,
+			Grupo:  e.Decision.Group,
+			Score:  e.Decision.Score,
+			Accion: e.Accion,
+			Razon:  e.Decision.Reason,
+		}
+		if e.Err != nil {
+			a.Error = e.Err.Error()
+		}
+		ev.Eliminaciones = append(ev.Eliminaciones, a)
+	}
+	return ev
+}
+
+// streamMsg es un evento SSE ya serializado.
+type streamMsg struct {
+	evento string
+	id     int64
+	data   []byte
+}
+
+// streamHub reparte cada evento a los suscriptores de /api/stream.
+type streamHub struct {
+	mu      sync.Mutex
+	subs    map[chan streamMsg]struct{}
+	closed  bool
+	dropped uint64
+}
+
+func newStreamHub() *streamHub {
+	return &streamHub{subs: map[chan streamMsg]struct{}{}}
+}
+
+func (h *streamHub) subscribe() chan streamMsg {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ch := make(chan streamMsg, streamBuffer)
+	if h.closed {
+		close(ch)
+		return ch
+	}
+	h.subs[ch] = struct{}{}
+	return ch
+}
+
+func (h *streamHub) unsubscribe(ch chan streamMsg) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.subs[ch]; ok {
+		delete(h.subs, ch)
+		close(ch)
+	}
+}
+
+// publish nunca bloquea: si el buffer de un suscriptor está lleno se le
+// cierra el canal y el handler termina la conexión.
+func (h *streamHub) publish(evento string, id int64, v any) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	msg := streamMsg{evento, id, b}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subs {
+		select {
+		case ch <- msg:
+		default:
+			delete(h.subs, ch)
+			close(ch)
+			h.dropped++
+		}
+	}
+}
+
+func (h *streamHub) stats() (subs int, dropped uint64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subs), h.dropped
+}
+
+// closeAll corta todos los streams (para que el Shutdown del server no espere).
+func (h *streamHub) closeAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for ch := range h.subs {
+		delete(h.subs, ch)
+		close(ch)
+	}
+}
+
+// GET /api/stream: Server-Sent Events, un evento "lote" por lote guardado y
+// un "politica" por cada corrida de la política.
+func (d *Daemon) handleStream(w http.ResponseWriter, r *http.Request) {
+	fl, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming no soportado")
+		return
+	}
+
+	ch := d.stream.subscribe()
+	defer d.stream.unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": conectado\n\n")
+	fl.Flush()
+
+	heartbeat := time.NewTicker(15 * time.Second)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+			fl.Flush()
+
+		case msg, ok := <-ch:
+			if !ok {
+				// lento o daemon cerrando: el cliente debe reconectar
+				fmt.Fprint(w, "event: cerrado\ndata: {}\n\n")
+				fl.Flush()
+				return
+			}
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", msg.id, msg.evento, msg.data)
+			fl.Flush()
+		}
+	}
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Throttler pone los topes de pol.Throttle a los contenedores que la
+// política desalojaría, antes de desalojarlos. Recuerda lo que había en
+// el cgroup para dejarlo igual al cerrar el daemon; cada throttle queda en
+// limites_cgroup con el lote que lo decidió.
+type Throttler struct {
+	rt     ContainerRuntime
+	pol    *Policy
+	fuente *Fuente // raíz del cgroup v2
+
+	mu        sync.Mutex
+	aplicados map[string]*LimiteCgroup // ID -> topes puestos
+}
+
+func NewThrottler(rt ContainerRuntime, pol *Policy, fuente *Fuente) *Throttler {
+	return &Throttler{rt: rt, pol: pol, fuente: fuente, aplicados: map[string]*LimiteCgroup{}}
+}
+
+// Archivos del cgroup v2 que toca el throttle
+const (
+	cgCPUMax     = "cpu.max"
+	cgMemoryHigh = "memory.high"
+	cgMemoryMax  = "memory.max"
+)
+
+// cpu.max es "<quota> <periodo>" en µs; el kernel no acepta quota < 1000
+const (
+	cpuPeriodo     = 100000
+	cpuQuotaMinima = 1000
+)
+
+// ValoresCgroup es el contenido de cada archivo ("" = no se toca).
+type ValoresCgroup struct {
+	CPUMax     string
+	MemoryHigh string
+	MemoryMax  string
+}
+
+// archivos en orden de escritura: memoria antes que CPU.
+func (v ValoresCgroup) archivos() [][2]string {
+	var out [][2]string
+	for _, a := range [][2]string{{cgMemoryMax, v.MemoryMax}, {cgMemoryHigh, v.MemoryHigh}, {cgCPUMax, v.CPUMax}} {
+		if a[1] != "" {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+func (v *ValoresCgroup) set(archivo, valor string) {
+	switch archivo {
+	case cgCPUMax:
+		v.CPUMax = valor
+	case cgMemoryHigh:
+		v.MemoryHigh = valor
+	case cgMemoryMax:
+		v.MemoryMax = valor
+	}
+}
+
+// LimiteCgroup es el throttle de un contenedor: lo escrito y lo que había.
+type LimiteCgroup struct {
+	ContainerID string
+	Via         string
+	Ruta        string // relativa a la raíz del cgroup v2 ("" con via runtime)
+	Valores     ValoresCgroup
+	Antes       ValoresCgroup // con via cgroup: lo que había en cada archivo
+	// Con via runtime: NanoCpus, Memory y MemorySwap del contenedor antes
+	// del throttle (de inspect, 0 = sin tope)
+	AntesRuntime ResourceLimits
+	Desde        time.Time
+}
+
+// valoresThrottle pasa la sección throttle al formato de los archivos.
+func valoresThrottle(t ThrottlePolicy) ValoresCgroup {
+	var v ValoresCgroup
+	if t.CPUs > 0 {
+		v.CPUMax = fmt.Sprintf("%d %d", max(int64(t.CPUs*cpuPeriodo), cpuQuotaMinima), cpuPeriodo)
+	}
+	if t.MemoryHighMB > 0 {
+		v.MemoryHigh = strconv.FormatInt(t.MemoryHighMB*1024*1024, 10)
+	}
+	if t.MemoryMaxMB > 0 {
+		v.MemoryMax = strconv.FormatInt(t.MemoryMaxMB*1024*1024, 10)
+	}
+	return v
+}
+
+// desde devuelve cuándo se le puso throttle al contenedor (cero = no tiene).
+func (t *Throttler) desde(id string) time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if lim := t.aplicados[id]; lim != nil {
+		return lim.Desde
+	}
+	return time.Time{}
+}
+
+// Podar olvida los contenedores con throttle que ya no corren (su cgroup
+// desapareció con ellos) y cierra su registro en la DB.
+func (t *Throttler) Podar(ctx context.Context, running []Container) {
+	vivos := map[string]bool{}
+	for _, c := range running {
+		vivos[c.ID] = true
+	}
+
+	t.mu.Lock()
+	var idos []string
+	for id := range t.aplicados {
+		if !vivos[id] {
+			idos = append(idos, id)
+			delete(t.aplicados, id)
+		}
+	}
+	t.mu.Unlock()
+
+	for _, id := range idos {
+		if err := CerrarLimiteCgroup(ctx, id, time.Now().UTC(), "ya no corre", nil); err != nil {
+			fmt.Printf("WARNING throttle %s: %v\n", shortID(id), err)
+		}
+	}
+}
+
+// Aplicar escribe los topes en el cgroup del contenedor (o los pasa por
+// docker update con via runtime) y los recuerda para revertirlos.
+func (t *Throttler) Aplicar(ctx context.Context, c Container) (*LimiteCgroup, error) {
+	th := t.pol.Throttle
+	lim := &LimiteCgroup{ContainerID: c.ID, Via: th.Via, Valores: valoresThrottle(th), Desde: time.Now().UTC()}
+
+	if th.Via == ThrottleRuntime {
+		antes, err := t.rt.Limits(ctx, c.ID)
+		if err != nil {
+			return nil, err
+		}
+		mem := th.MemoryMaxMB * 1024 * 1024
+		err = t.rt.Update(ctx, c.ID, ResourceLimits{NanoCPUs: int64(th.CPUs * 1e9), Memory: mem, MemorySwap: mem})
+		if err != nil {
+			return nil, err
+		}
+		lim.AntesRuntime = antes
+	} else {
+		dir, err := t.dirCgroup(c.CgroupPath)
+		if err != nil {
+			return nil, err
+		}
+		lim.Ruta = c.CgroupPath
+		if lim.Antes, err = escribirCgroup(dir, lim.Valores); err != nil {
+			return nil, err
+		}
+	}
+
+	t.mu.Lock()
+	t.aplicados[c.ID] = lim
+	t.mu.Unlock()
+	return lim, nil
+}
+
+// Olvidar deja de seguir un contenedor sin revertir nada: se desalojó, o
+// eviction limit ya le puso sus propios topes.
+func (t *Throttler) Olvidar(ctx context.Context, id, motivo string) {
+	t.mu.Lock()
+	_, ok := t.aplicados[id]
+	delete(t.aplicados, id)
+	t.mu.Unlock()
+
+	if ok {
+		if err := CerrarLimiteCgroup(ctx, id, time.Now().UTC(), motivo, nil); err != nil {
+			fmt.Printf("WARNING throttle %s: %v\n", shortID(id), err)
+		}
+	}
+}
+
+// RevertirTodo es el paso del cierre: deja cada cgroup como estaba.
+func (t *Throttler) RevertirTodo(ctx context.Context) error {
+	t.mu.Lock()
+	lims := make([]*LimiteCgroup, 0, len(t.aplicados))
+	for _, lim := range t.aplicados {
+		lims = append(lims, lim)
+	}
+	t.aplicados = map[string]*LimiteCgroup{}
+	t.mu.Unlock()
+
+	var errs []error
+	for _, lim := range lims {
+		err := t.revertir(ctx, lim)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("revertir %s: %w", shortID(lim.ContainerID), err))
+		}
+		if e := CerrarLimiteCgroup(ctx, lim.ContainerID, time.Now().UTC(), "cierre", err); e != nil {
+			errs = append(errs, e)
+		}
+	}
+	if len(lims) > 0 {
+		fmt.Printf("[throttle] revertidos=%d errores=%d\n", len(lims), len(errs))
+	}
+	return errors.Join(errs...)
+}
+
+// RevertirPendientes revierte lo que quedó en la DB sin revertir (el daemon
+// anterior murió sin cerrar). Un cgroup que ya no existe no es error.
+func (t *Throttler) RevertirPendientes(ctx context.Context) (int, error) {
+	lims, err := LimitesCgroupActivos(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var errs []error
+	for i := range lims {
+		lim := &lims[i]
+		motivo := "arranque"
+		err := t.revertir(ctx, lim)
+		if errors.Is(err, fs.ErrNotExist) {
+			motivo, err = "ya no corre", nil
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("revertir %s: %w", shortID(lim.ContainerID), err))
+		}
+		if e := CerrarLimiteCgroup(ctx, lim.ContainerID, time.Now().UTC(), motivo, err); e != nil {
+			errs = append(errs, e)
+		}
+	}
+	return len(lims), errors.Join(errs...)
+}
+
+func (t *Throttler) revertir(ctx context.Context, lim *LimiteCgroup) error {
+	if lim.Via == ThrottleRuntime {
+		return t.rt.Update(ctx, lim.ContainerID, lim.AntesRuntime.restaurar())
+	}
+
+	dir, err := t.dirCgroup(lim.Ruta)
+	if err != nil {
+		return err
+	}
+	_, err = escribirCgroup(dir, lim.Antes)
+	return err
+}
+
+// dirCgroup arma el directorio del cgroup del contenedor y verifica que exista.
+func (t *Throttler) dirCgroup(ruta string) (string, error) {
+	if ruta == "" {
+		return "", errors.New("sin ruta de cgroup (el contenedor no está en continfo)")
+	}
+	root, err := t.fuente.cgroupV2Root()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(root, filepath.Clean("/"+ruta))
+	if _, err := os.Stat(dir); err != nil {
+		return "", fmt.Errorf("cgroup %s: %w", ruta, err)
+	}
+	return dir, nil
+}
+
+// escribirCgroup escribe los valores y devuelve lo que había antes. Si un
+// archivo falla, vuelve a dejar los ya escritos como estaban.
+func escribirCgroup(dir string, v ValoresCgroup) (ValoresCgroup, error) {
+	var antes ValoresCgroup
+	var hechos [][2]string
+	for _, a := range v.archivos() {
+		path := filepath.Join(dir, a[0])
+		viejo, err := os.ReadFile(path)
+		if err == nil {
+			err = os.WriteFile(path, []byte(a[1]), 0)
+		}
+		if err != nil {
+			for _, h := range hechos {
+				_ = os.WriteFile(filepath.Join(dir, h[0]), []byte(h[1]), 0)
+			}
+			return ValoresCgroup{}, fmt.Errorf("%s: %w", a[0], err)
+		}
+		antes.set(a[0], strings.TrimSpace(string(viejo)))
+		hechos = append(hechos, [2]string{a[0], strings.TrimSpace(string(viejo))})
+	}
+	return antes, nil
+}
+
+// ejecutarThrottle es el equivalente de ejecutarEliminacion para el
+// throttle, con el mismo control de dueño y protección.
+func ejecutarThrottle(ctx context.Context, thr *Throttler, pol *Policy, d PolicyDecision) EventoEliminacion {
+	ev := EventoEliminacion{Decision: d, Accion: EventoThrottle, Ts: time.Now().UTC()}
+
+	if !pol.IsOwned(d.Container) || pol.IsProtected(d.Container) {
+		ev.Err = fmt.Errorf("%s %s: %w", EventoThrottle, shortID(d.Container.ID), ErrNoPropio)
+		return ev
+	}
+	lim, err := thr.Aplicar(ctx, d.Container)
+	if err != nil {
+		ev.Err = fmt.Errorf("%s %s: %w", EventoThrottle, shortID(d.Container.ID), err)
+		return ev
+	}
+	ev.Limite = lim
+	metricas.incEviction(d.Group, EventoThrottle)
+	return ev
+}
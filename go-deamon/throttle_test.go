@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// cgroupTemporal arma una raíz de cgroup v2 en un directorio temporal con
+// un cgroup por ruta, con los archivos del throttle en sus valores de fábrica.
+func cgroupTemporal(t *testing.T, rutas ...string) *Fuente {
+	t.Helper()
+	root := t.TempDir()
+	escribir(t, filepath.Join(root, "cgroup.controllers"), "cpu memory")
+	for _, r := range rutas {
+		dir := filepath.Join(root, r)
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		escribir(t, filepath.Join(dir, cgCPUMax), "max 100000")
+		escribir(t, filepath.Join(dir, cgMemoryHigh), "max")
+		escribir(t, filepath.Join(dir, cgMemoryMax), "max")
+	}
+	return &Fuente{CgroupRoot: root}
+}
+
+func escribir(t *testing.T, path, s string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(s), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func leerCgroup(t *testing.T, dir string) ValoresCgroup {
+	t.Helper()
+	var v ValoresCgroup
+	for _, a := range []string{cgCPUMax, cgMemoryHigh, cgMemoryMax} {
+		b, err := os.ReadFile(filepath.Join(dir, a))
+		if err != nil {
+			t.Fatal(err)
+		}
+		v.set(a, strings.TrimSpace(string(b)))
+	}
+	return v
+}
+
+var cgroupFabrica = ValoresCgroup{CPUMax: "max 100000", MemoryHigh: "max", MemoryMax: "max"}
+
+func politicaThrottle() *Policy {
+	pol := DefaultPolicy()
+	pol.Throttle = ThrottlePolicy{Enabled: true, Via: ThrottleCgroup, CPUs: 0.25, MemoryHighMB: 96, MemoryMaxMB: 128}
+	return pol
+}
+
+func TestEscribirCgroup(t *testing.T) {
+	f := cgroupTemporal(t, "so1/a")
+	dir := filepath.Join(f.CgroupRoot, "so1/a")
+	v := valoresThrottle(politicaThrottle().Throttle)
+
+	antes, err := escribirCgroup(dir, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if antes != cgroupFabrica {
+		t.Errorf("antes %+v, se esperaba %+v", antes, cgroupFabrica)
+	}
+	if got := leerCgroup(t, dir); got != v {
+		t.Errorf("cgroup %+v, se esperaba %+v", got, v)
+	}
+}
+
+func TestEscribirCgroupRollback(t *testing.T) {
+	f := cgroupTemporal(t, "so1/a")
+	dir := filepath.Join(f.CgroupRoot, "so1/a")
+	// cpu.max se escribe último: si falla, memory.max y memory.high vuelven
+	// a como estaban
+	if err := os.Remove(filepath.Join(dir, cgCPUMax)); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, cgCPUMax), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := escribirCgroup(dir, valoresThrottle(politicaThrottle().Throttle))
+	if err == nil || !strings.Contains(err.Error(), cgCPUMax) {
+		t.Fatalf("err = %v, se esperaba el error de %s", err, cgCPUMax)
+	}
+	for _, a := range []string{cgMemoryHigh, cgMemoryMax} {
+		b, _ := os.ReadFile(filepath.Join(dir, a))
+		if got := strings.TrimSpace(string(b)); got != "max" {
+			t.Errorf("%s = %q después del rollback, se esperaba max", a, got)
+		}
+	}
+}
+
+func TestThrottlerRevertirTodo(t *testing.T) {
+	dbTemporal(t)
+	if _, err := MigrateUp(0); err != nil {
+		t.Fatal(err)
+	}
+	f := cgroupTemporal(t, "so1/a", "so1/b")
+	// b ya tenía topes propios: al revertir vuelven esos, no "max"
+	dirB := filepath.Join(f.CgroupRoot, "so1/b")
+	escribir(t, filepath.Join(dirB, cgCPUMax), "50000 100000")
+	escribir(t, filepath.Join(dirB, cgMemoryMax), "536870912")
+	antesB := leerCgroup(t, dirB)
+
+	ctx := context.Background()
+	thr := NewThrottler(NewFakeRuntime(), politicaThrottle(), f)
+	var eventos []EventoEliminacion
+	for _, id := range []string{"a", "b"} {
+		lim, err := thr.Aplicar(ctx, Container{ID: id, CgroupPath: "so1/" + id})
+		if err != nil {
+			t.Fatal(err)
+		}
+		eventos = append(eventos, EventoEliminacion{Accion: EventoThrottle, Limite: lim, Ts: time.Now()})
+	}
+	if err := InsertarEventosEliminacion(ctx, eventos); err != nil {
+		t.Fatal(err)
+	}
+	if got := leerCgroup(t, dirB); got == antesB {
+		t.Fatal("Aplicar no escribió el cgroup")
+	}
+
+	if err := thr.RevertirTodo(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := leerCgroup(t, filepath.Join(f.CgroupRoot, "so1/a")); got != cgroupFabrica {
+		t.Errorf("a: %+v, se esperaba %+v", got, cgroupFabrica)
+	}
+	if got := leerCgroup(t, dirB); got != antesB {
+		t.Errorf("b: %+v, se esperaba %+v", got, antesB)
+	}
+	if activos, err := LimitesCgroupActivos(ctx); err != nil || len(activos) != 0 {
+		t.Errorf("quedaron %d throttles activos en la DB (err %v)", len(activos), err)
+	}
+}
+
+func TestThrottlerRevertirPendientes(t *testing.T) {
+	dbTemporal(t)
+	if _, err := MigrateUp(0); err != nil {
+		t.Fatal(err)
+	}
+	f := cgroupTemporal(t, "so1/vivo")
+	dir := filepath.Join(f.CgroupRoot, "so1/vivo")
+	ctx := context.Background()
+
+	// lo que dejó puesto un daemon que murió sin cerrar: uno sigue
+	// corriendo y el otro ya no tiene cgroup
+	viejo := NewThrottler(NewFakeRuntime(), politicaThrottle(), f)
+	lim, err := viejo.Aplicar(ctx, Container{ID: "vivo", CgroupPath: "so1/vivo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ido := &LimiteCgroup{ContainerID: "ido", Via: ThrottleCgroup, Ruta: "so1/ido", Valores: lim.Valores, Antes: cgroupFabrica, Desde: time.Now().UTC()}
+	err = InsertarEventosEliminacion(ctx, []EventoEliminacion{
+		{Accion: EventoThrottle, Limite: lim, Ts: time.Now()},
+		{Accion: EventoThrottle, Limite: ido, Ts: time.Now()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// --reset no borra lo que falta revertir
+	if err := ResetDB(); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := NewThrottler(NewFakeRuntime(), politicaThrottle(), f).RevertirPendientes(ctx)
+	if err != nil {
+		t.Fatalf("un cgroup que ya no existe no es error: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("revertidos %d, se esperaban 2", n)
+	}
+	if got := leerCgroup(t, dir); got != cgroupFabrica {
+		t.Errorf("vivo: %+v, se esperaba %+v", got, cgroupFabrica)
+	}
+
+	motivos := map[string]string{}
+	rows, err := db.Query(`SELECT id_contenedor, motivo_revertido FROM limites_cgroup`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, motivo string
+		if err := rows.Scan(&id, &motivo); err != nil {
+			t.Fatal(err)
+		}
+		motivos[id] = motivo
+	}
+	if motivos["vivo"] != "arranque" || motivos["ido"] != "ya no corre" {
+		t.Errorf("motivos %v", motivos)
+	}
+}
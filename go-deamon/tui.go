@@ -0,0 +1,497 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/sys/unix"
+)
+
+// Modo TUI de `daemon sysinfo --tui`: vista tipo top que se refresca leyendo el mismo JSON
+// de /proc/sysinfo_so1_202300644 (y continfo para el panel de contenedores), o lo
+// mismo armado desde /proc si el módulo no está cargado (ver fuente.go).
+//
+// Teclas: ↑/↓ o j/k mover, s cambiar columna de orden, r invertir orden,
+// / filtrar por nombre o cmdline, c limpiar filtro, i inspeccionar,
+// x enviar SIGTERM (con confirmación), q salir.
+
+type tuiColumna struct {
+	titulo string
+	less   func(a, b *Process) bool
+}
+
+var tuiColumnas = []tuiColumna{
+	{"PID", func(a, b *Process) bool { return a.PID < b.PID }},
+	{"NOMBRE", func(a, b *Process) bool { return a.Name < b.Name }},
+	{"RSS", func(a, b *Process) bool { return a.RSS < b.RSS }},
+	{"VSZ", func(a, b *Process) bool { return a.VSZ < b.VSZ }},
+	{"MEM%", func(a, b *Process) bool { return a.MemoryUsage < b.MemoryUsage }},
+	{"CPU%", func(a, b *Process) bool { return a.CPUPercent < b.CPUPercent }},
+}
+
+type tuiModo int
+
+const (
+	modoTabla tuiModo = iota
+	modoFiltro
+	modoConfirmar
+	modoInspeccionar
+)
+
+type tuiState struct {
+	fuente *Fuente
+	origen string // kernel | proc, de la última lectura
+
+	si       SysInfo
+	ci       *ContInfo
+	procCPU  *ProcCPUTracker
+	contCPU  *ContCPUTracker
+	cpuTotal float64
+	errMsg   string
+
+	prevIdle, prevTotal uint64
+
+	visibles []Process
+	sel      int
+	top      int
+	orden    int
+	desc     bool
+	filtro   string
+	entrada  string
+	modo     tuiModo
+	mensaje  string
+	inspPID  int
+}
+
+// runTUI toma la terminal en modo raw hasta que el usuario presiona q.
+func runTUI(fuente *Fuente, every time.Duration) error {
+	fd := int(os.Stdin.Fd())
+	old, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	if err != nil {
+		return fmt.Errorf("la TUI necesita una terminal: %w", err)
+	}
+
+	raw := *old
+	raw.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+	raw.Oflag &^= unix.OPOST
+	raw.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+	raw.Cflag &^= unix.CSIZE | unix.PARENB
+	raw.Cflag |= unix.CS8
+	raw.Cc[unix.VMIN] = 1
+	raw.Cc[unix.VTIME] = 0
+	if err := unix.IoctlSetTermios(fd, unix.TCSETS, &raw); err != nil {
+		return err
+	}
+
+	// pantalla alterna + cursor oculto; se restaura siempre
+	fmt.Print("\x1b[?1049h\x1b[?25l")
+	defer func() {
+		fmt.Print("\x1b[?25h\x1b[?1049l")
+		_ = unix.IoctlSetTermios(fd, unix.TCSETS, old)
+	}()
+
+	st := &tuiState{
+		fuente:  fuente,
+		procCPU: NewProcCPUTracker(fuente.CPUTimeHz, fuente.ProcRoot),
+		contCPU: NewContCPUTracker(fuente.CPUTimeHz),
+		orden:   5,
+		desc:    true,
+	}
+
+	keys := make(chan []byte)
+	go func() {
+		buf := make([]byte, 16)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if err != nil {
+				close(keys)
+				return
+			}
+			k := make([]byte, n)
+			copy(k, buf[:n])
+			keys <- k
+		}
+	}()
+
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	st.refrescar()
+	st.dibujar()
+
+	for {
+		select {
+		case <-ticker.C:
+			st.refrescar()
+		case k, ok := <-keys:
+			if !ok || st.tecla(k) {
+				return nil
+			}
+		}
+		st.dibujar()
+	}
+}
+
+func (st *tuiState) refrescar() {
+	st.errMsg = ""
+
+	si, origen, err := st.fuente.SysInfo()
+	st.origen = origen
+	if err != nil {
+		st.errMsg = err.Error()
+		return
+	}
+	now := time.Now()
+	st.procCPU.Update(si.Processes, now)
+	st.si = *si
+
+	if ci, _, err := st.fuente.ContInfo(); err == nil {
+		st.contCPU.Update(ci, now)
+		st.ci = ci
+	} else {
+		st.ci = nil
+	}
+
+	if idle, total, err := readCPUStat(); err == nil {
+		st.cpuTotal = st.cpuDesde(idle, total)
+	}
+
+	st.aplicarVista()
+}
+
+// cpuDesde usa la lectura anterior de /proc/stat, así no hay que dormir
+// dentro del refresco como hace totalCPUPercent.
+func (st *tuiState) cpuDesde(idle, total uint64) float64 {
+	prevIdle, prevTotal := st.prevIdle, st.prevTotal
+	st.prevIdle, st.prevTotal = idle, total
+	if prevTotal == 0 || total <= prevTotal {
+		return st.cpuTotal
+	}
+	dt := float64(total - prevTotal)
+	return (dt - float64(idle-prevIdle)) / dt * 100.0
+}
+
+// aplicarVista filtra y ordena, manteniendo seleccionado el mismo PID.
+func (st *tuiState) aplicarVista() {
+	selPID := -1
+	if st.sel >= 0 && st.sel < len(st.visibles) {
+		selPID = st.visibles[st.sel].PID
+	}
+
+	f := strings.ToLower(st.filtro)
+	st.visibles = st.visibles[:0]
+	for _, p := range st.si.Processes {
+		if f != "" && !strings.Contains(strings.ToLower(p.Name), f) && !strings.Contains(strings.ToLower(p.Cmdline), f) {
+			continue
+		}
+		st.visibles = append(st.visibles, p)
+	}
+
+	less := tuiColumnas[st.orden].less
+	sort.SliceStable(st.visibles, func(i, j int) bool {
+		if st.desc {
+			return less(&st.visibles[j], &st.visibles[i])
+		}
+		return less(&st.visibles[i], &st.visibles[j])
+	})
+
+	st.sel = 0
+	for i, p := range st.visibles {
+		if p.PID == selPID {
+			st.sel = i
+			break
+		}
+	}
+}
+
+// tecla procesa una pulsación; devuelve true para salir.
+func (st *tuiState) tecla(k []byte) bool {
+	s := string(k)
+
+	switch st.modo {
+	case modoFiltro:
+		switch {
+		case s == "\r" || s == "\n":
+			st.filtro, st.modo = st.entrada, modoTabla
+			st.aplicarVista()
+		case s == "\x1b":
+			st.modo = modoTabla
+		case s == "\x7f" || s == "\b":
+			if len(st.entrada) > 0 {
+				st.entrada = st.entrada[:len(st.entrada)-1]
+			}
+		case len(s) == 1 && s[0] >= 0x20:
+			st.entrada += s
+		}
+		return false
+
+	case modoConfirmar:
+		if s == "y" || s == "Y" {
+			if err := unix.Kill(st.inspPID, unix.SIGTERM); err != nil {
+				st.mensaje = fmt.Sprintf("kill %d: %v", st.inspPID, err)
+			} else {
+				st.mensaje = fmt.Sprintf("SIGTERM enviado a %d", st.inspPID)
+			}
+		} else {
+			st.mensaje = "cancelado"
+		}
+		st.modo = modoTabla
+		return false
+
+	case modoInspeccionar:
+		if s == "q" {
+			return true
+		}
+		if s == "\x1b" || s == "i" {
+			st.modo = modoTabla
+		}
+		return false
+	}
+
+	switch s {
+	case "q", "\x03":
+		return true
+	case "\x1b[A", "k":
+		if st.sel > 0 {
+			st.sel--
+		}
+	case "\x1b[B", "j":
+		if st.sel < len(st.visibles)-1 {
+			st.sel++
+		}
+	case "\x1b[5~":
+		st.sel = max(0, st.sel-st.filasTabla())
+	case "\x1b[6~":
+		// con el filtro vacío no hay fila que seleccionar: sel queda en 0
+		st.sel = max(0, min(len(st.visibles)-1, st.sel+st.filasTabla()))
+	case "s":
+		st.orden = (st.orden + 1) % len(tuiColumnas)
+		st.aplicarVista()
+	case "r":
+		st.desc = !st.desc
+		st.aplicarVista()
+	case "/":
+		st.modo, st.entrada = modoFiltro, st.filtro
+	case "c":
+		st.filtro = ""
+		st.aplicarVista()
+	case "i":
+		if p, ok := st.seleccionado(); ok {
+			st.modo, st.inspPID = modoInspeccionar, p.PID
+		}
+	case "x":
+		if p, ok := st.seleccionado(); ok {
+			st.modo, st.inspPID = modoConfirmar, p.PID
+		}
+	}
+	return false
+}
+
+func (st *tuiState) seleccionado() (Process, bool) {
+	if st.sel < 0 || st.sel >= len(st.visibles) {
+		return Process{}, false
+	}
+	return st.visibles[st.sel], true
+}
+
+func tuiSize() (rows, cols int) {
+	ws, err := unix.IoctlGetWinsize(int(os.Stdout.Fd()), unix.TIOCGWINSZ)
+	if err != nil || ws.Row == 0 {
+		return 24, 80
+	}
+	return int(ws.Row), int(ws.Col)
+}
+
+// recortarVisible corta s a cols caracteres visibles: cuenta runas, no
+// bytes, y las secuencias ESC [ ... (colores, negrita) no ocupan columnas.
+func recortarVisible(s string, cols int) string {
+	n := 0
+	for i := 0; i < len(s); {
+		if s[i] == '\x1b' && i+1 < len(s) && s[i+1] == '[' {
+			// parámetros hasta el byte final 0x40-0x7e
+			j := i + 2
+			for j < len(s) && (s[j] < 0x40 || s[j] > 0x7e) {
+				j++
+			}
+			i = j + 1
+			continue
+		}
+		if n == cols {
+			return s[:i]
+		}
+		_, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+		n++
+	}
+	return s
+}
+
+func (st *tuiState) contenedoresVisibles() int {
+	if st.ci == nil {
+		return 0
+	}
+	return min(len(st.ci.Containers), 5)
+}
+
+// filas disponibles para la tabla de procesos
+func (st *tuiState) filasTabla() int {
+	rows, _ := tuiSize()
+	// encabezado(3) + contenedores(título + n + separador) + título tabla + pie(2)
+	n := rows - 3 - (st.contenedoresVisibles() + 2) - 1 - 2
+	return max(n, 1)
+}
+
+func (st *tuiState) dibujar() {
+	_, cols := tuiSize()
+	var b strings.Builder
+	line := func(format string, args ...any) {
+		// el reset va siempre: si el recorte se come el \x1b[0m de un
+		// encabezado, el estilo no se arrastra a las líneas siguientes
+		b.WriteString(recortarVisible(fmt.Sprintf(format, args...), cols) + "\x1b[0m\x1b[K\r\n")
+	}
+
+	b.WriteString("\x1b[H")
+
+	if st.modo == modoInspeccionar {
+		st.dibujarInspeccion(line)
+		b.WriteString("\x1b[J")
+		fmt.Print(b.String())
+		return
+	}
+
+	used := uint64(0)
+	if st.si.Totalram >= st.si.Freeram {
+		used = st.si.Totalram - st.si.Freeram
+	}
+	line("\x1b[1mSYSINFO\x1b[0m (%s)  %s  RAM total=%dMB libre=%dMB usada=%dMB  CPU=%.1f%%  procesos=%d",
+		st.origen, time.Now().Format("15:04:05"), st.si.Totalram/1024, st.si.Freeram/1024, used/1024, st.cpuTotal, st.si.Procs)
+	filtro := st.filtro
+	if filtro == "" {
+		filtro = "-"
+	}
+	dir := "↑"
+	if st.desc {
+		dir = "↓"
+	}
+	line("orden=%s%s  filtro=%s  mostrando=%d", tuiColumnas[st.orden].titulo, dir, filtro, len(st.visibles))
+	if st.errMsg != "" {
+		line("\x1b[31mERROR: %s\x1b[0m", st.errMsg)
+	} else {
+		line("")
+	}
+
+	// panel de contenedores (top 5 por RSS)
+	line("\x1b[1mCONTENEDORES\x1b[0m (%d)", func() int {
+		if st.ci == nil {
+			return 0
+		}
+		return len(st.ci.Containers)
+	}())
+	if st.ci != nil {
+		cs := append([]ContainerEntry(nil), st.ci.Containers...)
+		sort.Slice(cs, func(i, j int) bool { return cs[i].RSSKB > cs[j].RSSKB })
+		for _, c := range cs[:st.contenedoresVisibles()] {
+			cpu := "   -"
+			if c.CPUPercentOK {
+				cpu = fmt.Sprintf("%6.1f", c.CPUPercent)
+			}
+			line("  %-12s RSS=%8dKB CPU%%=%s procs=%d", shortID(c.ContainerID), c.RSSKB, cpu, c.Procs)
+		}
+	}
+	line("")
+
+	// tabla de procesos
+	line("\x1b[7m%7s %-16s %10s %12s %6s %6s  %s\x1b[0m", "PID", "NOMBRE", "RSS(KB)", "VSZ(KB)", "MEM%", "CPU%", "CMD")
+	filas := st.filasTabla()
+	if st.sel < st.top {
+		st.top = st.sel
+	}
+	if st.sel >= st.top+filas {
+		st.top = st.sel - filas + 1
+	}
+	for i := st.top; i < st.top+filas; i++ {
+		if i >= len(st.visibles) {
+			line("")
+			continue
+		}
+		p := st.visibles[i]
+		cpu := "     -"
+		if p.CPUPercentOK {
+			cpu = fmt.Sprintf("%6.1f", p.CPUPercent)
+		}
+		row := fmt.Sprintf("%7d %-16.16s %10d %12d %6.1f %s  %s",
+			p.PID, p.Name, p.RSS, p.VSZ, p.MemoryUsage, cpu, safeOneLine(p.Cmdline, 0))
+		if len(row) > cols {
+			row = row[:cols]
+		}
+		if i == st.sel {
+			row = "\x1b[7m" + row + "\x1b[0m"
+		}
+		line("%s", row)
+	}
+
+	// pie
+	switch st.modo {
+	case modoFiltro:
+		line("\x1b[1mfiltro:\x1b[0m %s_", st.entrada)
+	case modoConfirmar:
+		line("\x1b[1m¿Enviar SIGTERM a PID %d? [y/N]\x1b[0m", st.inspPID)
+	default:
+		line("%s", st.mensaje)
+	}
+	b.WriteString("↑↓/jk mover  s orden  r invertir  / filtrar  c limpiar  i inspeccionar  x SIGTERM  q salir\x1b[K")
+	b.WriteString("\x1b[J")
+	fmt.Print(b.String())
+}
+
+func (st *tuiState) dibujarInspeccion(line func(string, ...any)) {
+	var p *Process
+	for i := range st.si.Processes {
+		if st.si.Processes[i].PID == st.inspPID {
+			p = &st.si.Processes[i]
+			break
+		}
+	}
+	line("\x1b[1mPROCESO %d\x1b[0m  (Esc/i volver, q salir)", st.inspPID)
+	line("")
+	if p == nil {
+		line("el proceso ya no aparece en la última muestra (%s)", st.origen)
+		return
+	}
+
+	line("Nombre:     %s", p.Name)
+	line("Cmdline:    %s", safeOneLine(p.Cmdline, 0))
+	line("RSS:        %d KB", p.RSS)
+	line("VSZ:        %d KB", p.VSZ)
+	line("Mem%%:       %.1f", p.MemoryUsage)
+	line("CPU_Usage:  %.2f (módulo, acumulado)", p.CPUUsage)
+	if p.CPUPercentOK {
+		line("CPU%%:       %.2f (intervalo)", p.CPUPercent)
+	} else {
+		line("CPU%%:       - (esperando segunda muestra)")
+	}
+	line("utime:      %d", p.UTime)
+	line("stime:      %d", p.STime)
+	line("")
+
+	// datos extra de /proc/[pid]/status
+	path := filepath.Join(st.fuente.ProcRoot, strconv.Itoa(p.PID), "status")
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		line("%s: %v", path, err)
+		return
+	}
+	for _, ln := range strings.Split(string(raw), "\n") {
+		k, _, _ := strings.Cut(ln, ":")
+		switch k {
+		case "State", "PPid", "Uid", "Threads", "VmPeak", "VmSwap", "voluntary_ctxt_switches", "nonvoluntary_ctxt_switches":
+			line("%s", strings.Join(strings.Fields(ln), " "))
+		}
+	}
+}
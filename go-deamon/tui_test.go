@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+func TestRecortarVisible(t *testing.T) {
+	cases := []struct {
+		name string
+		s    string
+		cols int
+		want string
+	}{
+		{name: "entra", s: "hola", cols: 10, want: "hola"},
+		{name: "justo", s: "hola", cols: 4, want: "hola"},
+		{name: "corta", s: "hola mundo", cols: 4, want: "hola"},
+		{name: "multibyte", s: "año ↑↓ más", cols: 5, want: "año ↑"},
+		{name: "escapes no cuentan", s: "\x1b[1mSYS\x1b[0m (proc)", cols: 5, want: "\x1b[1mSYS\x1b[0m ("},
+		{name: "corte dentro del color", s: "\x1b[7m  PID NOMBRE\x1b[0m", cols: 5, want: "\x1b[7m  PID"},
+		{name: "escape al final se conserva", s: "\x1b[31mERR\x1b[0m", cols: 3, want: "\x1b[31mERR\x1b[0m"},
+		{name: "cero", s: "\x1b[1mx", cols: 0, want: "\x1b[1m"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := recortarVisible(tc.s, tc.cols); got != tc.want {
+				t.Errorf("recortarVisible(%q, %d) = %q, se esperaba %q", tc.s, tc.cols, got, tc.want)
+			}
+		})
+	}
+}
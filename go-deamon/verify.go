@@ -0,0 +1,304 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// `daemon verify`: lee el JSON de los módulos y lo mismo armado desde /proc
+// (fuente_proc.go) a la vez y reporta los campos que difieren más que la
+// tolerancia. Sale con 1 si hay discrepancias, para usarlo como gate al
+// cambiar los módulos.
+
+// Tolerancias de verify (flags propios del subcomando)
+type verifyTol struct {
+	KB    uint64        // diferencia absoluta aceptada en RAM/RSS/VSZ
+	Pct   float64       // o relativa (% del mayor), lo que sea más permisivo
+	MemPP float64       // puntos de Memory_Usage
+	CPU   time.Duration // utime+stime / CPU_Jiffies
+	Procs int           // procesos de diferencia en conteos y PIDs de un solo lado
+}
+
+type Discrepancia struct {
+	Ambito string `json:"ambito"` // host | proceso | contenedor
+	Clave  string `json:"clave"`  // PID o ID de contenedor
+	Campo  string `json:"campo"`
+	Kernel string `json:"kernel"`
+	Proc   string `json:"proc"`
+	Tol    string `json:"tolerancia"`
+}
+
+type verifyResultado struct {
+	OK                     bool           `json:"ok"`
+	ProcesosKernel         int            `json:"procesos_kernel"`
+	ProcesosProc           int            `json:"procesos_proc"`
+	ProcesosComparados     int            `json:"procesos_comparados"`
+	ContenedoresKernel     int            `json:"contenedores_kernel"`
+	ContenedoresProc       int            `json:"contenedores_proc"`
+	ContenedoresComparados int            `json:"contenedores_comparados"`
+	Discrepancias          []Discrepancia `json:"discrepancias"`
+	ErrorContenedores      string         `json:"error_contenedores,omitempty"`
+}
+
+func runVerifyCmd(args []string) int {
+	var (
+		tol      verifyTol
+		tolKB    int
+		sinConts bool
+	)
+	c, err := parseCmd("verify", args, func(fs *flag.FlagSet) {
+		fs.IntVar(&tolKB, "tol-kb", 256, "diferencia aceptada en KB (RAM, RSS, VSZ)")
+		fs.Float64Var(&tol.Pct, "tol-pct", 2, "diferencia aceptada en % del valor mayor (RAM, RSS, VSZ)")
+		fs.Float64Var(&tol.MemPP, "tol-mem", 0.1, "puntos de diferencia aceptados en Memory_Usage")
+		fs.DurationVar(&tol.CPU, "tol-cpu", 100*time.Millisecond, "diferencia aceptada en tiempo de CPU")
+		fs.IntVar(&tol.Procs, "tol-procs", 5, "procesos de diferencia aceptados en conteos")
+		fs.BoolVar(&sinConts, "sin-contenedores", false, "no comparar continfo")
+	})
+	if err != nil {
+		return cmdExit(err)
+	}
+	if len(c.args) > 0 || tolKB < 0 || tol.Pct < 0 || tol.MemPP < 0 || tol.CPU < 0 || tol.Procs < 0 {
+		return c.uso("verify [--json] [--tol-kb N] [--tol-pct P] [--tol-mem P] [--tol-cpu D] [--tol-procs N] [--sin-contenedores]")
+	}
+	tol.KB = uint64(tolKB)
+
+	f := NewFuente(c.cfg)
+	v := verificador{tol: tol, hz: float64(f.CPUTimeHz)}
+
+	// 1) sysinfo: módulo y /proc al mismo tiempo
+	var (
+		siK, siP   *SysInfo
+		errK, errP error
+	)
+	enParalelo(
+		func() { siK, errK = ReadSysInfo(f.SysinfoProc) },
+		func() { siP, errP = f.procSysInfo() },
+	)
+	if errK != nil {
+		return c.fail("sysinfo (kernel)", errK)
+	}
+	if errP != nil {
+		return c.fail("sysinfo (proc)", errP)
+	}
+	v.sysinfo(siK, siP)
+
+	res := verifyResultado{ProcesosKernel: len(siK.Processes), ProcesosProc: len(siP.Processes)}
+	res.ProcesosComparados = v.comparados
+
+	// 2) continfo
+	if !sinConts {
+		var ciK, ciP *ContInfo
+		enParalelo(
+			func() { ciK, errK = ReadContainerInfo(f.ContinfoProc) },
+			func() { ciP, errP = f.procContInfo() },
+		)
+		switch {
+		case errK != nil:
+			res.ErrorContenedores = "kernel: " + errK.Error()
+		case errP != nil:
+			res.ErrorContenedores = "proc: " + errP.Error()
+		default:
+			v.comparados = 0
+			v.continfo(ciK, ciP)
+			res.ContenedoresKernel, res.ContenedoresProc = len(ciK.Containers), len(ciP.Containers)
+			res.ContenedoresComparados = v.comparados
+		}
+	}
+
+	res.Discrepancias = v.dif
+	if res.Discrepancias == nil {
+		res.Discrepancias = []Discrepancia{}
+	}
+	res.OK = len(res.Discrepancias) == 0 && res.ErrorContenedores == ""
+
+	c.emit(res, func() { printVerify(res) })
+	if !res.OK {
+		return 1
+	}
+	return 0
+}
+
+func enParalelo(fns ...func()) {
+	var wg sync.WaitGroup
+	wg.Add(len(fns))
+	for _, fn := range fns {
+		go func() {
+			defer wg.Done()
+			fn()
+		}()
+	}
+	wg.Wait()
+}
+
+type verificador struct {
+	tol        verifyTol
+	hz         float64 // unidades de utime/stime por segundo
+	dif        []Discrepancia
+	comparados int
+}
+
+func (v *verificador) agregar(ambito, clave, campo, kernel, proc, tol string) {
+	v.dif = append(v.dif, Discrepancia{ambito, clave, campo, kernel, proc, tol})
+}
+
+// kb compara cantidades de memoria con tolerancia absoluta o relativa.
+func (v *verificador) kb(ambito, clave, campo string, k, p uint64) {
+	dif := absDif(k, p)
+	lim := max(v.tol.KB, uint64(float64(max(k, p))*v.tol.Pct/100))
+	if dif > lim {
+		v.agregar(ambito, clave, campo, fmt.Sprint(k), fmt.Sprint(p), fmt.Sprintf("±%dKB", lim))
+	}
+}
+
+func (v *verificador) cpu(ambito, clave, campo string, k, p uint64) {
+	lim := uint64(v.tol.CPU.Seconds() * v.hz)
+	if absDif(k, p) > lim {
+		v.agregar(ambito, clave, campo, fmt.Sprint(k), fmt.Sprint(p), "±"+v.tol.CPU.String())
+	}
+}
+
+func (v *verificador) conteo(ambito, clave, campo string, k, p int) {
+	if d := k - p; d > v.tol.Procs || -d > v.tol.Procs {
+		v.agregar(ambito, clave, campo, strconv.Itoa(k), strconv.Itoa(p), fmt.Sprintf("±%d", v.tol.Procs))
+	}
+}
+
+func (v *verificador) sysinfo(k, p *SysInfo) {
+	v.kb("host", "-", "Totalram", k.Totalram, p.Totalram)
+	v.kb("host", "-", "Freeram", k.Freeram, p.Freeram)
+	v.conteo("host", "-", "Procs", k.Procs, p.Procs)
+	// el módulo cuenta y lista en dos recorridos distintos
+	v.conteo("host", "kernel", "Procs vs len(Processes)", k.Procs, len(k.Processes))
+
+	porPID := make(map[int]Process, len(p.Processes))
+	for _, pp := range p.Processes {
+		porPID[pp.PID] = pp
+	}
+
+	var soloK, soloP []int
+	vistos := make(map[int]bool, len(k.Processes))
+	for _, pk := range k.Processes {
+		vistos[pk.PID] = true
+		pp, ok := porPID[pk.PID]
+		if !ok {
+			soloK = append(soloK, pk.PID)
+			continue
+		}
+		v.comparados++
+		v.proceso(pk, pp, p.Totalram)
+	}
+	for _, pp := range p.Processes {
+		if !vistos[pp.PID] {
+			soloP = append(soloP, pp.PID)
+		}
+	}
+	// procesos que nacen o terminan entre las dos lecturas
+	if len(soloK)+len(soloP) > v.tol.Procs {
+		v.agregar("host", "-", "PIDs de un solo lado",
+			"solo kernel: "+listaPIDs(soloK), "solo proc: "+listaPIDs(soloP), fmt.Sprintf("≤%d", v.tol.Procs))
+	}
+}
+
+func (v *verificador) proceso(k, p Process, totalKB uint64) {
+	clave := strconv.Itoa(k.PID)
+	if k.Name != p.Name {
+		v.agregar("proceso", clave, "Name", k.Name, p.Name, "igual")
+	}
+	if k.Cmdline != p.Cmdline {
+		v.agregar("proceso", clave, "Cmdline", safeOneLine(k.Cmdline, 60), safeOneLine(p.Cmdline, 60), "igual")
+	}
+	v.kb("proceso", clave, "vsz", k.VSZ, p.VSZ)
+	v.kb("proceso", clave, "rss", k.RSS, p.RSS)
+
+	// contra el valor exacto, no contra el truncado de fuente_proc
+	if totalKB > 0 {
+		exacto := float64(p.RSS) * 100 / float64(totalKB)
+		if math.Abs(k.MemoryUsage-exacto) > v.tol.MemPP {
+			v.agregar("proceso", clave, "Memory_Usage", fmt.Sprintf("%.1f", k.MemoryUsage),
+				fmt.Sprintf("%.3f", exacto), fmt.Sprintf("±%.2f", v.tol.MemPP))
+		}
+	}
+	v.cpu("proceso", clave, "utime+stime", k.UTime+k.STime, p.UTime+p.STime)
+}
+
+func (v *verificador) continfo(k, p *ContInfo) {
+	v.conteo("host", "-", "contenedores", len(k.Containers), len(p.Containers))
+	if k.Count != len(k.Containers) {
+		v.agregar("host", "kernel", "Count vs len(Containers)", strconv.Itoa(k.Count), strconv.Itoa(len(k.Containers)), "igual")
+	}
+
+	for _, ck := range k.Containers {
+		cp := p.Find(ck.ContainerID)
+		if cp == nil || cp.ContainerID != ck.ContainerID {
+			v.agregar("contenedor", shortID(ck.ContainerID), "presente", "sí", "no", "igual")
+			continue
+		}
+		v.comparados++
+		clave := shortID(ck.ContainerID)
+		if ck.CgroupPath != cp.CgroupPath {
+			v.agregar("contenedor", clave, "CgroupPath", ck.CgroupPath, cp.CgroupPath, "igual")
+		}
+		v.kb("contenedor", clave, "RSS_KB", ck.RSSKB, cp.RSSKB)
+		v.cpu("contenedor", clave, "CPU_Jiffies", ck.CPUJiffies, cp.CPUJiffies)
+		v.conteo("contenedor", clave, "Procs", int(ck.Procs), int(cp.Procs))
+	}
+	for _, cp := range p.Containers {
+		if ck := k.Find(cp.ContainerID); ck == nil || ck.ContainerID != cp.ContainerID {
+			v.agregar("contenedor", shortID(cp.ContainerID), "presente", "no", "sí", "igual")
+		}
+	}
+}
+
+func printVerify(r verifyResultado) {
+	fmt.Printf("procesos: kernel=%d proc=%d comparados=%d\n", r.ProcesosKernel, r.ProcesosProc, r.ProcesosComparados)
+	if r.ErrorContenedores != "" {
+		fmt.Printf("contenedores: ERROR %s\n", r.ErrorContenedores)
+	} else {
+		fmt.Printf("contenedores: kernel=%d proc=%d comparados=%d\n", r.ContenedoresKernel, r.ContenedoresProc, r.ContenedoresComparados)
+	}
+	if len(r.Discrepancias) == 0 {
+		if r.OK {
+			fmt.Println("OK: sin discrepancias fuera de tolerancia")
+		}
+		return
+	}
+
+	fmt.Printf("\n%d discrepancias:\n", len(r.Discrepancias))
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ÁMBITO\tCLAVE\tCAMPO\tKERNEL\tPROC\tTOLERANCIA")
+	for _, d := range r.Discrepancias {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", d.Ambito, d.Clave, d.Campo, d.Kernel, d.Proc, d.Tol)
+	}
+	_ = tw.Flush()
+}
+
+func absDif(a, b uint64) uint64 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+func listaPIDs(pids []int) string {
+	if len(pids) == 0 {
+		return "-"
+	}
+	sort.Ints(pids)
+	s := make([]string, 0, 10)
+	for i, pid := range pids {
+		if i == 10 {
+			s = append(s, fmt.Sprintf("... (+%d)", len(pids)-10))
+			break
+		}
+		s = append(s, strconv.Itoa(pid))
+	}
+	return strings.Join(s, ",")
+}